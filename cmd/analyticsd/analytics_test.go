@@ -0,0 +1,123 @@
+package main
+
+import (
+	"burlo/pkg/dx2w"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 0.0001
+}
+
+func TestAnalytics(t *testing.T) {
+	a := newAnalytics(2, time.Minute)
+	start := time.Date(2024, 1, 15, 12, 0, 0, 0, time.Local)
+	at := func(minutes int) time.Time {
+		return start.Add(time.Duration(minutes) * time.Minute)
+	}
+	heating := sample{InputKW: 1.5, OutputKW: 4.5, OutsideT: -3, Running: true}
+	defrost := sample{InputKW: 1.5, OutputKW: -1.5, OutsideT: -3, Running: true, Defrost: true}
+	aux := sample{InputKW: 1.5, OutputKW: 4.5, AuxKW: 3, OutsideT: -5, Running: true}
+
+	// 60 minutes heating, 6 defrosting, 12 with aux, then a gap
+	for i := 0; i < 60; i++ {
+		heating.Time = at(i)
+		a.add(heating)
+	}
+	for i := 60; i < 66; i++ {
+		defrost.Time = at(i)
+		a.add(defrost)
+	}
+	for i := 66; i < 78; i++ {
+		aux.Time = at(i)
+		a.add(aux)
+	}
+	heating.Time = at(200) // not counted
+	a.add(heating)
+
+	day := a.Days["2024-01-15"]
+	if day == nil || day.Defrosts != 1 {
+		t.Fatalf("expected one defrost on 2024-01-15, got %+v", day)
+	}
+	// the last aux sample is followed by the gap
+	want := map[string]Energy{
+		ModeHeat:    {Input: 1.5*60/60 + 1.5*11/60, Output: 4.5*60/60 + 4.5*11/60},
+		ModeDefrost: {Input: 1.5 * 6 / 60, Output: -1.5 * 6 / 60},
+		ModeAux:     {Input: 3 * 11 / 60.0, Output: 3 * 11 / 60.0},
+	}
+	for mode, energy := range want {
+		got := day.Modes[mode]
+		if !near(got.Input, energy.Input) || !near(got.Output, energy.Output) {
+			t.Errorf("expected %s %+v, got %+v", mode, energy, got)
+		}
+	}
+
+	rollups := rollup(selectDays(a.Days, "", ""), seasonalPeriod)
+	if len(rollups) != 1 || rollups[0].Period != "2023-2024" {
+		t.Fatalf("expected the 2023-2024 season, got %+v", rollups)
+	}
+	r := rollups[0]
+	in := 1.5*77/60 + 3*11/60.0
+	out := 4.5*71/60 - 1.5*6/60 + 3*11/60.0
+	if !near(r.SCOP, out/in) {
+		t.Errorf("expected scop %v, got %v", out/in, r.SCOP)
+	}
+	if !near(r.DefrostPenalty, 1.5*6/60/in) {
+		t.Errorf("expected defrost penalty %v, got %v", 1.5*6/60/in, r.DefrostPenalty)
+	}
+
+	// heat and defrost at -3°C are in the -4 bin, aux at -5°C in -6
+	curve := copCurve(selectDays(a.Days, "2024-01-01", "2024-01-31"))
+	if len(curve) != 2 || curve[0].OutsideT != -6 || curve[1].OutsideT != -4 {
+		t.Fatalf("expected the -6 and -4 bins, got %+v", curve)
+	}
+	if !near(curve[1].COP, (4.5*60-1.5*6)/(1.5*66)) {
+		t.Errorf("expected the defrosts in the -4 bin cop, got %v", curve[1].COP)
+	}
+}
+
+func TestPeriods(t *testing.T) {
+	day := time.Date(2024, 9, 1, 0, 0, 0, 0, time.Local)
+	if weeklyPeriod(day) != "2024-W35" || seasonalPeriod(day) != "2024-2025" {
+		t.Errorf("unexpected periods %s %s", weeklyPeriod(day), seasonalPeriod(day))
+	}
+	if seasonalPeriod(day.AddDate(0, 0, -1)) != "2023-2024" {
+		t.Errorf("expected August in the previous season")
+	}
+}
+
+func TestReadSample(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	values := map[string]dx2w.Value{
+		"HP_INPUT_KW":      {Float32: 1.5, Timestamp: now.Add(-10 * time.Second)},
+		"HP_OUTPUT_KW":     {Float32: 4.5, Timestamp: now.Add(-10 * time.Second)},
+		"COMPRESSOR_CALL":  {Bool: true, Type: dx2w.BOOL, Timestamp: now.Add(-10 * time.Second)},
+		"OUTSIDE_AIR_TEMP": {Float32: 23, Timestamp: now.Add(-90 * time.Second)},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dx2w/registers" {
+			json.NewEncoder(w).Encode(values)
+			return
+		}
+		w.Write([]byte(`{"Outputs": {"DHW": {"Priority": true}}}`))
+	}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+	registers := dx2w.NewHTTPClient(address)
+
+	s, ok := readSample(registers, address, now, 15*time.Second)
+	if !ok || s.InputKW != 1.5 || !s.DHW || !near(s.OutsideT, -5) {
+		t.Errorf("expected a sample, got %+v", s)
+	}
+
+	// dx2wlogger still serves the last values after losing the DX2W
+	if _, ok := readSample(registers, address, now.Add(time.Minute), 15*time.Second); ok {
+		t.Error("expected stale registers to be skipped")
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// operating modes, aux is the electric boiler, it can run
+// alongside the heat pump
+const (
+	ModeHeat    = "heat"
+	ModeCool    = "cool"
+	ModeDHW     = "dhw"
+	ModeDefrost = "defrost"
+	ModeAux     = "aux"
+	ModeIdle    = "idle" // standby consumption
+)
+
+var modes = []string{ModeHeat, ModeCool, ModeDHW, ModeDefrost, ModeAux, ModeIdle}
+
+// heating degree days base temperature
+const degreeDayBase = 18 // °C
+
+// Energy is in kWh
+type Energy struct {
+	Input  float64 // electricity
+	Output float64 // heat delivered (or removed, when cooling)
+}
+
+func (e *Energy) add(o Energy) {
+	e.Input += o.Input
+	e.Output += o.Output
+}
+
+// COP is 0 without input
+func (e Energy) COP() float64 {
+	if e.Input <= 0 {
+		return 0
+	}
+	return e.Output / e.Input
+}
+
+// Day is the daily rollup, days are in local time
+type Day struct {
+	Date       string // 2024-01-31
+	Modes      map[string]Energy
+	Defrosts   int
+	DegreeDays float64
+	Seconds    float64 // time covered by the samples
+	// heating energy (heat and defrost) by outdoor temperature,
+	// keyed by the lower bound of the bin, in °C
+	Bins map[int]Energy
+}
+
+func newDay(date string) *Day {
+	return &Day{
+		Date:  date,
+		Modes: make(map[string]Energy),
+		Bins:  make(map[int]Energy),
+	}
+}
+
+// sample is one reading of the heat pump
+type sample struct {
+	Time     time.Time
+	InputKW  float64
+	OutputKW float64
+	AuxKW    float64
+	OutsideT float64 // °C
+	Running  bool    // compressor call
+	Cooling  bool
+	Defrost  bool
+	DHW      bool // controller DHW priority
+}
+
+func (s sample) mode() string {
+	switch {
+	case s.Defrost:
+		return ModeDefrost
+	case !s.Running:
+		return ModeIdle
+	case s.Cooling:
+		return ModeCool
+	case s.DHW:
+		return ModeDHW
+	default:
+		return ModeHeat
+	}
+}
+
+// Analytics integrates the samples into daily rollups
+type Analytics struct {
+	Days    map[string]*Day
+	BinSize int           // °C
+	MaxGap  time.Duration // longer gaps between samples are not counted
+	last    *sample
+}
+
+func newAnalytics(binSize int, maxGap time.Duration) *Analytics {
+	return &Analytics{
+		Days:    make(map[string]*Day),
+		BinSize: binSize,
+		MaxGap:  maxGap,
+	}
+}
+
+func (a *Analytics) day(t time.Time) *Day {
+	date := t.Local().Format(time.DateOnly)
+	day, ok := a.Days[date]
+	if !ok {
+		day = newDay(date)
+		a.Days[date] = day
+	}
+	return day
+}
+
+func (a *Analytics) bin(outsideT float64) int {
+	return int(math.Floor(outsideT/float64(a.BinSize))) * a.BinSize
+}
+
+// add integrates the previous sample's power up to this sample,
+// into the day the previous sample was in
+func (a *Analytics) add(s sample) {
+	last := a.last
+	a.last = &s
+	if last == nil {
+		return
+	}
+	dt := s.Time.Sub(last.Time)
+	if dt <= 0 || dt > a.MaxGap {
+		return
+	}
+	hours := dt.Hours()
+	day := a.day(last.Time)
+	day.Seconds += dt.Seconds()
+	day.DegreeDays += max(0, degreeDayBase-last.OutsideT) * hours / 24
+
+	mode := last.mode()
+	energy := Energy{Input: last.InputKW * hours, Output: last.OutputKW * hours}
+	total := day.Modes[mode]
+	total.add(energy)
+	day.Modes[mode] = total
+
+	if last.AuxKW > 0 {
+		aux := day.Modes[ModeAux]
+		aux.add(Energy{Input: last.AuxKW * hours, Output: last.AuxKW * hours})
+		day.Modes[ModeAux] = aux
+	}
+	if mode == ModeHeat || mode == ModeDefrost {
+		bin := a.bin(last.OutsideT)
+		total := day.Bins[bin]
+		total.add(energy)
+		day.Bins[bin] = total
+	}
+	if s.Defrost && !last.Defrost {
+		a.day(s.Time).Defrosts++
+	}
+}
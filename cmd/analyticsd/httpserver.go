@@ -0,0 +1,85 @@
+package main
+
+import (
+	"burlo/config"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func httpserver(ctx context.Context, cfg config.ServiceConf) {
+	port := config.GetPort(cfg.ServiceHTTPAddresses.Analyticsd)
+
+	mux := http.NewServeMux()
+	server := http.Server{
+		Addr:         fmt.Sprintf(":%s", port),
+		ReadTimeout:  time.Minute,
+		WriteTimeout: time.Minute,
+		Handler:      mux,
+	}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(ctx)
+	}()
+
+	// ?from=2024-01-01&to=2024-01-31 selects the days,
+	// ?format=csv (or Accept: text/csv) for csv
+	mux.HandleFunc("GET /analytics/{period}", GetRollups())
+	mux.HandleFunc("GET /analytics/cop-curve", GetCOPCurve())
+
+	fmt.Println("http server listening on", server.Addr)
+	err := server.ListenAndServe()
+	if err != http.ErrServerClosed {
+		fmt.Println(err)
+	}
+}
+
+func wantsCSV(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "csv" ||
+		strings.Contains(r.Header.Get("Accept"), "text/csv")
+}
+
+func writeResponse(w http.ResponseWriter, r *http.Request, data interface{}, records [][]string) {
+	if wantsCSV(r) {
+		w.Header().Set("Content-Type", "text/csv")
+		csv.NewWriter(w).WriteAll(records)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
+
+// requestedDays must be called with the mutex held
+func requestedDays(r *http.Request) []*Day {
+	query := r.URL.Query()
+	return selectDays(analytics.Days, query.Get("from"), query.Get("to"))
+}
+
+// GetRollups serves the daily, weekly or seasonal rollups
+func GetRollups() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		period, ok := periods[r.PathValue("period")]
+		if !ok {
+			http.Error(w, "expected daily, weekly, seasonal or cop-curve", http.StatusNotFound)
+			return
+		}
+		mutex.Lock()
+		rollups := rollup(requestedDays(r), period)
+		mutex.Unlock()
+		writeResponse(w, r, rollups, rollupsCSV(rollups))
+	}
+}
+
+// GetCOPCurve serves the heating COP by outdoor temperature
+func GetCOPCurve() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		curve := copCurve(requestedDays(r))
+		mutex.Unlock()
+		writeResponse(w, r, curve, curveCSV(curve))
+	}
+}
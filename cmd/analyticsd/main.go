@@ -0,0 +1,175 @@
+package main
+
+import (
+	"burlo/config"
+	"burlo/pkg/dx2w"
+	"burlo/pkg/psychro"
+	"burlo/pkg/store"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// analyticsd: integrates the heat pump power (DX2W registers) into daily
+// energy rollups by mode (heat, cool, dhw, defrost, aux), and serves the
+// daily, weekly and seasonal SCOP, and the COP versus outdoor temperature
+// curve, as json or csv. The daily rollups are kept on disk.
+
+var mutex sync.Mutex
+var analytics *Analytics
+var stateStore *store.Store
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+var registerFields = []string{
+	"HP_INPUT_KW",
+	"HP_OUTPUT_KW",
+	"AUX_BOILER_KW",
+	"OUTSIDE_AIR_TEMP",
+	"COMPRESSOR_CALL",
+	"COOLING_MODE",
+	"DEFROST",
+}
+
+// the registers a sample needs, and how often dx2wlogger reads them
+var requiredRegisters = map[string]time.Duration{
+	"HP_INPUT_KW":      15 * time.Second,
+	"HP_OUTPUT_KW":     15 * time.Second,
+	"COMPRESSOR_CALL":  15 * time.Second,
+	"OUTSIDE_AIR_TEMP": time.Minute,
+}
+
+// how often the rollups are saved
+const saveInterval = 5 * time.Minute
+
+func main() {
+	configPath := flag.String("c", "", "Path to config file")
+	flag.Parse()
+
+	cfg := config.LoadV2(*configPath)
+	settings := analyticsConfig(cfg.Analytics)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Println("started")
+	defer fmt.Println("stopped")
+
+	interval := time.Duration(settings.Interval) * time.Second
+	analytics = newAnalytics(settings.BinSize, 4*interval)
+	initStore(settings)
+	defer saveDays()
+
+	go httpserver(ctx, cfg)
+
+	registers := dx2w.NewHTTPClient(cfg.ServiceHTTPAddresses.Dx2Wlogger)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastSave := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s, ok := readSample(registers, cfg.ServiceHTTPAddresses.Controller, now, interval)
+			if !ok {
+				continue
+			}
+			mutex.Lock()
+			analytics.add(s)
+			mutex.Unlock()
+			if now.Sub(lastSave) >= saveInterval {
+				saveDays()
+				lastSave = now
+			}
+		}
+	}
+}
+
+func analyticsConfig(cfg config.Analytics) config.Analytics {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 15
+	}
+	if cfg.BinSize <= 0 {
+		cfg.BinSize = 2
+	}
+	return cfg
+}
+
+func initStore(cfg config.Analytics) {
+	stateStore = store.OpenOrMemory(cfg.StatePath, "[analytics]")
+	mutex.Lock()
+	defer mutex.Unlock()
+	_, err := stateStore.Get("days", &analytics.Days)
+	if err != nil {
+		fmt.Println("[analytics] failed to load the daily rollups:", err)
+	}
+	if analytics.Days == nil {
+		analytics.Days = make(map[string]*Day)
+	}
+}
+
+func saveDays() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	err := stateStore.Put("days", analytics.Days)
+	if err != nil {
+		fmt.Println("[analytics] failed to save the daily rollups:", err)
+	}
+}
+
+// readSample reads the registers, and the DHW priority from the
+// controller (assumed off when it is unreachable). The sample is
+// skipped when a required register is missing or older than two
+// intervals, eg. while dx2wlogger can't reach the DX2W
+func readSample(registers *dx2w.HTTPClient, controller string, t time.Time, interval time.Duration) (sample, bool) {
+	values := registers.Read(registerFields)
+	for name, period := range requiredRegisters {
+		v, ok := values[name]
+		if !ok || t.Sub(v.Timestamp) > 2*max(interval, period) {
+			return sample{}, false
+		}
+	}
+	dhw, err := fetchDHWPriority(controller)
+	if err != nil {
+		fmt.Println("[analytics] failed to read controller state:", err)
+	}
+	return sample{
+		Time:     t,
+		InputKW:  float64(values["HP_INPUT_KW"].Float32),
+		OutputKW: float64(values["HP_OUTPUT_KW"].Float32),
+		AuxKW:    float64(values["AUX_BOILER_KW"].Float32),
+		OutsideT: float64(psychro.FahrenheitToCelsius(values["OUTSIDE_AIR_TEMP"].Float32)),
+		Running:  values["COMPRESSOR_CALL"].Bool,
+		Cooling:  values["COOLING_MODE"].Bool,
+		Defrost:  values["DEFROST"].Bool,
+		DHW:      dhw,
+	}, true
+}
+
+func fetchDHWPriority(address string) (bool, error) {
+	resp, err := httpClient.Get(fmt.Sprintf("http://%s/controller/state", address))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	var state struct {
+		Outputs struct {
+			DHW struct {
+				Priority bool
+			}
+		}
+	}
+	err = json.NewDecoder(resp.Body).Decode(&state)
+	return state.Outputs.DHW.Priority, err
+}
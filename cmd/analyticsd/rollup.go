@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Rollup sums the days of a period
+type Rollup struct {
+	Period     string
+	Days       int
+	Modes      map[string]Energy
+	COP        map[string]float64 // by mode
+	Defrosts   int
+	DegreeDays float64
+	// heat delivered over electricity used for heating:
+	// heat, dhw, defrost and aux
+	SCOP float64
+	// cooling removed over electricity used for cooling
+	SEER float64
+	// share of the heating electricity used for defrosting
+	DefrostPenalty float64
+	// heating electricity per heating degree day, compares
+	// periods with different weather
+	KWhPerDegreeDay float64
+}
+
+// period keys, a day is within one period
+func dailyPeriod(day time.Time) string {
+	return day.Format(time.DateOnly)
+}
+
+func weeklyPeriod(day time.Time) string {
+	year, week := day.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// heating seasons start on September 1st
+func seasonalPeriod(day time.Time) string {
+	year := day.Year()
+	if day.Month() < time.September {
+		year--
+	}
+	return fmt.Sprintf("%d-%d", year, year+1)
+}
+
+var periods = map[string]func(time.Time) string{
+	"daily":    dailyPeriod,
+	"weekly":   weeklyPeriod,
+	"seasonal": seasonalPeriod,
+}
+
+// selectDays returns the days from..to (inclusive, either can
+// be empty), in order
+func selectDays(days map[string]*Day, from, to string) []*Day {
+	var selected []*Day
+	for date, day := range days {
+		if (from == "" || date >= from) && (to == "" || date <= to) {
+			selected = append(selected, day)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i].Date < selected[j].Date
+	})
+	return selected
+}
+
+// rollup sums the days by period, in order
+func rollup(days []*Day, period func(time.Time) string) []Rollup {
+	var rollups []Rollup
+	index := make(map[string]int)
+	for _, day := range days {
+		date, err := time.ParseInLocation(time.DateOnly, day.Date, time.Local)
+		if err != nil {
+			continue
+		}
+		key := period(date)
+		i, ok := index[key]
+		if !ok {
+			i = len(rollups)
+			index[key] = i
+			rollups = append(rollups, Rollup{Period: key, Modes: make(map[string]Energy)})
+		}
+		r := &rollups[i]
+		r.Days++
+		r.Defrosts += day.Defrosts
+		r.DegreeDays += day.DegreeDays
+		for mode, energy := range day.Modes {
+			total := r.Modes[mode]
+			total.add(energy)
+			r.Modes[mode] = total
+		}
+	}
+	for i := range rollups {
+		rollups[i].derive()
+	}
+	return rollups
+}
+
+func (r *Rollup) derive() {
+	r.COP = make(map[string]float64)
+	for mode, energy := range r.Modes {
+		if mode != ModeIdle {
+			r.COP[mode] = energy.COP()
+		}
+	}
+	var heating Energy
+	for _, mode := range []string{ModeHeat, ModeDHW, ModeDefrost, ModeAux} {
+		heating.add(r.Modes[mode])
+	}
+	r.SCOP = heating.COP()
+	r.SEER = r.Modes[ModeCool].COP()
+	if heating.Input > 0 {
+		r.DefrostPenalty = r.Modes[ModeDefrost].Input / heating.Input
+	}
+	if r.DegreeDays > 0 {
+		r.KWhPerDegreeDay = heating.Input / r.DegreeDays
+	}
+}
+
+// CurvePoint is the heating COP (including defrosts) in
+// an outdoor temperature bin
+type CurvePoint struct {
+	OutsideT float64 // °C, lower bound of the bin
+	Input    float64 // kWh
+	Output   float64 // kWh
+	COP      float64
+}
+
+func copCurve(days []*Day) []CurvePoint {
+	bins := make(map[int]Energy)
+	for _, day := range days {
+		for bin, energy := range day.Bins {
+			total := bins[bin]
+			total.add(energy)
+			bins[bin] = total
+		}
+	}
+	var curve []CurvePoint
+	for bin, energy := range bins {
+		curve = append(curve, CurvePoint{
+			OutsideT: float64(bin),
+			Input:    energy.Input,
+			Output:   energy.Output,
+			COP:      energy.COP(),
+		})
+	}
+	sort.Slice(curve, func(i, j int) bool {
+		return curve[i].OutsideT < curve[j].OutsideT
+	})
+	return curve
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 3, 64)
+}
+
+func rollupsCSV(rollups []Rollup) [][]string {
+	header := []string{"period", "days", "scop", "seer", "defrost_penalty", "defrosts", "degree_days", "kwh_per_degree_day"}
+	for _, mode := range modes {
+		header = append(header, mode+"_in_kwh", mode+"_out_kwh", mode+"_cop")
+	}
+	records := [][]string{header}
+	for _, r := range rollups {
+		record := []string{
+			r.Period,
+			strconv.Itoa(r.Days),
+			formatFloat(r.SCOP),
+			formatFloat(r.SEER),
+			formatFloat(r.DefrostPenalty),
+			strconv.Itoa(r.Defrosts),
+			formatFloat(r.DegreeDays),
+			formatFloat(r.KWhPerDegreeDay),
+		}
+		for _, mode := range modes {
+			energy := r.Modes[mode]
+			record = append(record, formatFloat(energy.Input), formatFloat(energy.Output), formatFloat(energy.COP()))
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func curveCSV(curve []CurvePoint) [][]string {
+	records := [][]string{{"outside_temp", "in_kwh", "out_kwh", "cop"}}
+	for _, point := range curve {
+		records = append(records, []string{
+			formatFloat(point.OutsideT),
+			formatFloat(point.Input),
+			formatFloat(point.Output),
+			formatFloat(point.COP),
+		})
+	}
+	return records
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"burlo/config"
+	"burlo/pkg/actuator"
+	"burlo/pkg/mqtt"
+	"context"
+	"fmt"
+)
+
+// outputs driven by the controller, by name
+const (
+	OutCirculator = "circulator"
+	OutHpMode     = "hpmode"
+	OutDewpoint   = "dewpoint"
+)
+
+var actuators = make(map[string]actuator.Actuator)
+
+func initActuators(ctx context.Context, cfg config.ServiceConf) {
+	outputs := cfg.Controller.Outputs
+
+	// older configs only define the phidgets outputs
+	if len(outputs) == 0 {
+		phidgets := cfg.Controller.Phidgets
+		outputs = map[string]config.Output{
+			OutCirculator: {Type: phidgets.Circulator.Type, Name: "ZoneCirculator", Hubport: phidgets.Circulator.Hubport, Channel: phidgets.Circulator.Channel},
+			OutHpMode:     {Type: phidgets.Hpmode.Type, Name: "CoolingMode", Hubport: phidgets.Hpmode.Hubport, Channel: phidgets.Hpmode.Channel},
+			OutDewpoint:   {Type: phidgets.Dewpoint.Type, Name: "Dewpoint", Hubport: phidgets.Dewpoint.Hubport, Channel: phidgets.Dewpoint.Channel},
+		}
+	}
+
+	// mqtt outputs publish to topics outside of the burlo
+	// prefix (eg. zigbee2mqtt), so they get their own client
+	var mqttc *mqtt.Client
+	for name, out := range outputs {
+		if out.Type == "mqtt" && mqttc == nil {
+			mqttc = mqtt.NewClient(mqtt.Opts{
+				Context:  ctx,
+				Address:  cfg.Mqtt.Address,
+				User:     cfg.Mqtt.User,
+				Pass:     []byte(cfg.Mqtt.Pass),
+				ClientID: "controllerd_actuators",
+			})
+		}
+		act, err := newActuator(name, out, cfg.ServiceHTTPAddresses.Actuators, mqttc)
+		if err != nil {
+			fmt.Println("[controller] output", name, "not configured:", err)
+			continue
+		}
+		fmt.Println("[controller] output", name, "->", act)
+		actuators[name] = act
+	}
+}
+
+func newActuator(name string, out config.Output, phidgetsAddr string, mqttc *mqtt.Client) (actuator.Actuator, error) {
+	if out.Name == "" {
+		out.Name = name
+	}
+	switch out.Type {
+	case "digital_output":
+		return actuator.NewPhidgetsDigital(phidgetsAddr, out.Name, out.Hubport, out.Channel), nil
+	case "voltage_output":
+		return actuator.NewPhidgetsVoltage(phidgetsAddr, out.Name, out.Hubport, out.Channel), nil
+	case "mqtt":
+		if out.Topic == "" {
+			return nil, fmt.Errorf("mqtt output requires a topic")
+		}
+		return actuator.NewMQTT(mqttc, actuator.MQTTOpts{
+			Topic:    out.Topic,
+			Property: out.Property,
+			On:       out.On,
+			Off:      out.Off,
+			Analog:   out.Analog,
+		}), nil
+	case "modbus_coil":
+		if out.Address == "" {
+			return nil, fmt.Errorf("modbus_coil output requires an address")
+		}
+		return actuator.NewModbusCoil(out.Address, out.UnitID, out.Coil), nil
+	case "fake":
+		return actuator.NewFake(out.Name), nil
+	default:
+		return nil, fmt.Errorf("unknown output type: '%s'", out.Type)
+	}
+}
+
+func setOutput(name string, value float32) {
+	act, ok := actuators[name]
+	if !ok {
+		return
+	}
+	err := act.Set(value)
+	if err != nil {
+		fmt.Printf("[controller] output %s (%s): %v\r\n", name, act, err)
+	}
+}
+
+func setOutputBool(name string, on bool) {
+	var value float32
+	if on {
+		value = 1
+	}
+	setOutput(name, value)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"burlo/pkg/dx2w"
+	"burlo/pkg/models/controller"
+	"burlo/pkg/notification"
+	"burlo/pkg/psychro"
+	"context"
+	"fmt"
+	"time"
+)
+
+// The dewpoint voltage lets the DX2W keep its supply above the max
+// indoor dewpoint, this interlock is an independent check of it. While
+// cooling, the supply water temperatures read from the DX2W are compared
+// with every sensor's dewpoint. If the water gets within the margin of a
+// dewpoint (or the DX2W reports a condensate warning) the zone calls are
+// cut until the interlock is reset by hand.
+
+var condensationRegisters = []string{"MIX_WATER_TEMP", "HP_EXITING_WATER_TEMP", "CONDENSATE_WARNING"}
+
+// readings older than this are not trusted
+const maxReadingAge = 5 * time.Minute
+
+const interlockPeriod = 30 * time.Second
+
+type Interlock struct {
+	Tripped  bool
+	Time     time.Time
+	Sensor   string // sensor id, or the DX2W register that tripped it
+	Dewpoint float32
+	Supply   float32
+	Reason   string
+}
+
+func condensationMargin() float32 {
+	if ctrlConfig.RadiantCooling.CondensationMargin > 0 {
+		return ctrlConfig.RadiantCooling.CondensationMargin
+	}
+	return 2
+}
+
+// run_interlock reads the DX2W while cooling and trips the interlock
+func run_interlock(ctx context.Context) {
+	ticker := time.NewTicker(interlockPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		run_interlock_check()
+	}
+}
+
+func run_interlock_check() {
+	inputMutex.Lock()
+	cooling := currentState.DX2W.Mode == DX2W_COOL && !currentState.Interlock.Tripped
+	inputMutex.Unlock()
+	if !cooling || dx2w_client == nil {
+		return
+	}
+
+	// read without holding the inputs, this can take a while
+	readings := dx2w_client.Read(condensationRegisters)
+
+	inputMutex.Lock()
+	defer inputMutex.Unlock()
+	interlock, tripped := checkCondensation(readings, now())
+	if tripped && currentState.DX2W.Mode == DX2W_COOL && !currentState.Interlock.Tripped {
+		tripInterlock(interlock)
+		tryRunController()
+	}
+}
+
+// checkCondensation compares the coldest supply water temperature
+// with the dewpoint of every thermostat and humidistat
+func checkCondensation(readings map[string]dx2w.Value, t time.Time) (Interlock, bool) {
+	fresh := func(name string) (dx2w.Value, bool) {
+		value, ok := readings[name]
+		return value, ok && t.Sub(value.Timestamp) < maxReadingAge
+	}
+	if warning, ok := fresh("CONDENSATE_WARNING"); ok && warning.Bool {
+		return Interlock{
+			Tripped: true,
+			Time:    t,
+			Sensor:  "CONDENSATE_WARNING",
+			Reason:  "the DX2W reports a condensate warning",
+		}, true
+	}
+
+	var supply float32
+	found := false
+	for _, name := range condensationRegisters[:2] {
+		value, ok := fresh(name)
+		if !ok {
+			continue
+		}
+		temp := psychro.FahrenheitToCelsius(value.Float32)
+		if !found || temp < supply {
+			supply = temp
+		}
+		found = true
+	}
+	if !found {
+		return Interlock{}, false
+	}
+
+	// the sensor with the highest dewpoint is the closest to condensing
+	var worst controller.Thermostat
+	for _, sensors := range []map[string]controller.Thermostat{thermostats, humidistats} {
+		for _, sensor := range sensors {
+			if worst.ID == "" || sensor.Dewpoint > worst.Dewpoint {
+				worst = sensor
+			}
+		}
+	}
+	margin := condensationMargin()
+	if worst.ID == "" || worst.Dewpoint+margin <= supply {
+		return Interlock{}, false
+	}
+	return Interlock{
+		Tripped:  true,
+		Time:     t,
+		Sensor:   worst.ID,
+		Dewpoint: worst.Dewpoint,
+		Supply:   supply,
+		Reason: fmt.Sprintf("supply water %.1f°C is within %.1f°C of the %.1f°C dewpoint at %s",
+			supply, margin, worst.Dewpoint, worst.ID),
+	}, true
+}
+
+func tripInterlock(interlock Interlock) {
+	fmt.Println("[controller] condensation interlock tripped:", interlock.Reason)
+	currentState.Interlock = interlock
+	notify.Notify(notification.Event{
+		Type:     EventCondensation,
+		Key:      interlock.Sensor,
+		Title:    "Condensation interlock tripped",
+		Message:  interlock.Reason + ". Zone circulators are off until the interlock is reset",
+		Tags:     []string{"house_with_garden", "droplet", "warning"},
+		Priority: notification.PriorityUrgent,
+	})
+}
+
+// resetInterlock must be called with the inputMutex held
+func resetInterlock() {
+	if !currentState.Interlock.Tripped {
+		return
+	}
+	fmt.Println("[controller] condensation interlock reset")
+	currentState.Interlock = Interlock{}
+}
+
+func cutZoneCalls(calls map[string]bool) map[string]bool {
+	cut := make(map[string]bool)
+	for zone := range calls {
+		cut[zone] = false
+	}
+	return cut
+}
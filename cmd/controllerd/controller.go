@@ -1,8 +1,6 @@
 package main
 
-import (
-	protocol "burlo/services/protocols"
-)
+import "burlo/pkg/models/controller"
 
 var currentState = CtrlOutput{
 	DX2W:     DX2W{Mode: DX2W_AUTO},
@@ -11,8 +9,13 @@ var currentState = CtrlOutput{
 	ZoneCall: false,
 }
 
-func tryRunController(inputs CtrlInput) {
+// tryRunController runs the controller from the current inputs,
+// must be called with the inputMutex held
+func tryRunController() {
+	checkHealth()
+	expireOverrides()
 	if inputs.Ready != (IndoorReady | CurrentReady | ForecastReady | AQHIReady) {
+		applyOverrides()
 		return
 	}
 	runController(inputs)
@@ -23,51 +26,73 @@ func runController(inputs CtrlInput) {
 
 	mode, state := selectDX2WMode(inputs, output)
 
-	if inputs.ModeOverride != DX2W_AUTO {
-		output.DX2W.Mode = inputs.ModeOverride
-	} else {
+	// hold the current mode and state without fresh data
+	hold := inputs.Stale&(IndoorReady|CurrentReady|ForecastReady) != 0
+
+	if override, ok := inputs.override(controller.OverrideMode); ok {
+		output.DX2W.Mode = dx2wmode(override)
+	} else if !hold {
 		output.DX2W.setMode(mode)
 	}
 
-	if inputs.StateOverride != DX2W_STATE_AUTO {
-		output.DX2W.State = inputs.StateOverride
-	} else {
+	if override, ok := inputs.override(controller.OverrideState); ok {
+		output.DX2W.State = dx2wstate(override)
+	} else if !hold {
 		output.DX2W.setState(state)
 	}
 
 	// order is important here, we need the dewpoint decide on
 	// ventilation, and ventilation to
 	output.Dewpoint = inputs.Indoor.Dewpoint
+	if inputs.Stale&DewpointStale != 0 {
+		output.Dewpoint = max(output.Dewpoint, inputs.StaleDewpoint) + dewpointMargin()
+	}
+
+	ventilation := adviseVentilation(inputs, output, now())
+	if inputs.Stale != 0 {
+		ventilation.Window = CLOSE
+		ventilation.Favourable = false
+		ventilation.Reasons = []string{"stale inputs, see the input health"}
+	}
+	if override, ok := inputs.Overrides[controller.OverrideWindow]; ok {
+		ventilation.Window = wmode(override.Value)
+		ventilation.Reasons = []string{"manual override: " + override.Reason}
+	}
+	if ventilation.Window != output.Window {
+		ventilation.Since = now()
+		output.Window = ventilation.Window
+		notifyWindow(ventilation)
+	}
+	output.Ventilation = ventilation
+	output.Windows = updateWindows(inputs, output, now())
 
-	window := selectWindowMode(inputs, output)
-	if window != output.Window {
-		output.Window = window
-		notifyWindow(window)
+	output.ZoneCalls = updateZoneCalls(inputs, output)
+	output.DHW = updateDHW(inputs, output)
+	if output.DHW.Priority {
+		output.ZoneCalls = limitZoneCalls(inputs, output.ZoneCalls)
 	}
+	output.ZoneCalls = applyZoneCallOverrides(inputs, output.ZoneCalls)
+	// the interlock protects against condensation, even when overridden
+	if output.DX2W.Mode == DX2W_COOL && output.Interlock.Tripped {
+		output.ZoneCalls = cutZoneCalls(output.ZoneCalls)
+	}
+	output.ZoneCall = anyZoneCall(output.ZoneCalls)
+	output.SupplyTarget = selectSupplyTarget(inputs, output)
 
-	output.ZoneCall = updateZoneCalls(inputs, output)
+	dutyTracker.sample(inputs, output)
+	evaluateCurve()
 
 	// apply new state
-	set_digital_out(protocol.PhidgetDO{
-		Name:    "CoolingMode",
-		HubPort: 0,
-		Channel: 1,
-		Output:  output.DX2W.Mode == DX2W_COOL,
-	})
-	set_digital_out(protocol.PhidgetDO{
-		Name:    "ZoneCirculator",
-		HubPort: 0,
-		Channel: 0,
-		Output:  output.ZoneCall,
-	})
-	set_voltage_out(protocol.PhidgetVO{
-		Name:    "Dewpoint",
-		HubPort: 1,
-		Channel: 0,
-		Output:  dewpointToVoltage(output.Dewpoint),
-	})
-	// TODO: use modbus to set dx2w state (on/off)
+	setOutputBool(OutHpMode, output.DX2W.Mode == DX2W_COOL)
+	setZoneOutputs(output.ZoneCalls)
+	setWindowOutputs(output.Windows)
+	setOutputBool(dhwOutput(), output.DHW.Priority)
+	setOutput(OutDewpoint, dewpointToVoltage(output.Dewpoint))
+	set_dx2w_state(output.DX2W.State)
+	set_supply_target(output.SupplyTarget)
 	currentState = output
+	publishStatus(output)
+	saveState(inputs, output)
 }
 
 func selectDX2WMode(inputs CtrlInput, current CtrlOutput) (dx2wmode, dx2wstate) {
@@ -114,83 +139,21 @@ func selectDX2WMode(inputs CtrlInput, current CtrlOutput) (dx2wmode, dx2wstate)
 	}
 }
 
-func selectWindowMode(inputs CtrlInput, current CtrlOutput) wmode {
-	// keep windows closed if air quality health risk is Moderate to high
-	// Risk: Low (1-3)	Moderate (4-6)	High (7-10)	Very high (above 10)
-	// TODO: make configurable
-	if inputs.Outdoor.AQHI > 5 {
-		return CLOSE
-	}
-	switch current.DX2W.Mode {
-	case DX2W_HEAT:
-		if inputs.Outdoor.Temperature < (16+20)/2 {
-			return CLOSE
-		}
-		// edge case: it can get hot and humid out before the system switches
-		// over to COOL mode, should keep windows closed then too
-		if inputs.Outdoor.Temperature > 24 && inputs.Outdoor.Dewpoint > 16 {
-			return CLOSE
-		}
-		return OPEN
-
-	case DX2W_COOL:
-		dT := inputs.Outdoor.Temperature - inputs.Indoor.Temperature
-		coolSetpoint := inputs.Indoor.Temperature - inputs.Indoor.CoolSetpointErr
-		heatSetpoint := inputs.Indoor.Temperature - inputs.Indoor.HeatSetpointErr
-
-		midpoint := (coolSetpoint + heatSetpoint) / 2
-		lowpoint := heatSetpoint + min(0, heatSetpoint-inputs.Indoor.Temperature) - 1
-
-		outdoorTempLow := inputs.Outdoor.Temperature < lowpoint
-		outdoorTempHigh := inputs.Outdoor.Temperature > coolSetpoint
-
-		// important to take dewpoint into account in cooling mode,
-		// it can get very humid out during the summer
-		dewpointLow := inputs.Outdoor.Dewpoint <= 12 || inputs.Outdoor.Dewpoint <= inputs.Indoor.Dewpoint
-		dewpointOk := inputs.Outdoor.Dewpoint < 16 && inputs.Outdoor.Dewpoint < inputs.Indoor.Dewpoint+1
-		dewpointCheck := dewpointLow || (dewpointOk && dT < -4)
-
-		// keep windows closed if dewpoint is too high
-		if !dewpointCheck {
-			return CLOSE
-		}
-
-		// keep windows closed if outdoor temp is too high
-		if outdoorTempHigh && dT > -2 {
-			return CLOSE
-		}
-
-		// keep windows closed if outdoor temp is too low
-		if outdoorTempLow {
-			return CLOSE
-		}
-
-		// open windows to help cool
-		if dT < 0 && inputs.Indoor.Temperature >= midpoint {
-			return OPEN
-		}
-
-		// open the windows because its nice out
-		return OPEN
-
-	default:
-		return CLOSE
-	}
-}
-
-func updateZoneCalls(inputs CtrlInput, current CtrlOutput) bool {
-	if current.Window == OPEN || current.DX2W.State == DX2W_OFF {
+// zoneCall decides if a zone with the given indoor conditions
+// calls for heating or cooling
+func zoneCall(inputs CtrlInput, indoor IndoorInput, current CtrlOutput) bool {
+	if current.Window == OPEN || current.Windows.Open || current.DX2W.State == DX2W_OFF {
 		return false
 	}
 	switch current.DX2W.Mode {
 	case DX2W_HEAT:
-		condA := RoomTooCold(inputs.Indoor.HeatSetpointErr) && inputs.Outdoor.Temperature < 20
-		condB := !RoomTooHot(inputs.Indoor.HeatSetpointErr) && inputs.Outdoor.Temperature < 16
+		condA := RoomTooCold(indoor.HeatSetpointErr) && inputs.Outdoor.Temperature < 20
+		condB := !RoomTooHot(indoor.HeatSetpointErr) && inputs.Outdoor.Temperature < 16
 		return condA || condB
 
 	case DX2W_COOL:
-		condA := RoomTooHot(inputs.Indoor.CoolSetpointErr) && inputs.Outdoor.Temperature > 16
-		condB := !RoomTooCold(inputs.Indoor.CoolSetpointErr) && inputs.Outdoor.Temperature > 20
+		condA := RoomTooHot(indoor.CoolSetpointErr) && inputs.Outdoor.Temperature > 16
+		condB := !RoomTooCold(indoor.CoolSetpointErr) && inputs.Outdoor.Temperature > 20
 		return condA || condB
 
 	default:
@@ -0,0 +1,950 @@
+package main
+
+import (
+	"burlo/config"
+	"burlo/pkg/dx2w"
+	"burlo/pkg/models/controller"
+	"burlo/pkg/models/weather"
+	"burlo/pkg/psychro"
+	"burlo/pkg/weathergcca"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+func testInputs(outdoor, mean, high, low, indoor float32) CtrlInput {
+	var in CtrlInput
+	in.Ready = IndoorReady | CurrentReady | ForecastReady | AQHIReady
+	in.Outdoor.Temperature = outdoor
+	in.Outdoor.Dewpoint = outdoor - 10
+	in.Outdoor.Humidity = psychro.RelativeHumidity(outdoor, in.Outdoor.Dewpoint)
+	in.Outdoor.T24hMean = mean
+	in.Outdoor.T24hHigh = high
+	in.Outdoor.T24hLow = low
+	in.Outdoor.AQHI = 3
+	in.Indoor.Temperature = indoor
+	in.Indoor.Dewpoint = 10
+	in.Indoor.HeatSetpointErr = indoor - 20
+	in.Indoor.CoolSetpointErr = indoor - 24
+	return in
+}
+
+func TestSelectDX2WMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		inputs  CtrlInput
+		current dx2wmode
+		mode    dx2wmode
+		state   dx2wstate
+	}{
+		{"cold out, initial", testInputs(-10, -8, -4, -12, 21), DX2W_AUTO, DX2W_HEAT, DX2W_ON},
+		{"hot out, initial", testInputs(30, 25, 31, 19, 23), DX2W_AUTO, DX2W_COOL, DX2W_ON},
+		{"cold out, still cooling, warm inside", testInputs(5, 10, 14, 4, 23), DX2W_COOL, DX2W_COOL, DX2W_OFF},
+		{"cold out, still cooling, cool inside", testInputs(5, 10, 14, 4, 21), DX2W_COOL, DX2W_HEAT, DX2W_ON},
+		{"hot out, still heating, cool inside", testInputs(28, 22, 29, 17, 21), DX2W_HEAT, DX2W_HEAT, DX2W_OFF},
+		{"mild out, keeps mode", testInputs(18, 17, 22, 12, 22), DX2W_HEAT, DX2W_HEAT, DX2W_ON},
+	}
+	for _, tc := range tests {
+		mode, state := selectDX2WMode(tc.inputs, CtrlOutput{DX2W: DX2W{Mode: tc.current}})
+		if mode != tc.mode || state != tc.state {
+			t.Errorf("%s: expected %s/%s, got %s/%s", tc.name, tc.mode, tc.state, mode, state)
+		}
+	}
+}
+
+func TestDX2WSetModeDebounce(t *testing.T) {
+	simTime := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return simTime }
+	defer func() { now = time.Now }()
+
+	dx2w := DX2W{Mode: DX2W_HEAT}
+	dx2w.setMode(DX2W_COOL)
+	if dx2w.Mode != DX2W_COOL {
+		t.Fatalf("expected first mode change to apply, got %s", dx2w.Mode)
+	}
+
+	simTime = simTime.Add(23 * time.Hour)
+	dx2w.setMode(DX2W_HEAT)
+	if dx2w.Mode != DX2W_COOL {
+		t.Errorf("expected mode change within 24h to be ignored, got %s", dx2w.Mode)
+	}
+
+	simTime = simTime.Add(2 * time.Hour)
+	dx2w.setMode(DX2W_HEAT)
+	if dx2w.Mode != DX2W_HEAT {
+		t.Errorf("expected mode change after 24h to apply, got %s", dx2w.Mode)
+	}
+}
+
+func TestAdviseVentilation(t *testing.T) {
+	clock := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	heating := CtrlOutput{DX2W: DX2W{Mode: DX2W_HEAT}, Window: CLOSE}
+	cooling := CtrlOutput{DX2W: DX2W{Mode: DX2W_COOL}, Window: CLOSE}
+	advise := func(in CtrlInput, current CtrlOutput) wmode {
+		return adviseVentilation(in, current, clock).Window
+	}
+
+	if w := advise(testInputs(-5, -5, 0, -10, 21), heating); w != CLOSE {
+		t.Errorf("cold out: expected CLOSE, got %s", w)
+	}
+	if w := advise(testInputs(20, 18, 22, 14, 21), heating); w != OPEN {
+		t.Errorf("mild out while heating: expected OPEN, got %s", w)
+	}
+	if w := advise(testInputs(20, 22, 26, 18, 24), cooling); w != OPEN {
+		t.Errorf("cooler and drier out: expected OPEN, got %s", w)
+	}
+	hot := testInputs(32, 26, 33, 21, 24)
+	hot.Outdoor.Dewpoint = 22
+	if w := advise(hot, cooling); w != CLOSE {
+		t.Errorf("hot and humid out: expected CLOSE, got %s", w)
+	}
+	// cooler, but so humid the outdoor air carries more heat
+	muggy := testInputs(22, 22, 26, 18, 24)
+	muggy.Outdoor.Humidity = 90
+	muggy.Outdoor.Dewpoint = 15.9
+	if w := advise(muggy, cooling); w != CLOSE {
+		t.Errorf("muggy out: expected CLOSE, got %s", w)
+	}
+	smoky := testInputs(20, 18, 22, 14, 21)
+	smoky.Outdoor.AQHI = 7
+	if w := advise(smoky, heating); w != CLOSE {
+		t.Errorf("poor air quality: expected CLOSE, got %s", w)
+	}
+
+	// looks ahead in the forecast
+	mild := testInputs(20, 18, 22, 14, 21)
+	mild.Outdoor.ForecastTime = clock
+	mild.Outdoor.Forecast = weather.Forecast{
+		Temperature:       []float32{12, 10, 10},
+		RelHumidity:       []float32{50, 50, 50},
+		ProbPrecipitation: []float32{0, 0, 0},
+	}
+	if advice := adviseVentilation(mild, heating, clock); advice.Window != CLOSE || advice.FavourableHours != 1 {
+		t.Errorf("turning cold: expected CLOSE after 1h, got %s after %dh", advice.Window, advice.FavourableHours)
+	}
+	mild.Outdoor.Forecast.Temperature = []float32{20, 21, 22}
+	mild.Outdoor.Forecast.ProbPrecipitation = []float32{10, 80, 0}
+	if advice := adviseVentilation(mild, heating, clock); advice.Window != CLOSE || len(advice.Reasons) == 0 {
+		t.Errorf("rain coming: expected CLOSE with a reason, got %s %v", advice.Window, advice.Reasons)
+	}
+	// the forecast is 2h old, so the rain has passed
+	mild.Outdoor.ForecastTime = clock.Add(-2 * time.Hour)
+	if w := advise(mild, heating); w != OPEN {
+		t.Errorf("rain passed: expected OPEN, got %s", w)
+	}
+
+	// hysteresis keeps open windows open
+	cloudy := testInputs(17.5, 18, 22, 14, 21)
+	cloudy.Outdoor.CloudCover = 90
+	if w := advise(cloudy, heating); w != CLOSE {
+		t.Errorf("cool and cloudy: expected CLOSE, got %s", w)
+	}
+	open := heating
+	open.Window = OPEN
+	if w := advise(cloudy, open); w != OPEN {
+		t.Errorf("cool and cloudy, already open: expected OPEN, got %s", w)
+	}
+
+	// and changes are rate limited
+	open.Ventilation.Since = clock.Add(-10 * time.Minute)
+	if w := advise(testInputs(10, 18, 22, 14, 21), open); w != OPEN {
+		t.Errorf("just opened: expected to hold OPEN, got %s", w)
+	}
+	if w := advise(smoky, open); w != CLOSE {
+		t.Errorf("lockouts close right away: expected CLOSE, got %s", w)
+	}
+}
+
+// 0 is a valid value for some options, they are only defaulted when unset
+func TestVentilationConfig(t *testing.T) {
+	defer func(cfg config.Controller) { ctrlConfig = cfg }(ctrlConfig)
+	var conf config.ServiceConf
+	err := toml.Unmarshal([]byte(`
+[controller.ventilation]
+hysteresis = 0
+sunny_allowance = 0
+min_outdoor = -5
+min_interval = 0
+`), &conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctrlConfig = conf.Controller
+	cfg := ventilationConfig()
+	if *cfg.Hysteresis != 0 || *cfg.SunnyAllowance != 0 || *cfg.MinOutdoor != -5 || *cfg.MinInterval != 0 {
+		t.Errorf("expected the configured zeros to stay, got %+v", cfg)
+	}
+	if *cfg.MaxDewpoint != 16 || *cfg.EnthalpyMargin != 2 || cfg.MinHours != 2 {
+		t.Errorf("expected the defaults for the others, got %+v", cfg)
+	}
+}
+
+func TestZoneCall(t *testing.T) {
+	heating := CtrlOutput{DX2W: DX2W{Mode: DX2W_HEAT, State: DX2W_ON}, Window: CLOSE}
+	call := func(in CtrlInput, current CtrlOutput) bool {
+		return zoneCall(in, in.Indoor, current)
+	}
+
+	if !call(testInputs(-10, -8, -4, -12, 19), heating) {
+		t.Error("expected zone call when room is too cold")
+	}
+	if call(testInputs(-10, -8, -4, -12, 21), heating) {
+		t.Error("expected no zone call when room is too hot")
+	}
+
+	windowOpen := heating
+	windowOpen.Window = OPEN
+	if call(testInputs(-10, -8, -4, -12, 19), windowOpen) {
+		t.Error("expected no zone call with windows open")
+	}
+
+	standby := heating
+	standby.DX2W.State = DX2W_OFF
+	if call(testInputs(-10, -8, -4, -12, 19), standby) {
+		t.Error("expected no zone call in standby")
+	}
+}
+
+func TestZoneInputs(t *testing.T) {
+	initSimulation(config.ServiceConf{Controller: config.Controller{
+		Zones: []config.Zone{
+			{Name: "upstairs", Output: "circulator_up", Thermostats: []string{"bed"}, Humidistats: []string{"bath"}},
+			{Name: "main", Output: "circulator", HeatSetpoint: 21},
+		},
+	}})
+	defer initSimulation(config.ServiceConf{})
+
+	thermostats["bed"] = controller.Thermostat{ID: "bed", Temperature: 21, Dewpoint: 8, HeatSetpoint: 20, CoolSetpoint: 24}
+	thermostats["living"] = controller.Thermostat{ID: "living", Temperature: 20, Dewpoint: 9, HeatSetpoint: 20, CoolSetpoint: 24}
+	humidistats["bath"] = controller.Thermostat{ID: "bath", Dewpoint: 14, DewpointOnly: true}
+
+	in := testInputs(-10, -8, -4, -12, 0)
+	updateIndoorInputs(&in)
+
+	if in.Indoor.Dewpoint != 14 || in.Indoor.Temperature != 20.5 {
+		t.Errorf("unexpected house inputs: %+v", in.Indoor)
+	}
+	if up := in.Zones["upstairs"]; up.Dewpoint != 14 || up.HeatSetpointErr != 1 {
+		t.Errorf("unexpected upstairs inputs: %+v", up)
+	}
+	if main := in.Zones["main"]; main.Dewpoint != 9 || main.HeatSetpointErr != -1 {
+		t.Errorf("unexpected main inputs: %+v", main)
+	}
+
+	heating := CtrlOutput{DX2W: DX2W{Mode: DX2W_HEAT, State: DX2W_ON}, Window: CLOSE}
+	calls := updateZoneCalls(in, heating)
+	if !calls["main"] || calls["upstairs"] {
+		t.Errorf("expected only main to call: %v", calls)
+	}
+}
+
+func TestSimulateSynthetic(t *testing.T) {
+	defer func() { now = time.Now }()
+
+	timeline := filepath.Join(t.TempDir(), "timeline.csv")
+	err := simulate(SimOpts{
+		SyntheticDays:  14,
+		SyntheticStart: "2024-01-08",
+		TimelinePath:   timeline,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(timeline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(rows) < 10 {
+		t.Fatalf("expected a timeline, got %d rows", len(rows))
+	}
+	for _, row := range rows[1:] {
+		if strings.Contains(row, ",COOL,") {
+			t.Fatalf("unexpected cooling in january: %s", row)
+		}
+	}
+	if !strings.Contains(string(data), ",HEAT,ON,CLOSE,true,") {
+		t.Error("expected zone calls for heat in january")
+	}
+}
+
+func TestHeatingCurve(t *testing.T) {
+	defer func(cfg config.Controller) { ctrlConfig = cfg }(ctrlConfig)
+	ctrlConfig.Heating = config.Heating{
+		OutdoorReset:                    true,
+		MaxSupplyTemperature:            40,
+		DesignLoadOutdoorAirTemperature: -25,
+		DesignLoadSupplyTemperature:     45,
+		ZeroLoadOutdoorAirTemperature:   15,
+		ZeroLoadSupplyTemperature:       20,
+	}
+	tests := []struct{ outdoor, supply float32 }{
+		{15, 20},   // zero load
+		{20, 20},   // warmer than zero load, no lower
+		{-5, 32.5}, // halfway
+		{-25, 40},  // design load, clamped to max
+		{-35, 40},
+	}
+	for _, tc := range tests {
+		if supply := heatingCurve(tc.outdoor); supply != tc.supply {
+			t.Errorf("outdoor %v: expected supply %v, got %v", tc.outdoor, tc.supply, supply)
+		}
+	}
+
+	cooling := CtrlOutput{DX2W: DX2W{Mode: DX2W_COOL}}
+	if target := selectSupplyTarget(testInputs(-5, 0, 0, 0, 21), cooling); target != 0 {
+		t.Errorf("expected no supply target while cooling, got %v", target)
+	}
+}
+
+func TestCurveRecommendation(t *testing.T) {
+	defer func(cfg config.Controller) { ctrlConfig = cfg }(ctrlConfig)
+	defer func() { now = time.Now; dutyTracker = DutyCycleTracker{} }()
+
+	ctrlConfig.Heating = config.Heating{
+		OutdoorReset:                    true,
+		MaxSupplyTemperature:            45,
+		DesignLoadOutdoorAirTemperature: -25,
+		DesignLoadSupplyTemperature:     40,
+		ZeroLoadOutdoorAirTemperature:   15,
+		ZeroLoadSupplyTemperature:       20,
+		Tuning: config.CurveTuning{
+			Enabled:              true,
+			TargetDutyCycle:      0.8,
+			HistoryDays:          14,
+			MinHours:             6,
+			MinSupplyTemperature: 20,
+		},
+	}
+	simTime := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return simTime }
+
+	// zone calls 40% of the time at -5 and 5 degC outdoor,
+	// half the target, so the curve should come down
+	output := CtrlOutput{DX2W: DX2W{Mode: DX2W_HEAT, State: DX2W_ON}, Window: CLOSE}
+	for _, outdoor := range []float32{-5, 5} {
+		in := testInputs(outdoor, outdoor, outdoor, outdoor, 20)
+		output.SupplyTarget = heatingCurve(outdoor)
+		for i := 0; i < 12*10; i++ {
+			output.ZoneCall = i%5 < 2
+			dutyTracker.sample(in, output)
+			simTime = simTime.Add(5 * time.Minute)
+		}
+	}
+
+	rec := dutyTracker.recommend()
+	if len(rec.Bins) != 2 {
+		t.Fatalf("expected 2 bins, got %+v", rec.Bins)
+	}
+	for _, bin := range rec.Bins {
+		if bin.DutyCycle < 0.39 || bin.DutyCycle > 0.41 {
+			t.Errorf("expected 40%% duty cycle, got %v", bin.DutyCycle)
+		}
+	}
+	if !rec.significant() || rec.Recommended.DesignLoadSupply >= rec.Current.DesignLoadSupply {
+		t.Errorf("expected a lower curve, got %s", rec)
+	}
+	if rec.Recommended.ZeroLoadSupply < 20 {
+		t.Errorf("expected zero load supply limited to the minimum, got %s", rec)
+	}
+}
+
+func TestDHWPriority(t *testing.T) {
+	cfg := config.ServiceConf{}
+	cfg.Controller.DHW = config.DHW{
+		Enabled:         true,
+		Setpoint:        50,
+		Differential:    5,
+		MaxPriorityTime: 60,
+		ZoneCalls:       "limit",
+		Schedule:        []string{"22:00-08:00"},
+	}
+	initSimulation(cfg)
+	defer initSimulation(config.ServiceConf{})
+
+	clock := time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	heating := CtrlOutput{DX2W: DX2W{Mode: DX2W_HEAT, State: DX2W_ON}, Window: CLOSE}
+	in := testInputs(-10, -8, -4, -12, 19.8)
+	in.Zones = map[string]IndoorInput{"main": in.Indoor}
+	in.DHW.Time = clock
+	in.DHW.Temperature = 46
+
+	heating.DHW = updateDHW(in, heating)
+	if heating.DHW.Priority {
+		t.Fatal("expected no priority within the differential")
+	}
+	in.DHW.Temperature = 44
+	heating.DHW = updateDHW(in, heating)
+	if !heating.DHW.Priority {
+		t.Fatal("expected priority below setpoint - differential")
+	}
+	calls := limitZoneCalls(in, map[string]bool{"main": true})
+	if calls["main"] {
+		t.Error("expected zone call limited while slightly below setpoint")
+	}
+
+	// exceeds the max priority time, locked out for the same time
+	clock = clock.Add(61 * time.Minute)
+	in.DHW.Time = clock
+	heating.DHW = updateDHW(in, heating)
+	if heating.DHW.Priority {
+		t.Fatal("expected priority to end after max priority time")
+	}
+	clock = clock.Add(30 * time.Minute)
+	in.DHW.Time = clock
+	if updateDHW(in, heating).Priority {
+		t.Error("expected priority lockout")
+	}
+
+	// outside of the schedule
+	clock = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	in.DHW.Time = clock
+	heating.DHW = DHWState{}
+	if updateDHW(in, heating).Priority {
+		t.Error("expected no priority outside of the schedule")
+	}
+
+	// no diverting while cooling, it would chill the tank
+	clock = time.Date(2024, 7, 1, 6, 0, 0, 0, time.UTC)
+	in.DHW.Time = clock
+	cooling := CtrlOutput{DX2W: DX2W{Mode: DX2W_COOL, State: DX2W_ON}, Window: CLOSE}
+	if updateDHW(in, cooling).Priority {
+		t.Error("expected no priority in cool mode")
+	}
+	cooling.DHW = DHWState{Priority: true, Since: clock}
+	if updateDHW(in, cooling).Priority {
+		t.Error("expected priority to end when switching to cool mode")
+	}
+}
+
+func TestDHWSchedule(t *testing.T) {
+	at := func(h int) time.Time { return time.Date(2024, 1, 1, h, 0, 0, 0, time.UTC) }
+	schedule := []string{"22:00-08:00", "12:00-13:00"}
+	for h, want := range map[int]bool{23: true, 7: true, 8: false, 12: true, 13: false} {
+		if got := inSchedule(at(h), schedule); got != want {
+			t.Errorf("inSchedule at %02d:00 = %v, want %v", h, got, want)
+		}
+	}
+	if !inSchedule(at(15), nil) {
+		t.Error("expected any time to be in an empty schedule")
+	}
+
+	if err := checkDHWSchedule(config.DHW{Schedule: schedule}); err != nil {
+		t.Error(err)
+	}
+	if err := checkDHWSchedule(config.DHW{Schedule: []string{"22:00-8"}}); err == nil {
+		t.Error("expected an invalid window to be rejected")
+	}
+}
+
+func TestDiversionValve(t *testing.T) {
+	cfg := config.ServiceConf{}
+	cfg.Controller.DHW.Enabled = true
+	initSimulation(cfg)
+	defer initSimulation(config.ServiceConf{})
+
+	clock := time.Date(2024, 1, 15, 6, 0, 0, 0, time.UTC)
+	var found []string
+	for minute := 0; minute < 10; minute++ {
+		s := DiagnosticSample{Time: clock.Add(time.Duration(minute) * time.Minute), Subcooling: 4,
+			DHWPriority: true, HasDiverted: true, Diverted: minute < 2}
+		for _, finding := range diagnose(s) {
+			found = append(found, fmt.Sprintf("%d:%s", minute, finding.Category))
+		}
+	}
+	// the valve stopped following at minute 2, reported after 5 minutes of it
+	if strings.Join(found, ",") != "6:"+DiagDiversion {
+		t.Errorf("expected the diversion valve at minute 6, got %v", found)
+	}
+}
+
+func TestStateRestore(t *testing.T) {
+	cfg := config.ServiceConf{}
+	cfg.Controller.StatePath = filepath.Join(t.TempDir(), "controllerd.json")
+	initSimulation(cfg)
+	defer initSimulation(config.ServiceConf{})
+
+	lastChange := time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC)
+	initStore(cfg)
+	overrides := map[string]controller.Override{
+		controller.OverrideState: {Value: "OFF", Reason: "away", Since: lastChange},
+	}
+	saveState(CtrlInput{Overrides: overrides},
+		CtrlOutput{DX2W: DX2W{Mode: DX2W_HEAT, State: DX2W_ON, LastChange: lastChange}})
+
+	initSimulation(cfg)
+	initStore(cfg)
+	if currentState.DX2W.Mode != DX2W_HEAT || !currentState.DX2W.LastChange.Equal(lastChange) {
+		t.Errorf("DX2W state not restored: %+v", currentState.DX2W)
+	}
+	if state, _ := inputs.override(controller.OverrideState); state != "OFF" {
+		t.Errorf("state override not restored: %v", inputs.Overrides)
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	initSimulation(config.ServiceConf{})
+	defer initSimulation(config.ServiceConf{})
+
+	clock := time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	if err := setOverride("mode", controller.OverrideRequest{Value: "dry"}); err == nil {
+		t.Error("expected invalid override value to fail")
+	}
+	if err := setOverride("state", controller.OverrideRequest{Value: "on", Zone: "main"}); err == nil {
+		t.Error("expected zone to be rejected for a state override")
+	}
+	err := setOverride("zone_call", controller.OverrideRequest{Value: "OFF", Minutes: 30, Reason: "floor refinishing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = setOverride("zone_call", controller.OverrideRequest{Value: "ON", Zone: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := applyZoneCallOverrides(inputs, map[string]bool{"main": false, "other": true})
+	if !calls["main"] || calls["other"] {
+		t.Errorf("expected zone override to win over all zones override: %v", calls)
+	}
+
+	clock = clock.Add(31 * time.Minute)
+	expireOverrides()
+	if _, ok := inputs.override("zone_call"); ok {
+		t.Error("expected zone_call override to expire")
+	}
+	if _, ok := inputs.override("zone_call/main"); !ok {
+		t.Error("expected override without expiry to remain")
+	}
+	if err := setOverride("zone_call", controller.OverrideRequest{Value: "AUTO", Zone: "main"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs.Overrides) != 0 {
+		t.Errorf("expected no overrides, got %v", inputs.Overrides)
+	}
+}
+
+// overrides are applied before every input has arrived
+func TestOverridesIncompleteInputs(t *testing.T) {
+	fakes := initSimulation(config.ServiceConf{})
+	defer initSimulation(config.ServiceConf{})
+
+	inputMutex.Lock()
+	defer inputMutex.Unlock()
+	currentState.DX2W = DX2W{Mode: DX2W_HEAT, State: DX2W_ON}
+	currentState.ZoneCalls = map[string]bool{defaultZone: true}
+	setZoneOutputs(currentState.ZoneCalls)
+
+	if err := setOverride("zone_call", controller.OverrideRequest{Value: "OFF"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := setOverride("state", controller.OverrideRequest{Value: "OFF"}); err != nil {
+		t.Fatal(err)
+	}
+	tryRunController()
+	if fakes[OutCirculator].On() || currentState.ZoneCall || currentState.DX2W.State != DX2W_OFF {
+		t.Errorf("expected the overrides to turn everything off, got %+v, circulator %s",
+			currentState.DX2W, fakes[OutCirculator])
+	}
+}
+
+func TestInputHealth(t *testing.T) {
+	initSimulation(config.ServiceConf{})
+	defer initSimulation(config.ServiceConf{})
+
+	clock := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	send := func(topic string, data any) {
+		payload, _ := json.Marshal(data)
+		onMessage(topic, payload)
+	}
+	send("controller/thermostats/01", controller.Thermostat{ID: "01", Time: clock, Temperature: 25, Dewpoint: 14, HeatSetpoint: 20, CoolSetpoint: 24})
+	send("controller/humidistat/02", controller.Thermostat{ID: "02", Time: clock, Dewpoint: 16, DewpointOnly: true})
+	send("weather/forecast", weather.Forecast{Temperature: []float32{28, 30, 22}})
+	send("weather/aqhi", weathergcca.AqhiForecast{AQHI: []int{3}, Time: []time.Time{clock}})
+	send("weather/current", weather.Current{Temperature: 30, RelHumidity: 50})
+
+	if inputs.Stale != 0 || currentState.Dewpoint != 16 {
+		t.Fatalf("expected fresh inputs, got stale %b dewpoint %.1f", inputs.Stale, currentState.Dewpoint)
+	}
+	mode := currentState.DX2W.Mode
+
+	// the weather service stops, the humidistat battery dies
+	clock = clock.Add(2 * time.Hour)
+	send("controller/thermostats/01", controller.Thermostat{ID: "01", Time: clock, Temperature: 25, Dewpoint: 14, HeatSetpoint: 20, CoolSetpoint: 24})
+	if inputs.Stale != CurrentReady || currentState.Window != CLOSE || currentState.DX2W.Mode != mode {
+		t.Errorf("expected stale current weather to hold mode, got stale %b %+v", inputs.Stale, currentState)
+	}
+
+	clock = clock.Add(5 * time.Hour)
+	send("controller/thermostats/01", controller.Thermostat{ID: "01", Time: clock, Temperature: 25, Dewpoint: 14, HeatSetpoint: 20, CoolSetpoint: 24})
+	if inputs.Stale&DewpointStale == 0 || len(humidistats) != 0 {
+		t.Fatalf("expected stale humidistat, got stale %b", inputs.Stale)
+	}
+	if currentState.Dewpoint != 18 {
+		t.Errorf("expected last known dewpoint plus margin, got %.1f", currentState.Dewpoint)
+	}
+	if currentState.DX2W.Mode == DX2W_COOL && currentState.ZoneCall {
+		t.Error("expected no cooling calls with a stale dewpoint sensor")
+	}
+
+	// forgotten after a day
+	clock = clock.Add(24 * time.Hour)
+	inputMutex.Lock()
+	checkHealth()
+	inputMutex.Unlock()
+	if _, ok := health["humidistat/02"]; ok {
+		t.Error("expected stale humidistat to be forgotten")
+	}
+}
+
+func TestCondensationInterlock(t *testing.T) {
+	initSimulation(config.ServiceConf{})
+	defer initSimulation(config.ServiceConf{})
+
+	clock := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	reading := func(f float32) dx2w.Value {
+		return dx2w.Value{Float32: f, Type: dx2w.INT16, Units: "°F", Timestamp: clock}
+	}
+	readings := map[string]dx2w.Value{
+		"MIX_WATER_TEMP":        reading(64.4), // 18°C
+		"HP_EXITING_WATER_TEMP": reading(62.6), // 17°C
+		"CONDENSATE_WARNING":    {Type: dx2w.BOOL, Timestamp: clock},
+	}
+	thermostats["01"] = controller.Thermostat{ID: "01", Dewpoint: 13}
+	humidistats["floor"] = controller.Thermostat{ID: "floor", Dewpoint: 14, DewpointOnly: true}
+
+	if _, tripped := checkCondensation(readings, clock); tripped {
+		t.Error("expected no trip with 3°C margin")
+	}
+
+	humidistats["floor"] = controller.Thermostat{ID: "floor", Dewpoint: 15.5, DewpointOnly: true}
+	interlock, tripped := checkCondensation(readings, clock)
+	if !tripped || interlock.Sensor != "floor" {
+		t.Errorf("expected floor sensor to trip the interlock, got %+v", interlock)
+	}
+	if _, tripped := checkCondensation(readings, clock.Add(10*time.Minute)); tripped {
+		t.Error("expected old readings to be ignored")
+	}
+
+	humidistats["floor"] = controller.Thermostat{ID: "floor", Dewpoint: 10, DewpointOnly: true}
+	readings["CONDENSATE_WARNING"] = dx2w.Value{Bool: true, Type: dx2w.BOOL, Timestamp: clock}
+	interlock, tripped = checkCondensation(readings, clock)
+	if !tripped || interlock.Sensor != "CONDENSATE_WARNING" {
+		t.Errorf("expected condensate warning to trip the interlock, got %+v", interlock)
+	}
+}
+
+// the interlock reads the registers that dx2wlogger caches
+func TestCondensationInterlockHTTP(t *testing.T) {
+	initSimulation(config.ServiceConf{})
+	defer initSimulation(config.ServiceConf{})
+
+	clock := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]dx2w.Value{
+			"CONDENSATE_WARNING": {Bool: true, Type: dx2w.BOOL, Timestamp: clock},
+		})
+	}))
+	defer server.Close()
+	dx2w_client = dx2w.NewHTTPClient(strings.TrimPrefix(server.URL, "http://"))
+	defer func() { dx2w_client = nil }()
+
+	currentState.DX2W.Mode = DX2W_COOL
+	run_interlock_check()
+	if !currentState.Interlock.Tripped || currentState.Interlock.Sensor != "CONDENSATE_WARNING" {
+		t.Errorf("expected condensate warning to trip the interlock, got %+v", currentState.Interlock)
+	}
+}
+
+func TestWindowOutputs(t *testing.T) {
+	defer func(cfg config.Controller) { ctrlConfig = cfg }(ctrlConfig)
+	ctrlConfig.Windows = config.Windows{
+		Openers:  []string{"opener"},
+		Fans:     []string{"fan"},
+		ERV:      []string{"erv"},
+		Contacts: []string{"zigbee2mqtt/window"},
+	}
+	clock := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	var in CtrlInput
+	in.Contacts = map[string]bool{"zigbee2mqtt/window": false}
+	current := CtrlOutput{Ventilation: Ventilation{Window: OPEN, Favourable: true}}
+
+	step := func(minutes int) WindowState {
+		current.Windows = updateWindows(in, current, clock.Add(time.Duration(minutes)*time.Minute))
+		return current.Windows
+	}
+	if w := step(0); !w.Openers.On || w.Fans.On || !w.ERV.On {
+		t.Fatalf("expected openers and ERV on, fans waiting for the windows, got %+v", w)
+	}
+	in.Contacts = map[string]bool{"zigbee2mqtt/window": true}
+	if w := step(1); !w.Open || !w.Fans.On {
+		t.Fatalf("expected the fans on once the window is open, got %+v", w)
+	}
+	// closed by hand, the openers are left alone
+	in.Contacts = map[string]bool{"zigbee2mqtt/window": false}
+	if w := step(30); !w.Openers.On || w.Fans.On || w.ManualUntil.IsZero() {
+		t.Fatalf("expected a manual hold and the fans off, got %+v", w)
+	}
+	current.Ventilation = Ventilation{Window: CLOSE, Favourable: true}
+	if w := step(40); !w.Openers.On {
+		t.Errorf("expected the openers held while manual, got %+v", w)
+	}
+	// rain closes the windows right away, the ERV keeps going
+	current.Ventilation = Ventilation{Window: CLOSE, Favourable: true, WeatherLockout: true}
+	if w := step(41); w.Openers.On || !w.ERV.On {
+		t.Errorf("expected rain to close the windows and keep the ERV on, got %+v", w)
+	}
+	current.Ventilation = Ventilation{Window: CLOSE, Favourable: true, AirQualityLockout: true}
+	if w := step(42); w.ERV.On {
+		t.Errorf("expected poor air quality to stop the ERV, got %+v", w)
+	}
+
+	// an open window pauses the zone calls
+	in.Contacts = map[string]bool{"zigbee2mqtt/window": true}
+	heating := CtrlOutput{DX2W: DX2W{Mode: DX2W_HEAT, State: DX2W_ON}, Window: CLOSE}
+	heating.Windows = updateWindows(in, heating, clock)
+	cold := testInputs(-5, -5, 0, -10, 18)
+	if zoneCall(cold, cold.Indoor, heating) {
+		t.Error("expected no zone call with a window open")
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	initSimulation(config.ServiceConf{})
+	defer initSimulation(config.ServiceConf{})
+
+	clock := time.Date(2024, 1, 15, 6, 0, 0, 0, time.UTC)
+	categories := func(findings []Finding) string {
+		var names []string
+		for _, finding := range findings {
+			names = append(names, finding.Category)
+		}
+		return strings.Join(names, ",")
+	}
+	sample := func(running bool, runtime float32) DiagnosticSample {
+		clock = clock.Add(time.Minute)
+		return DiagnosticSample{Time: clock, Running: running, SessionRuntime: runtime, Subcooling: 4, OutsideT: -2, OutdoorDewpoint: -4,
+			HasSinceDefrost: true, HasStalls: true}
+	}
+
+	// 3 minute runs every 10 minutes, short runs are reported
+	// once an hour, the 4th start in an hour is short cycling
+	diagnose(sample(false, 0))
+	var got []string
+	for cycle := 0; cycle < 4; cycle++ {
+		for minute := 0; minute < 10; minute++ {
+			running := minute < 3
+			s := sample(running, float32(minute+1))
+			if !running {
+				s.SessionRuntime = 0
+			}
+			if found := categories(diagnose(s)); found != "" {
+				got = append(got, found)
+			}
+		}
+	}
+	if strings.Join(got, ";") != DiagShortRun+";"+DiagShortCycling {
+		t.Errorf("expected a short run then short cycling, got %v", got)
+	}
+
+	// a defrost 20 minutes after the previous one at -2°C in humid air
+	s := sample(true, 30)
+	s.SinceDefrost = 20
+	diagnose(s)
+	s = sample(true, 31)
+	s.Defrost = true
+	findings := diagnose(s)
+	if categories(findings) != DiagDefrost || len(findings[0].Window) == 0 {
+		t.Errorf("expected a defrost finding with its samples, got %+v", findings)
+	}
+
+	// stall counter increments
+	s = sample(true, 32)
+	s.Stalls = 1
+	if found := categories(diagnose(s)); found != DiagStall {
+		t.Errorf("expected a stall finding, got %v", found)
+	}
+
+	// low subcooling only once it lasted the whole window
+	for minute := 0; minute < 12; minute++ {
+		s = sample(true, float32(40+minute))
+		s.Stalls = 1
+		s.Subcooling = 0.5
+		found := categories(diagnose(s))
+		if minute < 9 && found != "" || minute == 9 && found != DiagSubcooling {
+			t.Errorf("minute %d: unexpected findings %v", minute, found)
+		}
+	}
+}
+
+// registers missing from a reading are not compared
+func TestDiagnosticsMissingRegisters(t *testing.T) {
+	initSimulation(config.ServiceConf{})
+	defer initSimulation(config.ServiceConf{})
+
+	clock := time.Date(2024, 1, 15, 6, 0, 0, 0, time.UTC)
+	readings := map[string]dx2w.Value{
+		"COMPRESSOR_CALL":            {Bool: true, Type: dx2w.BOOL, Timestamp: clock},
+		"COMPRESSOR_SESSION_RUNTIME": {Float32: 30, Timestamp: clock},
+		"OUTSIDE_AIR_TEMP":           {Float32: 28, Timestamp: clock},
+	}
+	s, ok := diagnosticSample(readings, clock)
+	if !ok || s.HasStalls || s.HasSinceDefrost {
+		t.Fatalf("expected a sample without the stall counter and defrost time, got %+v", s)
+	}
+	diagnose(s)
+
+	clock = clock.Add(15 * time.Second)
+	readings["DEFROST"] = dx2w.Value{Bool: true, Type: dx2w.BOOL, Timestamp: clock}
+	readings["TIME_SINCE_LAST_DEFROST"] = dx2w.Value{Float32: 0, Timestamp: clock}
+	readings["COMP_STALL_OR_DELAY_COUNTER"] = dx2w.Value{Float32: 3, Timestamp: clock}
+	s, _ = diagnosticSample(readings, clock)
+	if findings := diagnose(s); len(findings) != 0 {
+		t.Errorf("expected no findings once the registers are read, got %+v", findings)
+	}
+}
+
+func TestHydronicFaults(t *testing.T) {
+	initSimulation(config.ServiceConf{})
+	defer initSimulation(config.ServiceConf{})
+
+	clock := time.Date(2024, 1, 15, 6, 0, 0, 0, time.UTC)
+	sample := func(deltaT float32) DiagnosticSample {
+		clock = clock.Add(time.Minute)
+		return DiagnosticSample{
+			Time: clock, Running: true, SessionRuntime: 30, Subcooling: 4, OutsideT: -2,
+			DX2WOn: true, ZoneCall: true, Hydronics: true, Circulator: true,
+			DeltaT: deltaT, BufferT: 35, BufferSetpoint: 36,
+		}
+	}
+
+	// no flow: near-zero delta-T for 5 minutes while running
+	for minute := 0; minute <= 5; minute++ {
+		for _, finding := range diagnose(sample(0.2)) {
+			if minute != 5 || finding.Category != DiagNoDeltaT {
+				t.Errorf("minute %d: unexpected finding %+v", minute, finding)
+			}
+			raiseFinding(finding)
+		}
+	}
+	if len(faultLog.Faults) != 1 || len(faultLog.Faults[0].Window) != 5 {
+		t.Fatalf("expected the no delta-T fault with its samples, got %+v", faultLog.Faults)
+	}
+
+	// the circulator stops while the zones call
+	for minute := 1; minute <= 6; minute++ {
+		s := sample(5)
+		s.Circulator = false
+		for _, finding := range diagnose(s) {
+			if minute != 5 || finding.Category != DiagCirculator {
+				t.Errorf("minute %d: unexpected finding %+v", minute, finding)
+			}
+		}
+	}
+
+	// delta-T far from its learned baseline, 3 samples in a row
+	diagnostics = Diagnostics{}
+	var got []string
+	for i := 0; i < baselineWarmup+10; i++ {
+		deltaT := float32(5 + 0.2*float32(i%2))
+		if i >= baselineWarmup+5 {
+			deltaT = 2
+		}
+		for _, finding := range diagnose(sample(deltaT)) {
+			got = append(got, fmt.Sprintf("%d:%s", i-baselineWarmup, finding.Category))
+		}
+	}
+	if strings.Join(got, ",") != "7:"+DiagDeltaTAnomaly {
+		t.Errorf("expected a delta-T anomaly on the third low sample, got %v", got)
+	}
+
+	if !removeFault(faultLog.Faults[0].ID) || len(faultLog.Faults) != 0 {
+		t.Errorf("expected the fault to be removed, got %+v", faultLog.Faults)
+	}
+}
+
+// the buffer target and circulator rules depend on the mode
+func TestHydronicFaultsModes(t *testing.T) {
+	initSimulation(config.ServiceConf{})
+	defer initSimulation(config.ServiceConf{})
+
+	clock := time.Date(2024, 7, 15, 6, 0, 0, 0, time.UTC)
+	sample := func() DiagnosticSample {
+		clock = clock.Add(time.Minute)
+		return DiagnosticSample{
+			Time: clock, Running: true, SessionRuntime: 30, Subcooling: 4, OutsideT: 28,
+			DX2WOn: true, Mode: DX2W_HEAT, Hydronics: true,
+			DeltaT: 5, BufferT: 35, BufferSetpoint: 36,
+		}
+	}
+
+	// DHW priority: the circulator runs without zone calls
+	for minute := 0; minute <= 10; minute++ {
+		s := sample()
+		s.DHWPriority, s.Circulator, s.ZoneCall = true, true, false
+		if findings := diagnose(s); len(findings) != 0 {
+			t.Errorf("minute %d: unexpected findings during DHW priority %+v", minute, findings)
+		}
+	}
+
+	// cooling: the tank is far below the heating setpoint
+	for minute := 0; minute <= 40; minute++ {
+		s := sample()
+		s.Mode, s.BufferT = DX2W_COOL, 12
+		if findings := diagnose(s); len(findings) != 0 {
+			t.Errorf("minute %d: unexpected findings while cooling %+v", minute, findings)
+		}
+	}
+	var found []string
+	for minute := 0; minute <= 40; minute++ {
+		s := sample()
+		s.BufferT = 12
+		for _, finding := range diagnose(s) {
+			found = append(found, finding.Category)
+		}
+	}
+	if strings.Join(found, ",") != DiagBufferDrift {
+		t.Errorf("expected buffer drift while heating, got %v", found)
+	}
+
+	// with outdoor reset the target is the supply target,
+	// not BUFFER_TANK_SETPOINT
+	ctrlConfig.Heating.OutdoorReset = true
+	ctrlConfig.Heating.DesignLoadOutdoorAirTemperature = -25
+	ctrlConfig.Heating.ZeroLoadOutdoorAirTemperature = 15
+	currentState.SupplyTarget = 40
+	readings := map[string]dx2w.Value{
+		"COMPRESSOR_CALL":      {Bool: true, Type: dx2w.BOOL, Timestamp: clock},
+		"BUFFER_TANK_SETPOINT": {Float32: 95, Timestamp: clock},
+	}
+	for _, name := range hydronicRegisters {
+		if _, ok := readings[name]; !ok {
+			readings[name] = dx2w.Value{Float32: 100, Timestamp: clock}
+		}
+	}
+	if s, _ := diagnosticSample(readings, clock); !s.Hydronics || s.BufferSetpoint != 40 {
+		t.Errorf("expected the supply target as the buffer setpoint, got %+v", s)
+	}
+	ctrlConfig.Heating.OutdoorReset = false
+	if s, _ := diagnosticSample(readings, clock); s.BufferSetpoint != 35 {
+		t.Errorf("expected BUFFER_TANK_SETPOINT without outdoor reset, got %v", s.BufferSetpoint)
+	}
+}
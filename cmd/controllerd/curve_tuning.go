@@ -0,0 +1,357 @@
+package main
+
+import (
+	"burlo/pkg/notification"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Very short calls for heat mean the supply temperature is higher than
+// needed, and a lower supply temperature improves the heatpump COP.
+// Zones calling non-stop mean the supply temperature is too low. The
+// tuner measures the fraction of time the zone calls for heat (duty
+// cycle) for each outdoor temperature and fits a curve that would give
+// the target duty cycle, assuming the heat delivered is proportional to
+// duty cycle * (supply temperature - room temperature).
+
+const dutyBinWidth = 2 // degC
+
+// samples further apart than this are treated as a gap in the data
+const maxSampleGap = 30 * time.Minute
+
+type dutyBin struct {
+	Total   time.Duration
+	Calling time.Duration
+	Calls   int
+
+	// time weighted sums, in degC*hours
+	SupplySum float64
+	IndoorSum float64
+}
+
+type dutyDay struct {
+	Date string
+	Bins map[int]*dutyBin
+}
+
+type dutySample struct {
+	time     time.Time
+	outdoor  float32
+	indoor   float32
+	supply   float32
+	calling  bool
+	tracking bool
+}
+
+type DutyCycleTracker struct {
+	Days []*dutyDay
+	last dutySample
+
+	LastEvaluation time.Time
+	Recommendation *CurveRecommendation
+
+	// avoids repeating the same recommendation every day
+	LastNotified CurvePoints
+}
+
+type CurvePoints struct {
+	ZeroLoadSupply   float32
+	DesignLoadSupply float32
+}
+
+type DutyBinReport struct {
+	Outdoor           float32
+	Hours             float32
+	DutyCycle         float32
+	CallsPerHour      float32
+	Supply            float32
+	Indoor            float32
+	RecommendedSupply float32
+}
+
+type CurveRecommendation struct {
+	Time        time.Time
+	Current     CurvePoints
+	Recommended CurvePoints
+	Bins        []DutyBinReport
+	Reasons     []string
+	Applied     bool
+}
+
+var dutyTracker DutyCycleTracker
+
+// sample accounts the time since the previous sample to the
+// previous state, then starts a new sample. Only time spent
+// heating with the outdoor reset in control (no DHW priority
+// or manual overrides) is tracked
+func (d *DutyCycleTracker) sample(inputs CtrlInput, output CtrlOutput) {
+	current := dutySample{
+		time:    now(),
+		outdoor: inputs.Outdoor.Temperature,
+		indoor:  inputs.Indoor.Temperature,
+		supply:  output.SupplyTarget,
+		calling: output.ZoneCall,
+		tracking: output.DX2W.Mode == DX2W_HEAT &&
+			output.DX2W.State == DX2W_ON &&
+			output.Window == CLOSE &&
+			!output.DHW.Priority &&
+			len(inputs.Overrides) == 0 &&
+			output.SupplyTarget > 0,
+	}
+	last := d.last
+	d.last = current
+
+	elapsed := current.time.Sub(last.time)
+	if !last.tracking || elapsed <= 0 || elapsed > maxSampleGap {
+		return
+	}
+
+	bin := d.bin(last.time, last.outdoor)
+	bin.Total += elapsed
+	bin.SupplySum += float64(last.supply) * elapsed.Hours()
+	bin.IndoorSum += float64(last.indoor) * elapsed.Hours()
+	if last.calling {
+		bin.Calling += elapsed
+	}
+	if current.calling && !last.calling {
+		bin.Calls += 1
+	}
+}
+
+func (d *DutyCycleTracker) bin(t time.Time, outdoor float32) *dutyBin {
+	date := t.Format(time.DateOnly)
+	if len(d.Days) == 0 || d.Days[len(d.Days)-1].Date != date {
+		d.Days = append(d.Days, &dutyDay{Date: date, Bins: make(map[int]*dutyBin)})
+
+		// only keep the configured history
+		historyDays := max(1, ctrlConfig.Heating.Tuning.HistoryDays)
+		if len(d.Days) > historyDays {
+			d.Days = d.Days[len(d.Days)-historyDays:]
+		}
+	}
+	day := d.Days[len(d.Days)-1]
+
+	key := int(math.Floor(float64(outdoor) / dutyBinWidth))
+	bin, ok := day.Bins[key]
+	if !ok {
+		bin = &dutyBin{}
+		day.Bins[key] = bin
+	}
+	return bin
+}
+
+// totals combines the daily bins over the whole history
+func (d *DutyCycleTracker) totals() map[int]dutyBin {
+	totals := make(map[int]dutyBin)
+	for _, day := range d.Days {
+		for key, bin := range day.Bins {
+			total := totals[key]
+			total.Total += bin.Total
+			total.Calling += bin.Calling
+			total.Calls += bin.Calls
+			total.SupplySum += bin.SupplySum
+			total.IndoorSum += bin.IndoorSum
+			totals[key] = total
+		}
+	}
+	return totals
+}
+
+func currentCurve() CurvePoints {
+	return CurvePoints{
+		ZeroLoadSupply:   ctrlConfig.Heating.ZeroLoadSupplyTemperature,
+		DesignLoadSupply: ctrlConfig.Heating.DesignLoadSupplyTemperature,
+	}
+}
+
+// recommend fits a curve through the supply temperatures that would
+// have given the target duty cycle in each outdoor temperature bin
+func (d *DutyCycleTracker) recommend() *CurveRecommendation {
+	cfg := ctrlConfig.Heating
+	tuning := cfg.Tuning
+	target := tuning.TargetDutyCycle
+	if target <= 0 || target > 1 {
+		target = 0.8
+	}
+
+	rec := &CurveRecommendation{
+		Time:        now(),
+		Current:     currentCurve(),
+		Recommended: currentCurve(),
+	}
+
+	totals := d.totals()
+	keys := make([]int, 0, len(totals))
+	for key := range totals {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	// weighted least squares fit of recommended supply vs outdoor temp
+	var sw, sx, sy, sxx, sxy float64
+	for _, key := range keys {
+		bin := totals[key]
+		hours := bin.Total.Hours()
+		if hours <= 0 {
+			continue
+		}
+		report := DutyBinReport{
+			Outdoor:      float32(key*dutyBinWidth) + dutyBinWidth/2.0,
+			Hours:        float32(hours),
+			DutyCycle:    float32(bin.Calling.Hours() / hours),
+			CallsPerHour: float32(float64(bin.Calls) / hours),
+			Supply:       float32(bin.SupplySum / hours),
+			Indoor:       float32(bin.IndoorSum / hours),
+		}
+		if hours < float64(tuning.MinHours) || report.Supply <= report.Indoor {
+			rec.Bins = append(rec.Bins, report)
+			continue
+		}
+		// heat delivered ~ duty * (supply - indoor), solve for the
+		// supply that delivers the same heat at the target duty
+		report.RecommendedSupply = report.Indoor +
+			(report.Supply-report.Indoor)*report.DutyCycle/target
+		rec.Bins = append(rec.Bins, report)
+
+		x, y := float64(report.Outdoor), float64(report.RecommendedSupply)
+		sw += hours
+		sx += hours * x
+		sy += hours * y
+		sxx += hours * x * x
+		sxy += hours * x * y
+
+		rec.Reasons = append(rec.Reasons, fmt.Sprintf(
+			"at %.0f°C outdoor the zone called %.0f%% of %.1fh (%.1f calls/h) with %.1f°C supply, %.1f°C would give %.0f%%",
+			report.Outdoor, 100*report.DutyCycle, report.Hours, report.CallsPerHour,
+			report.Supply, report.RecommendedSupply, 100*target))
+	}
+	if sw == 0 {
+		rec.Reasons = append(rec.Reasons, fmt.Sprintf(
+			"not enough data yet, need at least %.0fh of heating in an outdoor temperature bin", tuning.MinHours))
+		return rec
+	}
+
+	denom := sw*sxx - sx*sx
+	if denom/(sw*sw) < 4 {
+		// data only covers a narrow range of outdoor temperatures,
+		// shift the whole curve by the mean correction
+		var shift float64
+		for _, bin := range rec.Bins {
+			if bin.RecommendedSupply != 0 {
+				shift += float64(bin.Hours) * float64(bin.RecommendedSupply-heatingCurve(bin.Outdoor))
+			}
+		}
+		shift /= sw
+		rec.Recommended.ZeroLoadSupply += float32(shift)
+		rec.Recommended.DesignLoadSupply += float32(shift)
+		rec.Reasons = append(rec.Reasons, fmt.Sprintf("narrow outdoor temperature range, shifting the curve by %+.1f°C", shift))
+	} else {
+		m := (sw*sxy - sx*sy) / denom
+		b := (sy - m*sx) / sw
+		rec.Recommended.ZeroLoadSupply = float32(m*float64(cfg.ZeroLoadOutdoorAirTemperature) + b)
+		rec.Recommended.DesignLoadSupply = float32(m*float64(cfg.DesignLoadOutdoorAirTemperature) + b)
+	}
+
+	// keep within the system limits
+	minSupply := tuning.MinSupplyTemperature
+	rec.Recommended.ZeroLoadSupply = max(rec.Recommended.ZeroLoadSupply, minSupply)
+	rec.Recommended.DesignLoadSupply = max(rec.Recommended.DesignLoadSupply, rec.Recommended.ZeroLoadSupply)
+	if cfg.MaxSupplyTemperature > 0 {
+		rec.Recommended.DesignLoadSupply = min(rec.Recommended.DesignLoadSupply, cfg.MaxSupplyTemperature)
+		rec.Recommended.ZeroLoadSupply = min(rec.Recommended.ZeroLoadSupply, cfg.MaxSupplyTemperature)
+	}
+	return rec
+}
+
+func (rec *CurveRecommendation) significant() bool {
+	return !closeCurves(rec.Recommended, rec.Current)
+}
+
+func closeCurves(a, b CurvePoints) bool {
+	const threshold = 0.5 // degC
+	return math.Abs(float64(a.ZeroLoadSupply-b.ZeroLoadSupply)) < threshold &&
+		math.Abs(float64(a.DesignLoadSupply-b.DesignLoadSupply)) < threshold
+}
+
+func (rec *CurveRecommendation) String() string {
+	return fmt.Sprintf("zero load supply %.1f°C -> %.1f°C, design load supply %.1f°C -> %.1f°C",
+		rec.Current.ZeroLoadSupply, rec.Recommended.ZeroLoadSupply,
+		rec.Current.DesignLoadSupply, rec.Recommended.DesignLoadSupply)
+}
+
+// applyCurve moves the curve towards the recommendation,
+// by at most max_step degC at each end of the curve
+func applyCurve(rec *CurveRecommendation) {
+	step := ctrlConfig.Heating.Tuning.MaxStep
+	if step <= 0 {
+		step = 1
+	}
+	limit := func(from, to float32) float32 {
+		return from + max(-step, min(to-from, step))
+	}
+	heating := &ctrlConfig.Heating
+	heating.ZeroLoadSupplyTemperature = limit(heating.ZeroLoadSupplyTemperature, rec.Recommended.ZeroLoadSupply)
+	heating.DesignLoadSupplyTemperature = limit(heating.DesignLoadSupplyTemperature, rec.Recommended.DesignLoadSupply)
+	rec.Applied = true
+}
+
+// evaluateCurve runs once a day, publishes the recommendation and
+// notifies when the curve should change, applying it if enabled
+func evaluateCurve() {
+	tuning := ctrlConfig.Heating.Tuning
+	if !tuning.Enabled || !outdoorResetEnabled() {
+		return
+	}
+	d := &dutyTracker
+	if !d.LastEvaluation.IsZero() && now().Sub(d.LastEvaluation) < 24*time.Hour {
+		return
+	}
+	if d.LastEvaluation.IsZero() {
+		// wait a day before the first evaluation
+		d.LastEvaluation = now()
+		return
+	}
+	d.LastEvaluation = now()
+
+	rec := d.recommend()
+	d.Recommendation = rec
+
+	if rec.significant() {
+		if tuning.AutoApply {
+			applyCurve(rec)
+		}
+		if rec.Applied || !closeCurves(rec.Recommended, d.LastNotified) {
+			notifyCurveRecommendation(rec)
+			d.LastNotified = rec.Recommended
+		}
+	}
+	publishCurveRecommendation(rec)
+	saveDutyTracker()
+}
+
+func notifyCurveRecommendation(rec *CurveRecommendation) {
+	title := "Heating curve recommendation"
+	if rec.Applied {
+		title = "Heating curve adjusted"
+	}
+	notify.Notify(notification.Event{
+		Type:    EventHeatingCurve,
+		Title:   title,
+		Message: rec.String() + "\n" + strings.Join(rec.Reasons, "\n"),
+		Tags:    []string{"house_with_garden", "chart_with_downwards_trend"},
+	})
+}
+
+func publishCurveRecommendation(rec *CurveRecommendation) {
+	if publisher == nil {
+		return
+	}
+	const RETAIN = true
+	err := publisher.Publish(RETAIN, "controller/curve/recommendation", rec)
+	if err != nil {
+		fmt.Println("[controller] publishCurveRecommendation:", err)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"burlo/config"
+	"burlo/pkg/clock"
+	"burlo/pkg/models/controller"
+	"burlo/pkg/notification"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Domestic hot water priority: when the tank drops below setpoint -
+// differential the DX2W is diverted to the tank (dhw output, wired to
+// the diversion thermostat input) and space heating zone calls are
+// suspended or limited until the tank recovers. Priority is given up
+// after max_priority_time, and won't restart for the same time, so
+// that a failed recovery can't leave the house without heat. Diverting
+// only happens in heat mode, the tank would be chilled while cooling.
+// The diagnostics check that DIVERSION_VALVE_CLOSED follows the output.
+
+const OutDHW = "dhw"
+
+// tank readings older than this are ignored
+const dhwSensorTimeout = 30 * time.Minute
+
+type DHWState struct {
+	Priority     bool
+	Since        time.Time
+	LockoutUntil time.Time
+}
+
+func onDHWUpdate(payload []byte) {
+	var tank controller.DHWTank
+	err := json.Unmarshal(payload, &tank)
+	if err != nil {
+		fmt.Println("onDHWUpdate:", err)
+		return
+	}
+	inputMutex.Lock()
+	defer inputMutex.Unlock()
+
+	if tank.Time.IsZero() {
+		tank.Time = now()
+	}
+	inputs.DHW.Temperature = tank.Temperature
+	inputs.DHW.Time = tank.Time
+	tryRunController()
+}
+
+func dhwOutput() string {
+	if ctrlConfig.DHW.Output != "" {
+		return ctrlConfig.DHW.Output
+	}
+	return OutDHW
+}
+
+// updateDHW runs the priority state machine
+func updateDHW(inputs CtrlInput, current CtrlOutput) DHWState {
+	cfg := ctrlConfig.DHW
+	state := current.DHW
+	if !cfg.Enabled {
+		return DHWState{}
+	}
+	t := now()
+	maxPriority := time.Duration(max(1, cfg.MaxPriorityTime)) * time.Minute
+	sensorOk := !inputs.DHW.Time.IsZero() && t.Sub(inputs.DHW.Time) < dhwSensorTimeout
+
+	if state.Priority {
+		switch {
+		case current.DX2W.Mode != DX2W_HEAT:
+			fmt.Println("[controller] DX2W left heat mode, ending DHW priority")
+			state.Priority = false
+
+		case !sensorOk:
+			fmt.Println("[controller] DHW sensor data is stale, ending priority")
+			state.Priority = false
+
+		case inputs.DHW.Temperature >= cfg.Setpoint:
+			state.Priority = false
+
+		case t.Sub(state.Since) >= maxPriority:
+			state.Priority = false
+			state.LockoutUntil = t.Add(maxPriority)
+			notifyDHWTimeout(inputs.DHW.Temperature, t.Sub(state.Since))
+		}
+		return state
+	}
+
+	calling := sensorOk && inputs.DHW.Temperature < cfg.Setpoint-cfg.Differential
+	if calling && t.After(state.LockoutUntil) && inSchedule(t, cfg.Schedule) &&
+		current.DX2W.Mode == DX2W_HEAT && current.DX2W.State != DX2W_OFF {
+		state.Priority = true
+		state.Since = t
+	}
+	return state
+}
+
+// limitZoneCalls applies the DHW priority (heat mode only) to the zone
+// calls, in "limit" mode only zones below their comfort band keep calling
+func limitZoneCalls(inputs CtrlInput, calls map[string]bool) map[string]bool {
+	limited := make(map[string]bool)
+	for zone, call := range calls {
+		if ctrlConfig.DHW.ZoneCalls == "limit" {
+			indoor := inputs.Zones[zone]
+			call = call && RoomTooCold(indoor.HeatSetpointErr)
+		} else {
+			call = false
+		}
+		limited[zone] = call
+	}
+	return limited
+}
+
+// inSchedule is true when t falls within one of the "HH:MM-HH:MM"
+// windows (which may wrap past midnight), or there are no windows
+func inSchedule(t time.Time, windows []string) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	for _, window := range windows {
+		// invalid windows are rejected at startup by checkDHWSchedule
+		w, err := clock.ParseWindow(window)
+		if err == nil && w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDHWSchedule validates the schedule windows once at startup
+func checkDHWSchedule(cfg config.DHW) error {
+	for _, window := range cfg.Schedule {
+		if _, err := clock.ParseWindow(window); err != nil {
+			return fmt.Errorf("dhw schedule: %w", err)
+		}
+	}
+	return nil
+}
+
+func notifyDHWTimeout(temperature float32, elapsed time.Duration) {
+	notify.Notify(notification.Event{
+		Type:  EventDHW,
+		Title: "Hot water is taking too long",
+		Message: fmt.Sprintf("DHW priority ended after %s with the tank at %.1f°C (setpoint %.1f°C), space heating resumed",
+			elapsed.Round(time.Minute), temperature, ctrlConfig.DHW.Setpoint),
+		Tags: []string{"house_with_garden", "shower", "warning"},
+	})
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"burlo/pkg/dx2w"
+	"burlo/pkg/notification"
+	"burlo/pkg/psychro"
+	"context"
+	"fmt"
+	"time"
+)
+
+// Compressor and defrost diagnostics: the DX2W registers are sampled into
+// a sliding window, and checked for short cycling (starts per hour, short
+// runs), defrosts more frequent than the outdoor conditions explain, stall
+// counter increments, low liquid subcooling and the diversion valve not
+// following the DHW priority (see hydronics.go for the water side). Each finding keeps the samples that support it, notifies,
+// and goes to the fault log
+
+var diagnosticRegisters = []string{
+	"COMPRESSOR_CALL",
+	"COMPRESSOR_SESSION_RUNTIME",
+	"DEFROST",
+	"TIME_SINCE_LAST_DEFROST",
+	"FORCED_DEFROST",
+	"COMP_STALL_OR_DELAY_COUNTER",
+	"LIQUID_SUB-COOLING",
+	"OUTSIDE_AIR_TEMP",
+	"DIVERSION_VALVE_CLOSED",
+}
+
+// finding categories
+const (
+	DiagShortCycling = "short_cycling"
+	DiagShortRun     = "short_run"
+	DiagDefrost      = "defrost_frequency"
+	DiagStall        = "compressor_stall"
+	DiagSubcooling   = "low_subcooling"
+	DiagDiversion    = "diversion_valve"
+)
+
+const diagnosticsPeriod = 15 * time.Second
+
+// samples kept, the longest window a check looks at
+const diagnosticsWindow = 2 * time.Hour
+
+// a category is reported at most once per interval
+const findingInterval = time.Hour
+
+// subcooling is only checked while running steadily
+const subcoolingWindow = 10 * time.Minute
+
+// the diversion valve follows the DHW priority within this
+const diversionWindow = 5 * time.Minute
+
+// above this the coil doesn't frost
+const noFrostTemperature = 7 // °C
+
+type DiagnosticSample struct {
+	Time            time.Time
+	Running         bool    // compressor call
+	SessionRuntime  float32 // minutes
+	Defrost         bool
+	SinceDefrost    float32 // minutes
+	HasSinceDefrost bool    // it was read
+	ForcedDefrost   bool
+	Stalls          float32 // COMP_STALL_OR_DELAY_COUNTER
+	HasStalls       bool    // it was read
+	Subcooling      float32 // °C
+	OutsideT        float32 // °C
+	OutdoorDewpoint float32 // °C, from the weather
+	DX2WOn          bool    // the controller state
+	Mode            dx2wmode
+	ZoneCall        bool
+	DHWPriority     bool
+	Diverted        bool // DIVERSION_VALVE_CLOSED, to the tank
+	HasDiverted     bool // it was read
+
+	// water side, when Hydronics, temperatures in °C
+	Hydronics      bool
+	DeltaT         float32
+	EnteringT      float32
+	ExitingT       float32
+	BufferT        float32
+	BufferSetpoint float32 // the buffer target, 0 when unknown
+	Flow           float32 // gpm, configured
+	Circulator     bool
+}
+
+type Finding struct {
+	Category string
+	Time     time.Time
+	Reason   string
+	Window   []DiagnosticSample // the supporting data
+}
+
+type Diagnostics struct {
+	Samples  []DiagnosticSample
+	DeltaT   Baseline             // while running steadily
+	lastSent map[string]time.Time // by category
+}
+
+// reportFunc adds a finding, with the samples of the window
+type reportFunc func(category string, window time.Duration, reason string)
+
+var diagnostics Diagnostics
+
+func maxStartsPerHour() int {
+	if ctrlConfig.Diagnostics.MaxStartsPerHour > 0 {
+		return ctrlConfig.Diagnostics.MaxStartsPerHour
+	}
+	return 3
+}
+
+func minRunTime() time.Duration {
+	if ctrlConfig.Diagnostics.MinRunTime > 0 {
+		return time.Duration(ctrlConfig.Diagnostics.MinRunTime) * time.Minute
+	}
+	return 10 * time.Minute
+}
+
+func minDefrostInterval() time.Duration {
+	if ctrlConfig.Diagnostics.MinDefrostInterval > 0 {
+		return time.Duration(ctrlConfig.Diagnostics.MinDefrostInterval) * time.Minute
+	}
+	return 30 * time.Minute
+}
+
+func minSubcooling() float32 {
+	if ctrlConfig.Diagnostics.MinSubcooling > 0 {
+		return ctrlConfig.Diagnostics.MinSubcooling
+	}
+	return 1.5
+}
+
+// run_diagnostics samples the DX2W registers and raises the findings
+func run_diagnostics(ctx context.Context) {
+	ticker := time.NewTicker(diagnosticsPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if dx2w_client == nil {
+			continue
+		}
+
+		// read without holding the inputs, this can take a while
+		readings := dx2w_client.Read(append(diagnosticRegisters, hydronicRegisters...))
+
+		inputMutex.Lock()
+		sample, ok := diagnosticSample(readings, now())
+		if ok {
+			for _, finding := range diagnose(sample) {
+				raiseFinding(finding)
+			}
+		}
+		inputMutex.Unlock()
+	}
+}
+
+// diagnosticSample must be called with the inputMutex held,
+// it needs a fresh compressor call
+func diagnosticSample(readings map[string]dx2w.Value, t time.Time) (DiagnosticSample, bool) {
+	fresh := func(name string) bool {
+		value, ok := readings[name]
+		return ok && t.Sub(value.Timestamp) < maxReadingAge
+	}
+	if !fresh("COMPRESSOR_CALL") {
+		return DiagnosticSample{}, false
+	}
+	s := DiagnosticSample{
+		Time:            t,
+		Running:         readings["COMPRESSOR_CALL"].Bool,
+		SessionRuntime:  readings["COMPRESSOR_SESSION_RUNTIME"].Float32,
+		Defrost:         readings["DEFROST"].Bool,
+		SinceDefrost:    readings["TIME_SINCE_LAST_DEFROST"].Float32,
+		HasSinceDefrost: fresh("TIME_SINCE_LAST_DEFROST"),
+		ForcedDefrost:   readings["FORCED_DEFROST"].Bool,
+		Stalls:          readings["COMP_STALL_OR_DELAY_COUNTER"].Float32,
+		HasStalls:       fresh("COMP_STALL_OR_DELAY_COUNTER"),
+		Subcooling:      readings["LIQUID_SUB-COOLING"].Float32 * 5 / 9,
+		OutsideT:        psychro.FahrenheitToCelsius(readings["OUTSIDE_AIR_TEMP"].Float32),
+		OutdoorDewpoint: inputs.Outdoor.Dewpoint,
+		DX2WOn:          currentState.DX2W.State != DX2W_OFF,
+		Mode:            currentState.DX2W.Mode,
+		ZoneCall:        currentState.ZoneCall,
+		DHWPriority:     currentState.DHW.Priority,
+		Diverted:        readings["DIVERSION_VALVE_CLOSED"].Bool,
+		HasDiverted:     fresh("DIVERSION_VALVE_CLOSED"),
+	}
+	s.Hydronics = true
+	for _, name := range hydronicRegisters {
+		// the setpoint and flow are read less often
+		if name != "BUFFER_TANK_SETPOINT" && name != "BUFFER_FLOW" && !fresh(name) {
+			s.Hydronics = false
+		}
+	}
+	if s.Hydronics {
+		s.DeltaT = readings["HP_WATER_DELTA-T"].Float32 * 5 / 9
+		s.EnteringT = psychro.FahrenheitToCelsius(readings["HP_ENTERING_WATER_TEMP"].Float32)
+		s.ExitingT = psychro.FahrenheitToCelsius(readings["HP_EXITING_WATER_TEMP"].Float32)
+		s.BufferT = psychro.FahrenheitToCelsius(readings["BUFFER_TANK_TEMP"].Float32)
+		// with outdoor reset the target is written to ODR_TARGET_WATER_TEMP
+		if outdoorResetEnabled() && currentState.SupplyTarget > 0 {
+			s.BufferSetpoint = currentState.SupplyTarget
+		} else if setpoint, ok := readings["BUFFER_TANK_SETPOINT"]; ok {
+			s.BufferSetpoint = psychro.FahrenheitToCelsius(setpoint.Float32)
+		}
+		s.Flow = readings["BUFFER_FLOW"].Float32
+		s.Circulator = readings["HP_CIRCULATOR"].Bool
+	}
+	return s, true
+}
+
+// diagnose adds the sample to the window and returns the new findings,
+// must be called with the inputMutex held
+func diagnose(s DiagnosticSample) []Finding {
+	var prev *DiagnosticSample
+	if n := len(diagnostics.Samples); n > 0 {
+		prev = &diagnostics.Samples[n-1]
+	}
+	var findings []Finding
+	add := func(category string, window time.Duration, reason string) {
+		if last, ok := diagnostics.lastSent[category]; ok && s.Time.Sub(last) < findingInterval {
+			return
+		}
+		if diagnostics.lastSent == nil {
+			diagnostics.lastSent = make(map[string]time.Time)
+		}
+		diagnostics.lastSent[category] = s.Time
+		findings = append(findings, Finding{
+			Category: category,
+			Time:     s.Time,
+			Reason:   reason,
+			Window:   samplesSince(s.Time.Add(-window), s),
+		})
+	}
+
+	if prev != nil {
+		if s.Running && !prev.Running {
+			starts := countStarts(s.Time.Add(-time.Hour)) + 1
+			if starts > maxStartsPerHour() {
+				add(DiagShortCycling, time.Hour, fmt.Sprintf(
+					"%d compressor starts in the last hour, expected at most %d", starts, maxStartsPerHour()))
+			}
+		}
+		if !s.Running && prev.Running {
+			run := time.Duration(prev.SessionRuntime * float32(time.Minute))
+			if run > 0 && run < minRunTime() {
+				add(DiagShortRun, run+5*time.Minute, fmt.Sprintf(
+					"the compressor ran for %.1f minutes, expected at least %.0f",
+					run.Minutes(), minRunTime().Minutes()))
+			}
+		}
+		if s.Defrost && !prev.Defrost && !s.ForcedDefrost {
+			interval := time.Duration(prev.SinceDefrost * float32(time.Minute))
+			expected := expectedDefrostInterval(s.OutsideT, s.OutdoorDewpoint)
+			switch {
+			case expected == 0:
+				add(DiagDefrost, 30*time.Minute, fmt.Sprintf(
+					"defrost at %.1f°C outdoors, the coil shouldn't frost above %d°C",
+					s.OutsideT, noFrostTemperature))
+			case prev.HasSinceDefrost && interval < expected:
+				add(DiagDefrost, min(interval+5*time.Minute, diagnosticsWindow), fmt.Sprintf(
+					"defrost %.0f minutes after the previous one, expected at least %.0f at %.1f°C (dewpoint %.1f°C)",
+					interval.Minutes(), expected.Minutes(), s.OutsideT, s.OutdoorDewpoint))
+			}
+		}
+		// a missing register isn't a 0 reading
+		if prev.HasStalls && s.HasStalls && s.Stalls > prev.Stalls {
+			add(DiagStall, 15*time.Minute, fmt.Sprintf(
+				"the compressor stall or delay counter went from %.0f to %.0f", prev.Stalls, s.Stalls))
+		}
+	}
+	if sustained(subcoolingWindow, s, func(s DiagnosticSample) bool {
+		return steady(s) && s.Subcooling < minSubcooling()
+	}) {
+		add(DiagSubcooling, subcoolingWindow, fmt.Sprintf(
+			"liquid subcooling %.1f°C for %.0f minutes, expected at least %.1f°C",
+			s.Subcooling, subcoolingWindow.Minutes(), minSubcooling()))
+	}
+	if ctrlConfig.DHW.Enabled && sustained(diversionWindow, s, func(s DiagnosticSample) bool {
+		return s.HasDiverted && s.Diverted != s.DHWPriority
+	}) {
+		add(DiagDiversion, diversionWindow, fmt.Sprintf(
+			"DIVERSION_VALVE_CLOSED is %s while the DHW priority is %s, for %.0f minutes",
+			onOff(s.Diverted), onOff(s.DHWPriority), diversionWindow.Minutes()))
+	}
+	diagnoseHydronics(s, add)
+
+	diagnostics.Samples = append(samplesSince(s.Time.Add(-diagnosticsWindow)), s)
+	return findings
+}
+
+// samplesSince copies the samples after t, and adds the current sample
+func samplesSince(t time.Time, current ...DiagnosticSample) []DiagnosticSample {
+	var samples []DiagnosticSample
+	for _, s := range diagnostics.Samples {
+		if s.Time.After(t) {
+			samples = append(samples, s)
+		}
+	}
+	return append(samples, current...)
+}
+
+func countStarts(since time.Time) int {
+	starts := 0
+	for i := 1; i < len(diagnostics.Samples); i++ {
+		s := diagnostics.Samples[i]
+		if s.Time.After(since) && s.Running && !diagnostics.Samples[i-1].Running {
+			starts++
+		}
+	}
+	return starts
+}
+
+// expectedDefrostInterval is the shortest normal time between defrosts,
+// 0 when no defrost is expected. Frost builds fastest around freezing
+// in humid air, slower in dry or very cold air
+func expectedDefrostInterval(outsideT, dewpoint float32) time.Duration {
+	switch {
+	case outsideT > noFrostTemperature:
+		return 0
+	case outsideT >= -10 && outsideT <= 5 && outsideT-dewpoint < 3:
+		return minDefrostInterval()
+	default:
+		return 2 * minDefrostInterval()
+	}
+}
+
+// raiseFinding must be called with the inputMutex held
+func raiseFinding(finding Finding) {
+	fmt.Printf("[controller] diagnostics: %s: %s\r\n", finding.Category, finding.Reason)
+	fault := logFault(finding)
+	priority := notification.PriorityDefault
+	switch finding.Category {
+	case DiagStall, DiagSubcooling, DiagNoDeltaT, DiagCirculator:
+		priority = notification.PriorityHigh
+	}
+	notify.Notify(notification.Event{
+		Type:     EventDiagnostics,
+		Key:      finding.Category,
+		Title:    "DX2W diagnostics: " + finding.Category,
+		Message:  fmt.Sprintf("%s. The data is at /controller/faults/%d", finding.Reason, fault.ID),
+		Tags:     []string{"house_with_garden", "wrench", finding.Category},
+		Priority: priority,
+	})
+	if publisher != nil {
+		err := publisher.Publish(false, "controller/faults", fault)
+		if err != nil {
+			fmt.Println("[controller] raiseFinding:", err)
+		}
+	}
+}
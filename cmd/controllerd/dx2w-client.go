@@ -0,0 +1,49 @@
+package main
+
+import (
+	"burlo/config"
+	"burlo/pkg/dx2w"
+	"fmt"
+)
+
+var dx2w_client dx2w.Device
+
+// last state successfully written to the DX2W, used to
+// avoid writing the power register on every update
+var dx2wAppliedState dx2wstate
+
+// the DX2W only allows a single modbus connection, so prefer
+// going through dx2wlogger which holds the shared session.
+// Connect directly only when dx2wlogger is not deployed
+func initDX2WClient(cfg config.ServiceConf) {
+	switch {
+	case cfg.ServiceHTTPAddresses.Dx2Wlogger != "":
+		dx2w_client = dx2w.NewHTTPClient(cfg.ServiceHTTPAddresses.Dx2Wlogger)
+
+	case cfg.Dx2WModbus.TCPAddress != "":
+		dx2w_client = dx2w.New(dx2w.TCPDevice{
+			Url: fmt.Sprintf("tcp://%s", cfg.Dx2WModbus.TCPAddress),
+			Id:  cfg.Dx2WModbus.DeviceID,
+		})
+
+	default:
+		fmt.Println("[controller] dx2w not configured, state will not be applied")
+	}
+}
+
+// set_dx2w_state puts the DX2W into standby (OFF) or
+// turns it back on (ON) using the DX2W_POWER register
+func set_dx2w_state(state dx2wstate) {
+	if dx2w_client == nil || state == dx2wAppliedState {
+		return
+	}
+	if state != DX2W_ON && state != DX2W_OFF {
+		return
+	}
+	_, err := dx2w_client.WriteBool("DX2W_POWER", state == DX2W_ON)
+	if err != nil {
+		fmt.Println("[controller] set_dx2w_state: failed to write DX2W_POWER:", err)
+		return
+	}
+	dx2wAppliedState = state
+}
@@ -30,11 +30,11 @@ func (dx2w *DX2W) setMode(mode dx2wmode) {
 		return
 	}
 	// debounce when changing mode
-	if time.Since(dx2w.LastChange) < 24*time.Hour {
+	if now().Sub(dx2w.LastChange) < 24*time.Hour {
 		return
 	}
 	dx2w.Mode = mode
-	dx2w.LastChange = time.Now()
+	dx2w.LastChange = now()
 	notifyMode(mode)
 }
 
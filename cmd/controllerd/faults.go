@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The fault log keeps the diagnostics findings (compressor, defrost and
+// hydronic faults) with their supporting samples across restarts, it is
+// served by /controller/faults and a fault is removed once dealt with
+
+// Fault is a logged finding
+type Fault struct {
+	ID int
+	Finding
+}
+
+type FaultLog struct {
+	NextID int
+	Faults []Fault
+}
+
+var faultLog FaultLog
+
+// faults kept, the oldest are dropped
+const maxFaults = 50
+
+// logFault must be called with the inputMutex held
+func logFault(finding Finding) Fault {
+	faultLog.NextID++
+	fault := Fault{ID: faultLog.NextID, Finding: finding}
+	faultLog.Faults = append(faultLog.Faults, fault)
+	if len(faultLog.Faults) > maxFaults {
+		faultLog.Faults = faultLog.Faults[len(faultLog.Faults)-maxFaults:]
+	}
+	saveFaultLog()
+	return fault
+}
+
+// removeFault must be called with the inputMutex held
+func removeFault(id int) bool {
+	for i, fault := range faultLog.Faults {
+		if fault.ID == id {
+			faultLog.Faults = append(faultLog.Faults[:i], faultLog.Faults[i+1:]...)
+			saveFaultLog()
+			return true
+		}
+	}
+	return false
+}
+
+func saveFaultLog() {
+	if stateStore == nil {
+		return
+	}
+	putState("faults", faultLog)
+}
+
+// GetFaults lists the faults without their samples, oldest first,
+// ?category=no_delta_t and ?since=2024-01-15T00:00:00Z filter them
+func GetFaults() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		category := r.URL.Query().Get("category")
+		var since time.Time
+		if s := r.URL.Query().Get("since"); s != "" {
+			var err error
+			since, err = time.Parse(time.RFC3339, s)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		inputMutex.Lock()
+		faults := []Fault{}
+		for _, fault := range faultLog.Faults {
+			if (category == "" || fault.Category == category) && !fault.Time.Before(since) {
+				fault.Window = nil
+				faults = append(faults, fault)
+			}
+		}
+		inputMutex.Unlock()
+
+		bytes, err := json.MarshalIndent(faults, "", "    ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(bytes)
+	}
+}
+
+// GetFault returns a fault with its samples
+func GetFault() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		inputMutex.Lock()
+		defer inputMutex.Unlock()
+		for _, fault := range faultLog.Faults {
+			if fault.ID == id {
+				bytes, err := json.MarshalIndent(fault, "", "    ")
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				w.Write(bytes)
+				return
+			}
+		}
+		http.Error(w, "fault not found", http.StatusNotFound)
+	}
+}
+
+// DeleteFault removes a fault that was dealt with
+func DeleteFault() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		inputMutex.Lock()
+		defer inputMutex.Unlock()
+		if !removeFault(id) {
+			http.Error(w, "fault not found", http.StatusNotFound)
+		}
+	}
+}
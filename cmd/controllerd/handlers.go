@@ -3,17 +3,17 @@ package main
 import (
 	"burlo/pkg/models/controller"
 	"burlo/pkg/models/weather"
+	"burlo/pkg/notification"
+	"burlo/pkg/psychro"
 	"burlo/pkg/weathergcca"
 	"encoding/json"
 	"fmt"
 	"slices"
 	"sync"
-	"time"
 )
 
 var inputs = CtrlInput{
-	ModeOverride:  DX2W_AUTO,
-	StateOverride: DX2W_STATE_AUTO,
+	Overrides: make(map[string]controller.Override),
 }
 var inputMutex sync.Mutex
 var thermostats = make(map[string]controller.Thermostat)
@@ -30,66 +30,37 @@ func onThermostatUpdate(payload []byte) {
 	defer inputMutex.Unlock()
 
 	if tstat.Battery < 20 {
-		notify.Publish("sensor low battery",
-			fmt.Sprintf("thermostat with low battery: %s/%s", tstat.ID, tstat.Name),
-			[]string{"battery"})
+		notify.Notify(notification.Event{
+			Type:    EventLowBattery,
+			Key:     tstat.ID,
+			Title:   "sensor low battery",
+			Message: fmt.Sprintf("thermostat with low battery: %s/%s (%d%%)", tstat.ID, tstat.Name, tstat.Battery),
+			Tags:    []string{"battery"},
+		})
 	}
 
-	// remove thermostats and humidistats whose last update is
-	// greater than 6hr old. Stale data can cause the controller
-	// to perform the wrong action.
-	for id, tstat := range thermostats {
-		if time.Since(tstat.Time) > 6*time.Hour {
-			delete(thermostats, id)
-		}
-	}
-	for id, hstat := range humidistats {
-		if time.Since(hstat.Time) > 6*time.Hour {
-			delete(humidistats, id)
-		}
-	}
-
-	// update thermostats mapping
+	// update thermostats mapping, thermostats and humidistats
+	// past their max age are removed by checkHealth. Stale data
+	// can cause the controller to perform the wrong action.
+	name := "thermostat/" + tstat.ID
 	if tstat.DewpointOnly {
+		name = "humidistat/" + tstat.ID
 		humidistats[tstat.ID] = tstat
 	} else {
 		thermostats[tstat.ID] = tstat
 	}
-
-	// find max and mean values
-	var meanTemp float32 = 0.0
-	var maxDewpoint float32 = 0
-	var meanHeatSetpointErr float32 = 0.0
-	var meanCoolSetpointErr float32 = 0.0
-
-	for _, tstat := range thermostats {
-		maxDewpoint = max(maxDewpoint, tstat.Dewpoint)
-		meanTemp += tstat.Temperature
-		meanHeatSetpointErr += tstat.Temperature - tstat.HeatSetpoint
-		meanCoolSetpointErr += tstat.Temperature - tstat.CoolSetpoint
-	}
-	if len(thermostats) > 0 {
-		meanTemp /= float32(len(thermostats))
-		meanHeatSetpointErr /= float32(len(thermostats))
-		meanCoolSetpointErr /= float32(len(thermostats))
-	}
-
-	for _, hstat := range humidistats {
-		maxDewpoint = max(maxDewpoint, hstat.Dewpoint)
-	}
+	markUpdated(name, tstat.Time)
+	staleDewpoints[name] = tstat.Dewpoint
 
 	// update inputs and trigger controller routine
-	inputs.Indoor.Temperature = meanTemp
-	inputs.Indoor.Dewpoint = maxDewpoint
-	inputs.Indoor.HeatSetpointErr = meanHeatSetpointErr
-	inputs.Indoor.CoolSetpointErr = meanCoolSetpointErr
+	updateIndoorInputs(&inputs)
 
 	// we need at least one thermostat to provide a room
 	// temperature before the controller is ready
 	if len(thermostats) > 0 {
 		inputs.Ready |= IndoorReady
 	}
-	tryRunController(inputs)
+	tryRunController()
 }
 
 func onForecastUpdate(payload []byte) {
@@ -112,9 +83,12 @@ func onForecastUpdate(payload []byte) {
 	inputs.Outdoor.T24hHigh = slices.Max(data.Temperature)
 	inputs.Outdoor.T24hLow = slices.Min(data.Temperature)
 	inputs.Outdoor.T24hMean = mean(data.Temperature)
+	inputs.Outdoor.Forecast = data
+	inputs.Outdoor.ForecastTime = now()
 	inputs.Ready |= ForecastReady
+	markUpdated(InputForecast, now())
 
-	tryRunController(inputs)
+	tryRunController()
 }
 
 func onCurrentWeatherUpdate(payload []byte) {
@@ -129,10 +103,14 @@ func onCurrentWeatherUpdate(payload []byte) {
 
 	inputs.Outdoor.Temperature = data.Temperature
 	inputs.Outdoor.Humidity = data.RelHumidity
-	inputs.Outdoor.Dewpoint = calculate_dewpoint_simple(data.Temperature, data.RelHumidity)
+	inputs.Outdoor.Dewpoint = psychro.Dewpoint(data.Temperature, data.RelHumidity)
+	inputs.Outdoor.WindSpeed = data.WindSpeed
+	inputs.Outdoor.CloudCover = data.CloudCover
+	inputs.Outdoor.Precipitation = data.Precipitation
 	inputs.Ready |= CurrentReady
+	markUpdated(InputCurrent, now())
 
-	tryRunController(inputs)
+	tryRunController()
 }
 
 func onAQHIUpdate(payload []byte) {
@@ -152,16 +130,6 @@ func onAQHIUpdate(payload []byte) {
 
 	inputs.Outdoor.AQHI = int32(data.AQHI[0])
 	inputs.Ready |= AQHIReady
-	tryRunController(inputs)
-}
-
-// a simple approximation, should err on the side of
-// being too high, never too low. Temperature must be
-// in celcius. Accureate to within 1 degC when RelH > 50%
-func calculate_dewpoint_simple(temp, relH float32) float32 {
-	if relH >= 50 && temp >= 25 {
-		return temp - ((100 - relH) / 5)
-	} else {
-		return temp - ((100 - relH) / 4)
-	}
+	markUpdated(InputAQHI, now())
+	tryRunController()
 }
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"burlo/pkg/notification"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Every input has a max age. Stale sensors are dropped from the indoor
+// inputs, and stale weather no longer drives decisions. The controller
+// then falls back to safe decisions: hold the heatpump mode and state,
+// raise the dewpoint while a dewpoint sensor is missing, stop cooling
+// calls, and advise keeping the windows closed.
+
+const (
+	InputCurrent  = "current"
+	InputForecast = "forecast"
+	InputAQHI     = "aqhi"
+)
+
+// only set in CtrlInput.Stale, when a dewpoint sensor is stale
+const DewpointStale bitflag = 0b10000
+
+// stale sensors are forgotten after this long, so that
+// removing one doesn't block cooling forever
+const forgetSensor = 24 * time.Hour
+
+type InputHealth struct {
+	Updated time.Time
+	MaxAge  time.Duration
+	Stale   bool
+}
+
+var health = make(map[string]InputHealth)
+
+// last dewpoint reported by each sensor, used while it is stale
+var staleDewpoints = make(map[string]float32)
+
+func maxAge(name string) time.Duration {
+	cfg := ctrlConfig.Freshness
+	minutes := func(configured, fallback int) time.Duration {
+		if configured <= 0 {
+			configured = fallback
+		}
+		return time.Duration(configured) * time.Minute
+	}
+	switch {
+	case strings.HasPrefix(name, "thermostat/"):
+		return minutes(cfg.Thermostat, 360)
+	case strings.HasPrefix(name, "humidistat/"):
+		return minutes(cfg.Humidistat, 360)
+	case name == InputCurrent:
+		return minutes(cfg.Current, 60)
+	case name == InputForecast:
+		return minutes(cfg.Forecast, 180)
+	case name == InputAQHI:
+		return minutes(cfg.AQHI, 360)
+	}
+	return 0
+}
+
+func dewpointMargin() float32 {
+	if ctrlConfig.Freshness.DewpointMargin > 0 {
+		return ctrlConfig.Freshness.DewpointMargin
+	}
+	return 2
+}
+
+// markUpdated records an input update at time t
+func markUpdated(name string, t time.Time) {
+	previous := health[name]
+	if previous.Stale {
+		notifyHealth(name, false, t)
+	}
+	health[name] = InputHealth{Updated: t, MaxAge: maxAge(name)}
+}
+
+// checkHealth drops stale sensors and flags stale inputs,
+// must be called with the inputMutex held
+func checkHealth() {
+	t := now()
+	dropped := false
+	for id, tstat := range thermostats {
+		if t.Sub(tstat.Time) > maxAge("thermostat/"+id) {
+			delete(thermostats, id)
+			dropped = true
+		}
+	}
+	for id, hstat := range humidistats {
+		if t.Sub(hstat.Time) > maxAge("humidistat/"+id) {
+			delete(humidistats, id)
+			dropped = true
+		}
+	}
+	if dropped {
+		updateIndoorInputs(&inputs)
+	}
+
+	inputs.Stale = 0
+	inputs.StaleDewpoint = 0
+	for name, h := range health {
+		if t.Sub(h.Updated) <= h.MaxAge {
+			continue
+		}
+		sensor := strings.Contains(name, "/")
+		if sensor && t.Sub(h.Updated) > forgetSensor {
+			fmt.Println("[controller] forgetting stale sensor:", name)
+			delete(health, name)
+			continue
+		}
+		if !h.Stale {
+			h.Stale = true
+			health[name] = h
+			notifyHealth(name, true, t)
+		}
+		switch {
+		case sensor:
+			inputs.Stale |= DewpointStale
+			inputs.StaleDewpoint = max(inputs.StaleDewpoint, staleDewpoints[name])
+		case name == InputCurrent:
+			inputs.Stale |= CurrentReady
+		case name == InputForecast:
+			inputs.Stale |= ForecastReady
+		case name == InputAQHI:
+			inputs.Stale |= AQHIReady
+		}
+	}
+	if inputs.Ready&IndoorReady != 0 && len(thermostats) == 0 {
+		inputs.Stale |= IndoorReady
+	}
+}
+
+func notifyHealth(name string, stale bool, t time.Time) {
+	h := health[name]
+	if stale {
+		notify.Notify(notification.Event{
+			Type:  EventInputHealth,
+			Key:   name,
+			Title: "Stale input: " + name,
+			Message: fmt.Sprintf("no update since %s (max age %s), the controller is falling back to safe decisions",
+				h.Updated.Format("Jan 2 15:04"), h.MaxAge),
+			Tags:     []string{"house_with_garden", "warning"},
+			Priority: notification.PriorityHigh,
+		})
+	} else {
+		notify.Notify(notification.Event{
+			Type:    EventInputHealth,
+			Key:     name + "/recovered",
+			Title:   "Input recovered: " + name,
+			Message: fmt.Sprintf("updated again after %s", t.Sub(h.Updated).Round(time.Minute)),
+			Tags:    []string{"house_with_garden", "white_check_mark"},
+		})
+	}
+}
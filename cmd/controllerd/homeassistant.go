@@ -0,0 +1,143 @@
+package main
+
+import (
+	"burlo/config"
+	"burlo/pkg/homeassistant"
+	"burlo/pkg/models/controller"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// The controller outputs are published to controller/status, and
+// announced to Home Assistant as sensors. The overrides are selects,
+// choosing AUTO clears the override.
+
+var hass *homeassistant.Client
+
+// last published status, only changes are published
+var lastStatus controller.Status
+
+const statusTopic = "controller/status"
+
+// initHomeAssistant must be called after the publisher is created
+func initHomeAssistant(cfg config.ServiceConf) {
+	hass = homeassistant.NewClient(cfg, publisher,
+		[]string{"controller/override/#"}, onHomeAssistantCommand)
+	hass.Announce(controllerEntities()...)
+}
+
+func controllerEntities() []homeassistant.Entity {
+	device := homeassistant.Device{
+		Identifiers:  []string{"burlo_controller"},
+		Name:         "Burlo controller",
+		Manufacturer: "burlo",
+		Model:        "controllerd",
+	}
+	text := func(id, name, field, icon string) homeassistant.Entity {
+		entity := homeassistant.Sensor(device, id, name, statusTopic, field, "", "")
+		entity.StateClass = ""
+		entity.Icon = icon
+		return entity
+	}
+	entities := []homeassistant.Entity{
+		text("controller_mode", "Mode", "Mode", "mdi:sun-snowflake-variant"),
+		text("controller_state", "State", "State", "mdi:power"),
+		text("controller_window", "Window advice", "Window", "mdi:window-open-variant"),
+		homeassistant.Sensor(device, "controller_supply_target", "Supply target", statusTopic, "SupplyTarget", "°C", "temperature"),
+		homeassistant.Sensor(device, "controller_dewpoint", "Dewpoint", statusTopic, "Dewpoint", "°C", "temperature"),
+		homeassistant.BinarySensor(device, "controller_zone_call", "Zone call", statusTopic, "ZoneCall", "running"),
+		homeassistant.BinarySensor(device, "controller_windows_open", "Windows open", statusTopic, "WindowsOpen", "window"),
+		homeassistant.BinarySensor(device, "controller_openers", "Window openers", statusTopic, "Openers", "opening"),
+		homeassistant.BinarySensor(device, "controller_fans", "Whole house fans", statusTopic, "Fans", "running"),
+		homeassistant.BinarySensor(device, "controller_erv_boost", "ERV boost", statusTopic, "ERVBoost", "running"),
+		homeassistant.BinarySensor(device, "controller_dhw_priority", "DHW priority", statusTopic, "DHWPriority", "running"),
+		homeassistant.BinarySensor(device, "controller_interlock", "Condensation interlock", statusTopic, "Interlock", "problem"),
+	}
+	for _, kind := range []string{controller.OverrideMode, controller.OverrideState, controller.OverrideWindow, controller.OverrideZoneCall} {
+		entities = append(entities, overrideEntity(device, kind, ""))
+	}
+	if len(ctrlConfig.Zones) > 1 {
+		for _, zone := range zones() {
+			call := homeassistant.BinarySensor(device, homeassistant.ObjectID("controller_zone_call", zone.Name),
+				"Zone call "+zone.Name, statusTopic, "", "running")
+			call.ValueTemplate = fmt.Sprintf("{{ 'ON' if value_json['ZoneCalls']['%s'] else 'OFF' }}", zone.Name)
+			entities = append(entities, call, overrideEntity(device, controller.OverrideZoneCall, zone.Name))
+		}
+	}
+	return entities
+}
+
+// overrideEntity is a select of the override values, or AUTO
+func overrideEntity(device homeassistant.Device, kind, zone string) homeassistant.Entity {
+	key := overrideKey(kind, zone)
+	name := strings.ReplaceAll(kind, "_", " ")
+	if zone != "" {
+		name += " " + zone
+	}
+	return homeassistant.Entity{
+		Component:     "select",
+		ObjectID:      homeassistant.ObjectID("controller_override", key),
+		Name:          "Override " + name,
+		Device:        device,
+		Icon:          "mdi:hand-back-right",
+		StateTopic:    homeassistant.StateTopic("controller/overrides"),
+		ValueTemplate: fmt.Sprintf("{{ value_json['%s'].Value if '%s' in value_json else 'AUTO' }}", key, key),
+		CommandTopic:  homeassistant.CommandTopic("controller/override", key),
+		Options:       append([]string{"AUTO"}, overrideValues[kind]...),
+	}
+}
+
+// onHomeAssistantCommand handles controller/override/{kind} and
+// controller/override/zone_call/{zone}, the payload is the value
+func onHomeAssistantCommand(topic string, payload []byte) {
+	key := strings.TrimPrefix(topic, "controller/override/")
+	kind, zone, _ := strings.Cut(key, "/")
+
+	inputMutex.Lock()
+	defer inputMutex.Unlock()
+
+	err := setOverride(kind, controller.OverrideRequest{
+		Value:  strings.TrimSpace(string(payload)),
+		Reason: "set from Home Assistant",
+		Zone:   zone,
+	})
+	if err != nil {
+		fmt.Println("[homeassistant]", err)
+		return
+	}
+	tryRunController()
+}
+
+// publishStatus publishes the outputs when they changed,
+// must be called with the inputMutex held
+func publishStatus(output CtrlOutput) {
+	if publisher == nil {
+		return
+	}
+	status := controller.Status{
+		Mode:         string(output.DX2W.Mode),
+		State:        string(output.DX2W.State),
+		Window:       string(output.Window),
+		WindowsOpen:  output.Windows.Open,
+		Openers:      output.Windows.Openers.On,
+		Fans:         output.Windows.Fans.On,
+		ERVBoost:     output.Windows.ERV.On,
+		ZoneCall:     output.ZoneCall,
+		ZoneCalls:    output.ZoneCalls,
+		SupplyTarget: output.SupplyTarget,
+		Dewpoint:     output.Dewpoint,
+		DHWPriority:  output.DHW.Priority,
+		Interlock:    output.Interlock.Tripped,
+	}
+	if reflect.DeepEqual(status, lastStatus) {
+		return
+	}
+	const RETAIN = true
+	err := publisher.Publish(RETAIN, statusTopic, status)
+	if err != nil {
+		fmt.Println("[controller] publishStatus:", err)
+		return
+	}
+	lastStatus = status
+}
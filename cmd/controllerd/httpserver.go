@@ -2,6 +2,8 @@ package main
 
 import (
 	"burlo/config"
+	"burlo/pkg/metrics"
+	"burlo/pkg/models/controller"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -32,6 +34,16 @@ func httpserver(ctx context.Context, cfg config.ServiceConf) {
 
 	mux.HandleFunc("GET /controller/state", GetControllerState())
 	mux.HandleFunc("GET /controller/emoncms", GetEmoncmsInputs())
+	mux.HandleFunc("GET /controller/curve", GetHeatingCurve())
+	mux.HandleFunc("DELETE /controller/interlock", ResetInterlock())
+	mux.HandleFunc("GET /controller/overrides", GetOverrides())
+	mux.HandleFunc("PUT /controller/overrides/{kind}", PutOverride())
+	mux.HandleFunc("DELETE /controller/overrides/{kind}", DeleteOverride())
+	mux.HandleFunc("GET /controller/diagnostics", GetDiagnostics())
+	mux.HandleFunc("GET /controller/faults", GetFaults())
+	mux.HandleFunc("GET /controller/faults/{id}", GetFault())
+	mux.HandleFunc("DELETE /controller/faults/{id}", DeleteFault())
+	mux.HandleFunc("GET /metrics", metrics.Handler())
 	for {
 		fmt.Println("http server listening on", server.Addr)
 		err := server.ListenAndServe()
@@ -57,6 +69,7 @@ func GetControllerState() http.HandlerFunc {
 		w.Write(jsonBytes(State{
 			inputs,
 			currentState,
+			health,
 		}))
 	}
 }
@@ -84,6 +97,122 @@ func GetEmoncmsInputs() http.HandlerFunc {
 		state["outdoor_air_temp"] = inputs.Outdoor.Temperature
 		state["indoor_dewpoint"] = inputs.Indoor.Dewpoint
 		state["indoor_air_temp"] = inputs.Indoor.Temperature
+		state["supply_target"] = currentState.SupplyTarget
+		state["condensation_interlock"] = bool2float(currentState.Interlock.Tripped)
+		state["dhw_priority"] = bool2float(currentState.DHW.Priority)
+		state["dhw_tank_temp"] = inputs.DHW.Temperature
+		state["windows_open"] = bool2float(currentState.Windows.Open)
+		state["erv_boost"] = bool2float(currentState.Windows.ERV.On)
+		for zone, call := range currentState.ZoneCalls {
+			state["tstat_call_"+zone] = bool2float(call)
+		}
 		w.Write(jsonBytes(state))
 	}
 }
+
+// GetHeatingCurve reports the current heating curve, the last daily
+// recommendation, and what would be recommended from the data so far
+func GetHeatingCurve() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inputMutex.Lock()
+		defer inputMutex.Unlock()
+		bytes, err := json.MarshalIndent(struct {
+			Current        CurvePoints
+			Tuning         config.CurveTuning
+			Recommendation *CurveRecommendation
+			Live           *CurveRecommendation
+		}{
+			Current:        currentCurve(),
+			Tuning:         ctrlConfig.Heating.Tuning,
+			Recommendation: dutyTracker.Recommendation,
+			Live:           dutyTracker.recommend(),
+		}, "", "    ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(bytes)
+	}
+}
+
+func GetOverrides() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inputMutex.Lock()
+		defer inputMutex.Unlock()
+		bytes, err := json.MarshalIndent(inputs.Overrides, "", "    ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(bytes)
+	}
+}
+
+// GetDiagnostics returns the current sample window
+// and the delta-T baseline
+func GetDiagnostics() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inputMutex.Lock()
+		defer inputMutex.Unlock()
+		bytes, err := json.MarshalIndent(diagnostics, "", "    ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(bytes)
+	}
+}
+
+// PutOverride forces the mode, state, zone_call or window
+// until the requested time, for some minutes, or until cleared
+func PutOverride() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req controller.OverrideRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		inputMutex.Lock()
+		defer inputMutex.Unlock()
+
+		err = setOverride(r.PathValue("kind"), req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tryRunController()
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// DeleteOverride clears an override, use ?zone= for a single zone call
+func DeleteOverride() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inputMutex.Lock()
+		defer inputMutex.Unlock()
+
+		err := setOverride(r.PathValue("kind"), controller.OverrideRequest{
+			Value: "AUTO",
+			Zone:  r.URL.Query().Get("zone"),
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tryRunController()
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// ResetInterlock clears a tripped condensation interlock, it trips
+// again on the next check if the condition is still there
+func ResetInterlock() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inputMutex.Lock()
+		defer inputMutex.Unlock()
+		resetInterlock()
+		tryRunController()
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Hydronic fault detection, on the same samples as the compressor
+// diagnostics. Rules: near-zero delta-T while the compressor runs (no
+// flow), the buffer tank drifting away from its target while heating
+// (the outdoor reset supply target when enabled, BUFFER_TANK_SETPOINT
+// otherwise), and HP_CIRCULATOR disagreeing with the zone call outside
+// of DHW priority. Statistical: the delta-T while running steadily is
+// compared with its learned baseline
+
+var hydronicRegisters = []string{
+	"HP_WATER_DELTA-T",
+	"HP_ENTERING_WATER_TEMP",
+	"HP_EXITING_WATER_TEMP",
+	"BUFFER_TANK_TEMP",
+	"BUFFER_TANK_SETPOINT",
+	"BUFFER_FLOW",
+	"HP_CIRCULATOR",
+}
+
+// finding categories
+const (
+	DiagNoDeltaT      = "no_delta_t"
+	DiagBufferDrift   = "buffer_drift"
+	DiagCirculator    = "stuck_circulator"
+	DiagDeltaTAnomaly = "delta_t_anomaly"
+)
+
+// how long a rule must hold before it is a fault
+const noDeltaTWindow = 5 * time.Minute
+const bufferDriftWindow = 30 * time.Minute
+const circulatorWindow = 5 * time.Minute
+
+// the compressor runs steadily this long after starting
+const steadyRuntime = 5 * time.Minute
+
+// delta-T baseline
+const baselineAlpha = 0.01
+const baselineWarmup = 240       // samples, an hour of steady running
+const baselineMinDeviation = 0.2 // °C
+const anomalyScore = 4           // standard deviations
+const anomalySamples = 3         // in a row
+
+func minDeltaT() float32 {
+	if ctrlConfig.Diagnostics.MinDeltaT > 0 {
+		return ctrlConfig.Diagnostics.MinDeltaT
+	}
+	return 1
+}
+
+func maxBufferDrift() float32 {
+	if ctrlConfig.Diagnostics.MaxBufferDrift > 0 {
+		return ctrlConfig.Diagnostics.MaxBufferDrift
+	}
+	return 5
+}
+
+// Baseline is an exponentially weighted mean and variance
+type Baseline struct {
+	Mean     float64
+	Variance float64
+	Count    int
+	Outliers int // in a row
+}
+
+// score returns how many standard deviations x is from the mean, and
+// whether it is an anomaly, before learning x
+func (b *Baseline) score(x float64) (float64, bool) {
+	defer b.learn(x)
+	if b.Count < baselineWarmup {
+		return 0, false
+	}
+	z := (x - b.Mean) / max(math.Sqrt(b.Variance), baselineMinDeviation)
+	if math.Abs(z) <= anomalyScore {
+		b.Outliers = 0
+		return z, false
+	}
+	b.Outliers++
+	return z, b.Outliers >= anomalySamples
+}
+
+func (b *Baseline) learn(x float64) {
+	if b.Count == 0 {
+		b.Mean = x
+	}
+	d := x - b.Mean
+	b.Mean += baselineAlpha * d
+	b.Variance = (1 - baselineAlpha) * (b.Variance + baselineAlpha*d*d)
+	b.Count++
+}
+
+func steady(s DiagnosticSample) bool {
+	runtime := time.Duration(s.SessionRuntime * float32(time.Minute))
+	return s.Running && !s.Defrost && runtime >= steadyRuntime
+}
+
+// diagnoseHydronics must be called with the inputMutex held,
+// before the sample is added to the window
+func diagnoseHydronics(s DiagnosticSample, report reportFunc) {
+	if !s.Hydronics {
+		return
+	}
+	if sustained(noDeltaTWindow, s, func(s DiagnosticSample) bool {
+		return s.Hydronics && steady(s) && abs(s.DeltaT) < minDeltaT()
+	}) {
+		report(DiagNoDeltaT, noDeltaTWindow, fmt.Sprintf(
+			"delta-T %.1f°C for %.0f minutes while the compressor runs, expected at least %.1f°C, check the flow (circulator, air, strainer)",
+			s.DeltaT, noDeltaTWindow.Minutes(), minDeltaT()))
+	}
+
+	if sustained(bufferDriftWindow, s, func(s DiagnosticSample) bool {
+		// the setpoint is the heating one, the tank is chilled in cool mode
+		return s.Hydronics && s.DX2WOn && s.Mode != DX2W_COOL &&
+			s.BufferSetpoint != 0 && abs(s.BufferT-s.BufferSetpoint) > maxBufferDrift()
+	}) {
+		report(DiagBufferDrift, bufferDriftWindow, fmt.Sprintf(
+			"buffer tank %.1f°C for %.0f minutes, the setpoint is %.1f°C",
+			s.BufferT, bufferDriftWindow.Minutes(), s.BufferSetpoint))
+	}
+
+	if sustained(circulatorWindow, s, func(s DiagnosticSample) bool {
+		// the circulator runs for the tank during DHW priority,
+		// while the zone calls are suspended
+		return s.Hydronics && s.DX2WOn && !s.DHWPriority && s.Circulator != s.ZoneCall
+	}) {
+		report(DiagCirculator, circulatorWindow, fmt.Sprintf(
+			"HP_CIRCULATOR is %s while the zone call is %s, for %.0f minutes",
+			onOff(s.Circulator), onOff(s.ZoneCall), circulatorWindow.Minutes()))
+	}
+
+	if steady(s) {
+		mean := diagnostics.DeltaT.Mean
+		z, anomaly := diagnostics.DeltaT.score(float64(s.DeltaT))
+		if anomaly {
+			report(DiagDeltaTAnomaly, time.Duration(anomalySamples)*diagnosticsPeriod+time.Minute, fmt.Sprintf(
+				"delta-T %.1f°C while running steadily, %.1f standard deviations from the usual %.1f°C",
+				s.DeltaT, z, mean))
+		}
+	}
+}
+
+// sustained is true when the condition held for every sample
+// of the window, which must be covered by the samples
+func sustained(window time.Duration, s DiagnosticSample, condition func(DiagnosticSample) bool) bool {
+	since := s.Time.Add(-window)
+	if len(diagnostics.Samples) == 0 || diagnostics.Samples[0].Time.After(since) {
+		return false
+	}
+	for _, sample := range samplesSince(since, s) {
+		if !condition(sample) {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(f float32) float32 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
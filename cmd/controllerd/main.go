@@ -10,13 +10,46 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 )
 
+// now is the controller clock, the simulator replaces it
+// to replay recorded or synthetic data faster than real time
+var now = time.Now
+
+var ctrlConfig config.Controller
+var publisher *mqtt.Client
+
 func main() {
 	configPath := flag.String("c", "", "Path to config file")
+	recordPath := flag.String("record", "", "Record mqtt inputs to file, for replay with -simulate")
+	simulatePath := flag.String("simulate", "", "Replay recorded inputs from file instead of running live")
+	syntheticDays := flag.Int("synthetic", 0, "Simulate this many days of synthetic weather and thermostat data")
+	syntheticStart := flag.String("start", "", "Start date of the synthetic data (YYYY-MM-DD), defaults to today")
+	timelinePath := flag.String("timeline", "", "Write the simulated decision timeline to file instead of stdout")
 	flag.Parse()
 
+	if *simulatePath != "" || *syntheticDays > 0 {
+		err := simulate(SimOpts{
+			ConfigPath:     *configPath,
+			RecordingPath:  *simulatePath,
+			SyntheticDays:  *syntheticDays,
+			SyntheticStart: *syntheticStart,
+			TimelinePath:   *timelinePath,
+		})
+		if err != nil {
+			fmt.Println("simulation failed:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	cfg := config.LoadV2(*configPath)
+	ctrlConfig = cfg.Controller
+	if err := checkDHWSchedule(ctrlConfig.DHW); err != nil {
+		fmt.Println("invalid config:", err)
+		os.Exit(1)
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
@@ -24,10 +57,41 @@ func main() {
 	fmt.Println("started")
 	defer fmt.Println("stopped")
 
-	initNotifyClient(cfg.ServiceHTTPAddresses.NtfyServer)
-	initPhidgetsClient(cfg.ServiceHTTPAddresses.Actuators)
+	if *recordPath != "" {
+		var err error
+		recorder, err = newRecorder(*recordPath)
+		if err != nil {
+			fmt.Println("failed to start recording:", err)
+			os.Exit(1)
+		}
+		defer recorder.close()
+	}
+
+	initStore(cfg)
+	initMetrics()
+	initActuators(ctx, cfg)
+	initDX2WClient(cfg)
 	go httpserver(ctx, cfg)
 
+	publisher = mqtt.NewClient(mqtt.Opts{
+		Context:     ctx,
+		Address:     cfg.Mqtt.Address,
+		User:        cfg.Mqtt.User,
+		Pass:        []byte(cfg.Mqtt.Pass),
+		ClientID:    "controllerd_publisher",
+		TopicPrefix: "burlo",
+	})
+	err := initNotifyClient(ctx, cfg)
+	if err != nil {
+		fmt.Println("invalid config:", err)
+		os.Exit(1)
+	}
+	initHomeAssistant(cfg)
+	go run_overrides(ctx)
+	go run_interlock(ctx)
+	go run_diagnostics(ctx)
+	go run_contacts(ctx, cfg)
+
 	mqtt.NewClient(mqtt.Opts{
 		Context:     ctx,
 		Address:     cfg.Mqtt.Address,
@@ -38,35 +102,54 @@ func main() {
 		Topics: []string{
 			"controller/thermostats/#",
 			"controller/humidistat/#",
+			"controller/dhw/#",
+			"controller/override/+",
 			"weather/current",
 			"weather/forecast",
 			"weather/aqhi",
 		},
 		OnPublishRecv: func(topic string, payload []byte) {
 			topic = strings.TrimPrefix(topic, "burlo/")
+			if recorder != nil {
+				recorder.record(topic, payload)
+			}
+			onMessage(topic, payload)
+		},
+	})
 
-			switch {
-			case strings.HasPrefix(topic, "controller/thermostats/"):
-				onThermostatUpdate(payload)
+	// waits for signal
+	<-ctx.Done()
+}
 
-			case strings.HasPrefix(topic, "controller/humidistat/"):
-				onThermostatUpdate(payload)
+// onMessage dispatches mqtt messages (without the "burlo/"
+// prefix) to their handlers, used both live and by the simulator
+func onMessage(topic string, payload []byte) {
+	switch {
+	case strings.HasPrefix(topic, "controller/thermostats/"):
+		onThermostatUpdate(payload)
 
-			case strings.HasPrefix(topic, "weather/current"):
-				onCurrentWeatherUpdate(payload)
+	case strings.HasPrefix(topic, "controller/humidistat/"):
+		onThermostatUpdate(payload)
 
-			case strings.HasPrefix(topic, "weather/forecast"):
-				onForecastUpdate(payload)
+	case strings.HasPrefix(topic, "controller/override/"):
+		onOverrideRequest(topic, payload)
 
-			case strings.HasPrefix(topic, "weather/aqhi"):
-				onAQHIUpdate(payload)
+	case strings.HasPrefix(topic, "controller/dhw/"):
+		onDHWUpdate(payload)
 
-			default:
-				fmt.Println("unhandled topic:", topic)
-			}
-		},
-	})
+	case strings.HasPrefix(topic, "weather/current"):
+		onCurrentWeatherUpdate(payload)
 
-	// waits for signal
-	<-ctx.Done()
+	case strings.HasPrefix(topic, "weather/forecast"):
+		onForecastUpdate(payload)
+
+	case strings.HasPrefix(topic, "weather/aqhi"):
+		onAQHIUpdate(payload)
+
+	case isContactTopic(topic):
+		onContactUpdate(topic, payload)
+
+	default:
+		fmt.Println("unhandled topic:", topic)
+	}
 }
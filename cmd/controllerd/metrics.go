@@ -0,0 +1,74 @@
+package main
+
+import (
+	"burlo/pkg/metrics"
+)
+
+// initMetrics exposes the controller inputs and outputs at /metrics
+func initMetrics() {
+	metrics.Collect(func(r *metrics.Registry) {
+		inputMutex.Lock()
+		defer inputMutex.Unlock()
+		collectInputs(r, inputs)
+		collectOutputs(r, currentState)
+	})
+}
+
+func collectInputs(r *metrics.Registry, inputs CtrlInput) {
+	gauge := func(name, help string, value float32, labels ...string) {
+		r.SetGauge("burlo_controller_"+name, help, float64(value), labels...)
+	}
+	gauge("indoor_temperature_celsius", "Indoor temperature used by the controller", inputs.Indoor.Temperature)
+	gauge("indoor_dewpoint_celsius", "Highest indoor dewpoint", inputs.Indoor.Dewpoint)
+	gauge("heat_setpoint_error_celsius", "Indoor temperature minus the heat setpoint", inputs.Indoor.HeatSetpointErr)
+	gauge("cool_setpoint_error_celsius", "Indoor temperature minus the cool setpoint", inputs.Indoor.CoolSetpointErr)
+	for zone, indoor := range inputs.Zones {
+		gauge("zone_temperature_celsius", "Zone temperature", indoor.Temperature, "zone", zone)
+		gauge("zone_dewpoint_celsius", "Zone dewpoint", indoor.Dewpoint, "zone", zone)
+	}
+
+	outdoor := inputs.Outdoor
+	gauge("outdoor_temperature_celsius", "Outdoor temperature", outdoor.Temperature)
+	gauge("outdoor_humidity_percent", "Outdoor relative humidity", outdoor.Humidity)
+	gauge("outdoor_dewpoint_celsius", "Outdoor dewpoint", outdoor.Dewpoint)
+	gauge("outdoor_24h_high_celsius", "Forecast high over the next 24h", outdoor.T24hHigh)
+	gauge("outdoor_24h_low_celsius", "Forecast low over the next 24h", outdoor.T24hLow)
+	gauge("outdoor_24h_mean_celsius", "Forecast mean over the next 24h", outdoor.T24hMean)
+	gauge("outdoor_aqhi", "Air quality health index", float32(outdoor.AQHI))
+	gauge("outdoor_wind_speed_kmh", "Wind speed", outdoor.WindSpeed)
+	gauge("outdoor_cloud_cover_percent", "Cloud cover", outdoor.CloudCover)
+	gauge("outdoor_precipitation_mm", "Precipitation", outdoor.Precipitation)
+	if !inputs.DHW.Time.IsZero() {
+		gauge("dhw_temperature_celsius", "Domestic hot water tank temperature", inputs.DHW.Temperature)
+	}
+	for name, h := range health {
+		r.SetGauge("burlo_controller_input_stale", "1 while the input is past its max age", metrics.Bool(h.Stale), "input", name)
+	}
+	for key := range inputs.Overrides {
+		r.SetGauge("burlo_controller_override_active", "1 while the override is set", 1, "override", key)
+	}
+}
+
+func collectOutputs(r *metrics.Registry, output CtrlOutput) {
+	state := func(name, help string, on bool, labels ...string) {
+		r.SetGauge("burlo_controller_"+name, help, metrics.Bool(on), labels...)
+	}
+	for _, mode := range []dx2wmode{DX2W_HEAT, DX2W_COOL} {
+		state("mode", "DX2W mode, 1 for the current mode", output.DX2W.Mode == mode, "mode", string(mode))
+	}
+	state("dx2w_on", "1 while the DX2W is on", output.DX2W.State == DX2W_ON)
+	state("window_open_advised", "1 while the windows should be open", output.Window == OPEN)
+	state("ventilation_favourable", "1 while the outdoor air helps", output.Ventilation.Favourable)
+	state("windows_open", "1 while a contact sensor reports an open window", output.Windows.Open)
+	state("window_openers", "1 while the window openers are open", output.Windows.Openers.On)
+	state("whole_house_fans", "1 while the whole house fans run", output.Windows.Fans.On)
+	state("erv_boost", "1 while the ERV is boosted", output.Windows.ERV.On)
+	state("zone_call", "1 while any zone calls", output.ZoneCall)
+	for zone, call := range output.ZoneCalls {
+		state("zone_call_by_zone", "1 while the zone calls", call, "zone", zone)
+	}
+	state("dhw_priority", "1 while the tank has priority", output.DHW.Priority)
+	state("interlock_tripped", "1 while the condensation interlock is tripped", output.Interlock.Tripped)
+	r.SetGauge("burlo_controller_supply_target_celsius", "Supply water target", float64(output.SupplyTarget))
+	r.SetGauge("burlo_controller_dewpoint_celsius", "Dewpoint output, with the stale margin", float64(output.Dewpoint))
+}
@@ -1,5 +1,11 @@
 package main
 
+import (
+	"burlo/pkg/models/controller"
+	"burlo/pkg/models/weather"
+	"time"
+)
+
 type wmode string
 type bitflag uint8
 
@@ -11,41 +17,59 @@ const AQHIReady bitflag = 0b1000
 type State struct {
 	Inputs  CtrlInput
 	Outputs CtrlOutput
+	Health  map[string]InputHealth
+}
+
+type IndoorInput struct {
+	Temperature     float32
+	Dewpoint        float32
+	HeatSetpointErr float32
+	CoolSetpointErr float32
 }
 
 type CtrlInput struct {
-	Ready  bitflag
-	Indoor struct {
-		Temperature     float32
-		Dewpoint        float32
-		HeatSetpointErr float32
-		CoolSetpointErr float32
-	}
+	Ready   bitflag // inputs received at least once
+	Stale   bitflag // inputs past their max age, see health.go
+	Indoor  IndoorInput
+	Zones   map[string]IndoorInput
 	Outdoor struct {
+		Temperature   float32
+		Humidity      float32
+		Dewpoint      float32
+		T24hHigh      float32
+		T24hLow       float32
+		T24hMean      float32
+		AQHI          int32
+		WindSpeed     float32
+		CloudCover    float32
+		Precipitation float32
+		// hourly, starting the hour after ForecastTime
+		Forecast     weather.Forecast
+		ForecastTime time.Time
+	}
+	DHW struct {
 		Temperature float32
-		Humidity    float32
-		Dewpoint    float32
-		T24hHigh    float32
-		T24hLow     float32
-		T24hMean    float32
-		AQHI        int32
+		Time        time.Time
 	}
-	ModeOverride  dx2wmode
-	StateOverride dx2wstate
+	Overrides map[string]controller.Override
+	Contacts  map[string]bool // window open, by contact sensor topic
+
+	// highest last known dewpoint of the stale sensors
+	StaleDewpoint float32
 }
 
 var OPEN wmode = "OPEN"
 var CLOSE wmode = "CLOSE"
 
 type CtrlOutput struct {
-	DX2W     DX2W
-	Window   wmode
-	Dewpoint float32
-	ZoneCall bool
-}
-
-func modelHeatLoad(outdoorTemp, indoorTemp float32) float32 {
-	const factor = 1000
-	dT := outdoorTemp - indoorTemp
-	return dT * factor
+	DX2W         DX2W
+	Window       wmode
+	Ventilation  Ventilation
+	Windows      WindowState
+	Dewpoint     float32
+	SupplyTarget float32
+	ZoneCall     bool // any zone calling
+	ZoneCalls    map[string]bool
+	DHW          DHWState
+	Interlock    Interlock
 }
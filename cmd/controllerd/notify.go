@@ -1,61 +1,129 @@
 package main
 
 import (
-	"burlo/pkg/ntfy"
+	"burlo/config"
+	"burlo/pkg/notification"
+	"context"
 	"fmt"
+	"strings"
+	"time"
 )
 
-var notify ntfy.Notify
+// event types, notification rules are matched by type
+const (
+	EventMode         = "mode"
+	EventState        = "state"
+	EventWindow       = "window"
+	EventManualWindow = "manual_window"
+	EventLowBattery   = "low_battery"
+	EventInputHealth  = "input_health"
+	EventCondensation = "condensation"
+	EventOverride     = "override"
+	EventDHW          = "dhw"
+	EventHeatingCurve = "heating_curve"
+	EventDiagnostics  = "diagnostics"
+)
+
+type notifier interface {
+	Notify(e notification.Event)
+}
+
+var notify notifier = nopNotifier{}
 
-func initNotifyClient(ntfyHost string) {
-	notify = ntfy.New(ntfyHost, "burlo")
+// nopNotifier drops notifications until a client is configured
+type nopNotifier struct{}
+
+func (nopNotifier) Notify(e notification.Event) {}
+
+// initNotifyClient must be called after the publisher is created
+func initNotifyClient(ctx context.Context, cfg config.ServiceConf) error {
+	topic := cfg.Notify.Topic
+	if topic == "" {
+		topic = "burlo"
+	}
+	transports := map[string]notification.Transport{
+		"ntfy": notification.NewNtfy(cfg.ServiceHTTPAddresses.NtfyServer, topic),
+		"mqtt": notification.NewMQTT(publisher, "notifications"),
+	}
+	if cfg.Notify.SMTP.Address != "" {
+		transports["smtp"] = notification.NewSMTP(cfg.Notify.SMTP)
+	}
+	if cfg.Notify.Webhook.URL != "" {
+		transports["webhook"] = notification.NewWebhook(cfg.Notify.Webhook.URL)
+	}
+	client, err := notification.New(cfg.Notify, transports)
+	if err != nil {
+		return fmt.Errorf("notify: %w", err)
+	}
+	go client.Run(ctx)
+	notify = client
+	return nil
 }
 
 func notifyMode(mode dx2wmode) {
 	if mode == DX2W_HEAT {
-		notify.Publish(
-			"Heating mode activated",
-			"Its getting chilly out there",
-			[]string{"house_with_garden", "fire"},
-		)
+		notify.Notify(notification.Event{
+			Type:    EventMode,
+			Title:   "Heating mode activated",
+			Message: "Its getting chilly out there",
+			Tags:    []string{"house_with_garden", "fire"},
+		})
 	} else {
-		notify.Publish(
-			"Cooling mode activated",
-			"Wow its hot out there",
-			[]string{"house_with_garden", "snowflake"},
-		)
+		notify.Notify(notification.Event{
+			Type:    EventMode,
+			Title:   "Cooling mode activated",
+			Message: "Wow its hot out there",
+			Tags:    []string{"house_with_garden", "snowflake"},
+		})
 	}
 }
 
 func notifyState(state dx2wstate) {
 	if state == DX2W_OFF {
-		notify.Publish(
-			"DX2W Standby",
-			"Saves energy when there is no need to heat or cool for long periods of time. "+
+		notify.Notify(notification.Event{
+			Type:  EventState,
+			Title: "DX2W Standby",
+			Message: "Saves energy when there is no need to heat or cool for long periods of time. " +
 				"Buffer temperature will not be maintained while in standby.",
-			[]string{"house_with_garden", "zzz"},
-		)
+			Tags: []string{"house_with_garden", "zzz"},
+		})
 	}
 }
 
-func notifyWindow(window wmode) {
-	if window == OPEN {
-		notify.Publish(
-			"Its nice out there!",
-			fmt.Sprintf("Now is a good time to open those windows and get some fresh air. %.1f°C, %.0f%% relH, AQHI: %d",
-				inputs.Outdoor.Temperature,
-				inputs.Outdoor.Humidity,
-				inputs.Outdoor.AQHI),
-			[]string{"house_with_garden", "sun_behind_small_cloud"},
-		)
+func notifyWindow(advice Ventilation) {
+	conditions := fmt.Sprintf("%.1f°C, %.0f%% relH, AQHI: %d. %s",
+		inputs.Outdoor.Temperature,
+		inputs.Outdoor.Humidity,
+		inputs.Outdoor.AQHI,
+		strings.Join(advice.Reasons, ", "))
+	if advice.Window == OPEN {
+		notify.Notify(notification.Event{
+			Type:    EventWindow,
+			Title:   "Its nice out there!",
+			Message: "Now is a good time to open those windows and get some fresh air. " + conditions,
+			Tags:    []string{"house_with_garden", "sun_behind_small_cloud"},
+		})
 	} else {
-		notify.Publish(
-			"Keep windows closed",
-			fmt.Sprintf("%.1f°C, %.0f%% relH, AQHI: %d",
-				inputs.Outdoor.Temperature,
-				inputs.Outdoor.Humidity,
-				inputs.Outdoor.AQHI),
-			[]string{"house_with_garden", "window"},
-		)
+		notify.Notify(notification.Event{
+			Type:    EventWindow,
+			Title:   "Keep windows closed",
+			Message: conditions,
+			Tags:    []string{"house_with_garden", "window"},
+		})
+	}
+}
+
+func notifyManualWindow(topic string, open bool, until time.Time) {
+	action := "closed"
+	if open {
+		action = "opened"
 	}
+	notify.Notify(notification.Event{
+		Type:  EventManualWindow,
+		Key:   topic,
+		Title: "Window " + action + " by hand",
+		Message: fmt.Sprintf("%s was %s, the window openers are left alone until %s",
+			topic, action, until.Format("15:04")),
+		Tags: []string{"house_with_garden", "window"},
+	})
 }
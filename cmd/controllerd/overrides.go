@@ -0,0 +1,227 @@
+package main
+
+import (
+	"burlo/config"
+	"burlo/pkg/models/controller"
+	"burlo/pkg/notification"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// overrideValues lists the values each override kind accepts
+var overrideValues = map[string][]string{
+	controller.OverrideMode:     {string(DX2W_HEAT), string(DX2W_COOL)},
+	controller.OverrideState:    {string(DX2W_ON), string(DX2W_OFF)},
+	controller.OverrideZoneCall: {"ON", "OFF"},
+	controller.OverrideWindow:   {string(OPEN), string(CLOSE)},
+}
+
+func (in CtrlInput) override(key string) (string, bool) {
+	override, ok := in.Overrides[key]
+	return override.Value, ok
+}
+
+func overrideKey(kind, zone string) string {
+	if kind == controller.OverrideZoneCall && zone != "" {
+		return kind + "/" + zone
+	}
+	return kind
+}
+
+// setOverride validates and applies an override request,
+// must be called with the inputMutex held
+func setOverride(kind string, req controller.OverrideRequest) error {
+	values, ok := overrideValues[kind]
+	if !ok {
+		return fmt.Errorf("unknown override '%s'", kind)
+	}
+	if req.Zone != "" && kind != controller.OverrideZoneCall {
+		return fmt.Errorf("only zone_call overrides apply to a zone")
+	}
+	if req.Zone != "" && !slices.ContainsFunc(zones(), func(z config.Zone) bool { return z.Name == req.Zone }) {
+		return fmt.Errorf("unknown zone '%s'", req.Zone)
+	}
+	key := overrideKey(kind, req.Zone)
+
+	value := strings.ToUpper(req.Value)
+	if value == "" || value == "AUTO" {
+		clearOverride(key)
+		return nil
+	}
+	if !slices.Contains(values, value) {
+		return fmt.Errorf("invalid %s override '%s', expected one of %v or AUTO", kind, req.Value, values)
+	}
+
+	override := controller.Override{
+		Value:  value,
+		Reason: req.Reason,
+		Since:  now(),
+		Until:  req.Until,
+	}
+	if override.Until.IsZero() && req.Minutes > 0 {
+		override.Until = now().Add(time.Duration(req.Minutes * float32(time.Minute)))
+	}
+	if !override.Until.IsZero() && !override.Until.After(now()) {
+		return fmt.Errorf("override must end in the future")
+	}
+	if inputs.Overrides == nil {
+		inputs.Overrides = make(map[string]controller.Override)
+	}
+	inputs.Overrides[key] = override
+	fmt.Printf("[controller] override %s=%s: %s\r\n", key, value, req.Reason)
+	publishOverrides()
+	return nil
+}
+
+func clearOverride(key string) {
+	if _, ok := inputs.Overrides[key]; !ok {
+		return
+	}
+	delete(inputs.Overrides, key)
+	fmt.Println("[controller] override cleared:", key)
+	publishOverrides()
+}
+
+// expireOverrides removes the overrides past their end time,
+// must be called with the inputMutex held
+func expireOverrides() {
+	for key, override := range inputs.Overrides {
+		if override.Until.IsZero() || now().Before(override.Until) {
+			continue
+		}
+		delete(inputs.Overrides, key)
+		notifyOverrideExpired(key, override)
+		publishOverrides()
+	}
+}
+
+// run_overrides publishes the restored overrides, then
+// expires overrides even when no inputs arrive
+func run_overrides(ctx context.Context) {
+	inputMutex.Lock()
+	publishOverrides()
+	inputMutex.Unlock()
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			inputMutex.Lock()
+			tryRunController()
+			inputMutex.Unlock()
+		}
+	}
+}
+
+// applyZoneCallOverrides forces the zone calls, a zone's
+// own override takes precedence over the all zones one
+func applyZoneCallOverrides(inputs CtrlInput, calls map[string]bool) map[string]bool {
+	overridden := make(map[string]bool)
+	for zone, call := range calls {
+		if value, ok := inputs.override(controller.OverrideZoneCall); ok {
+			call = value == "ON"
+		}
+		if value, ok := inputs.override(overrideKey(controller.OverrideZoneCall, zone)); ok {
+			call = value == "ON"
+		}
+		overridden[zone] = call
+	}
+	return overridden
+}
+
+// applyOverrides forces the overridden outputs while the inputs are
+// incomplete and the controller can't run, the other outputs are held.
+// Must be called with the inputMutex held
+func applyOverrides() {
+	if len(inputs.Overrides) == 0 {
+		return
+	}
+	output := currentState
+	if override, ok := inputs.override(controller.OverrideMode); ok {
+		output.DX2W.Mode = dx2wmode(override)
+		setOutputBool(OutHpMode, output.DX2W.Mode == DX2W_COOL)
+	}
+	if override, ok := inputs.override(controller.OverrideState); ok {
+		output.DX2W.State = dx2wstate(override)
+		set_dx2w_state(output.DX2W.State)
+	}
+	if override, ok := inputs.Overrides[controller.OverrideWindow]; ok {
+		output.Window = wmode(override.Value)
+		output.Ventilation.Window = output.Window
+		output.Ventilation.Reasons = []string{"manual override: " + override.Reason}
+		output.Windows = updateWindows(inputs, output, now())
+		setWindowOutputs(output.Windows)
+	}
+
+	calls := make(map[string]bool)
+	for _, zone := range zones() {
+		calls[zone.Name] = output.ZoneCalls[zone.Name]
+	}
+	output.ZoneCalls = applyZoneCallOverrides(inputs, calls)
+	if output.DX2W.Mode == DX2W_COOL && output.Interlock.Tripped {
+		output.ZoneCalls = cutZoneCalls(output.ZoneCalls)
+	}
+	output.ZoneCall = anyZoneCall(output.ZoneCalls)
+	setZoneOutputs(output.ZoneCalls)
+
+	currentState = output
+	publishStatus(output)
+}
+
+// onOverrideRequest handles controller/override/{kind} messages
+func onOverrideRequest(topic string, payload []byte) {
+	kind := strings.TrimPrefix(topic, "controller/override/")
+
+	var req controller.OverrideRequest
+	err := json.Unmarshal(payload, &req)
+	if err != nil {
+		fmt.Println("onOverrideRequest:", err)
+		return
+	}
+	inputMutex.Lock()
+	defer inputMutex.Unlock()
+
+	err = setOverride(kind, req)
+	if err != nil {
+		fmt.Println("onOverrideRequest:", err)
+		return
+	}
+	tryRunController()
+}
+
+func publishOverrides() {
+	if publisher == nil {
+		return
+	}
+	overrides := inputs.Overrides
+	if overrides == nil {
+		overrides = make(map[string]controller.Override)
+	}
+	const RETAIN = true
+	err := publisher.Publish(RETAIN, "controller/overrides", overrides)
+	if err != nil {
+		fmt.Println("[controller] publishOverrides:", err)
+	}
+}
+
+func notifyOverrideExpired(key string, override controller.Override) {
+	message := fmt.Sprintf("%s override (%s) set %s has expired, back to automatic control",
+		key, override.Value, override.Since.Format("Jan 2 15:04"))
+	if override.Reason != "" {
+		message += ". Reason: " + override.Reason
+	}
+	notify.Notify(notification.Event{
+		Type:    EventOverride,
+		Key:     key,
+		Title:   "Override expired",
+		Message: message,
+		Tags:    []string{"house_with_garden", "hourglass"},
+	})
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bufio"
+	"burlo/config"
+	"burlo/pkg/actuator"
+	"burlo/pkg/models/controller"
+	"burlo/pkg/models/weather"
+	"burlo/pkg/notification"
+	"burlo/pkg/psychro"
+	"burlo/pkg/weathergcca"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The simulator feeds recorded (see -record) or synthetic inputs through
+// the same handlers used live, with a simulated clock. Outputs go to fake
+// actuators and notifications are captured, the resulting decisions are
+// written as a csv timeline to check logic changes against a whole season.
+
+type SimOpts struct {
+	ConfigPath     string
+	RecordingPath  string
+	SyntheticDays  int
+	SyntheticStart string
+	TimelinePath   string
+}
+
+// simEvent is one recorded mqtt message
+type simEvent struct {
+	Time    time.Time
+	Topic   string
+	Payload json.RawMessage
+}
+
+type inputRecorder struct {
+	mutex sync.Mutex
+	file  *os.File
+	enc   *json.Encoder
+}
+
+var recorder *inputRecorder
+
+func newRecorder(path string) (*inputRecorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &inputRecorder{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+func (r *inputRecorder) record(topic string, payload []byte) {
+	if !json.Valid(payload) {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	err := r.enc.Encode(simEvent{time.Now(), topic, payload})
+	if err != nil {
+		fmt.Println("[recorder] failed to record:", err)
+	}
+}
+
+func (r *inputRecorder) close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.file.Close()
+}
+
+func readRecording(path string) ([]simEvent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var events []simEvent
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for nline := 1; scanner.Scan(); nline++ {
+		var event simEvent
+		err := json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, nline, err)
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(events, func(a, b simEvent) int {
+		return a.Time.Compare(b.Time)
+	})
+	return events, nil
+}
+
+// simNotifier captures notifications for the timeline
+type simNotifier struct {
+	timeline *simTimeline
+}
+
+func (n simNotifier) Notify(e notification.Event) {
+	n.timeline.notification(e.Title, e.Message)
+}
+
+type simDecision struct {
+	Mode     dx2wmode
+	State    dx2wstate
+	Window   wmode
+	ZoneCall bool
+}
+
+type simTimeline struct {
+	out     *csv.Writer
+	last    simDecision
+	started bool
+
+	lastTime time.Time
+	summary  struct {
+		start         time.Time
+		end           time.Time
+		modeChanges   int
+		stateChanges  int
+		windowChanges int
+		notifications int
+		zoneCallTime  time.Duration
+		windowOpen    time.Duration
+		dx2wOff       time.Duration
+	}
+}
+
+func newSimTimeline(w io.Writer) *simTimeline {
+	t := &simTimeline{out: csv.NewWriter(w)}
+	t.out.Write([]string{
+		"time", "event", "mode", "state", "window", "zone_call",
+		"outdoor_temp", "indoor_temp", "indoor_dewpoint", "t24h_mean", "supply_target", "note",
+	})
+	return t
+}
+
+func (t *simTimeline) row(event, note string) {
+	f := func(v float32) string {
+		return strconv.FormatFloat(float64(v), 'f', 1, 32)
+	}
+	t.out.Write([]string{
+		now().Format(time.RFC3339),
+		event,
+		string(currentState.DX2W.Mode),
+		string(currentState.DX2W.State),
+		string(currentState.Window),
+		strconv.FormatBool(currentState.ZoneCall),
+		f(inputs.Outdoor.Temperature),
+		f(inputs.Indoor.Temperature),
+		f(inputs.Indoor.Dewpoint),
+		f(inputs.Outdoor.T24hMean),
+		f(currentState.SupplyTarget),
+		note,
+	})
+}
+
+func (t *simTimeline) notification(title, message string) {
+	t.summary.notifications += 1
+	t.row("notify", title)
+}
+
+// update accumulates time spent in the previous decision
+// and writes a row when the decision changes
+func (t *simTimeline) update() {
+	current := simDecision{
+		Mode:     currentState.DX2W.Mode,
+		State:    currentState.DX2W.State,
+		Window:   currentState.Window,
+		ZoneCall: currentState.ZoneCall,
+	}
+	if t.summary.start.IsZero() {
+		t.summary.start = now()
+	}
+	if t.started {
+		elapsed := now().Sub(t.lastTime)
+		if t.last.ZoneCall {
+			t.summary.zoneCallTime += elapsed
+		}
+		if t.last.Window == OPEN {
+			t.summary.windowOpen += elapsed
+		}
+		if t.last.State == DX2W_OFF {
+			t.summary.dx2wOff += elapsed
+		}
+	}
+	t.lastTime = now()
+	t.summary.end = now()
+
+	// nothing to report until the controller has all its inputs
+	if !t.started && current.State == "" {
+		return
+	}
+	if t.started && current == t.last {
+		return
+	}
+	if t.started {
+		if current.Mode != t.last.Mode {
+			t.summary.modeChanges += 1
+		}
+		if current.State != t.last.State {
+			t.summary.stateChanges += 1
+		}
+		if current.Window != t.last.Window {
+			t.summary.windowChanges += 1
+		}
+	}
+	t.started = true
+	t.last = current
+	t.row("decision", "")
+}
+
+func (t *simTimeline) printSummary(w io.Writer) {
+	s := t.summary
+	total := s.end.Sub(s.start)
+	percent := func(d time.Duration) float64 {
+		if total <= 0 {
+			return 0
+		}
+		return 100 * d.Hours() / total.Hours()
+	}
+	fmt.Fprintf(w, "simulated %s to %s (%.1f days)\n", s.start.Format(time.DateTime), s.end.Format(time.DateTime), total.Hours()/24)
+	fmt.Fprintf(w, "  mode changes:   %d\n", s.modeChanges)
+	fmt.Fprintf(w, "  state changes:  %d (off %.1f%% of the time)\n", s.stateChanges, percent(s.dx2wOff))
+	fmt.Fprintf(w, "  window changes: %d (open %.1f%% of the time)\n", s.windowChanges, percent(s.windowOpen))
+	fmt.Fprintf(w, "  zone call:      %.1f%% of the time\n", percent(s.zoneCallTime))
+	fmt.Fprintf(w, "  notifications:  %d\n", s.notifications)
+	if rec := dutyTracker.Recommendation; rec != nil {
+		fmt.Fprintf(w, "  heating curve:  %s\n", rec)
+	}
+}
+
+func simulate(opts SimOpts) error {
+	var cfg config.ServiceConf
+	if opts.ConfigPath != "" {
+		cfg = config.LoadV2(opts.ConfigPath)
+	}
+	if err := checkDHWSchedule(cfg.Controller.DHW); err != nil {
+		return err
+	}
+
+	out := io.Writer(os.Stdout)
+	if opts.TimelinePath != "" {
+		file, err := os.Create(opts.TimelinePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	timeline := newSimTimeline(out)
+	defer timeline.out.Flush()
+
+	fakes := initSimulation(cfg)
+	notify = simNotifier{timeline}
+
+	var simTime time.Time
+	now = func() time.Time { return simTime }
+
+	if opts.RecordingPath != "" {
+		events, err := readRecording(opts.RecordingPath)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			simTime = event.Time
+			onMessage(event.Topic, event.Payload)
+			timeline.update()
+		}
+	} else {
+		start := time.Now().Truncate(24 * time.Hour)
+		if opts.SyntheticStart != "" {
+			var err error
+			start, err = time.ParseInLocation(time.DateOnly, opts.SyntheticStart, time.Local)
+			if err != nil {
+				return err
+			}
+		}
+		house := newSyntheticHouse(start)
+		end := start.Add(time.Duration(opts.SyntheticDays) * 24 * time.Hour)
+		for simTime = start; simTime.Before(end); simTime = simTime.Add(house.step) {
+			for _, event := range house.next(simTime, fakes) {
+				onMessage(event.Topic, event.Payload)
+				timeline.update()
+			}
+		}
+	}
+	timeline.out.Flush()
+
+	summaryOut := io.Writer(os.Stderr)
+	if opts.TimelinePath != "" {
+		summaryOut = os.Stdout
+	}
+	timeline.printSummary(summaryOut)
+	return timeline.out.Error()
+}
+
+// initSimulation resets the controller state and replaces
+// every output with a fake
+func initSimulation(cfg config.ServiceConf) map[string]*actuator.Fake {
+	inputMutex.Lock()
+	defer inputMutex.Unlock()
+
+	inputs = CtrlInput{
+		Overrides: make(map[string]controller.Override),
+	}
+	currentState = CtrlOutput{
+		DX2W:   DX2W{Mode: DX2W_AUTO},
+		Window: CLOSE,
+	}
+	thermostats = make(map[string]controller.Thermostat)
+	humidistats = make(map[string]controller.Thermostat)
+	health = make(map[string]InputHealth)
+	staleDewpoints = make(map[string]float32)
+
+	ctrlConfig = cfg.Controller
+	dutyTracker = DutyCycleTracker{}
+	stateStore = nil
+	publisher = nil
+	hass = nil
+	lastStatus = controller.Status{}
+	dx2w_client = nil
+	diagnostics = Diagnostics{}
+	faultLog = FaultLog{}
+	fakes := make(map[string]*actuator.Fake)
+	actuators = make(map[string]actuator.Actuator)
+	names := []string{OutCirculator, OutHpMode, OutDewpoint, dhwOutput()}
+	names = append(names, windowOutputs()...)
+	for _, zone := range zones() {
+		names = append(names, zone.Output)
+	}
+	for _, name := range names {
+		fakes[name] = actuator.NewFake(name)
+		actuators[name] = fakes[name]
+	}
+	return fakes
+}
+
+// syntheticHouse produces weather and thermostat data from a simple
+// climate model (Ottawa-like: cold winters, hot humid summers) and
+// a first order model of the house, which responds to the zone call
+type syntheticHouse struct {
+	step       time.Duration
+	indoorTemp float64
+	last       time.Time
+
+	nextThermostat time.Time
+	nextCurrent    time.Time
+	nextForecast   time.Time
+}
+
+func newSyntheticHouse(start time.Time) *syntheticHouse {
+	return &syntheticHouse{
+		step:       5 * time.Minute,
+		indoorTemp: 21,
+		last:       start,
+	}
+}
+
+func syntheticOutdoor(t time.Time) (temp, relH float32) {
+	day := float64(t.YearDay()) + float64(t.Hour())/24 + float64(t.Minute())/1440
+	hour := float64(t.Hour()) + float64(t.Minute())/60
+
+	seasonal := 6 - 16*math.Cos(2*math.Pi*(day-20)/365)
+	diurnal := 5 * math.Cos(2*math.Pi*(hour-15)/24)
+	// multi-day swings as weather systems pass through
+	swings := 4*math.Sin(2*math.Pi*day/5.3) + 2*math.Sin(2*math.Pi*day/2.1)
+
+	humidity := 70 - 15*math.Cos(2*math.Pi*(hour-15)/24) + 10*math.Sin(2*math.Pi*day/3.7)
+	humidity = min(max(humidity, 20), 100)
+
+	return float32(seasonal + diurnal + swings), float32(humidity)
+}
+
+func (h *syntheticHouse) next(t time.Time, fakes map[string]*actuator.Fake) []simEvent {
+	// first order house model, heat loss to the outdoors
+	// and heat added/removed by the zone when calling.
+	// Heating output depends on the supply temperature
+	const lossTimeConstant = 30.0 // hours
+	const heatingRate = 0.15      // degC per hour, per degC of supply above room
+	const heatingDefault = 2.0    // degC per hour, without outdoor reset
+	const coolingRate = 1.0       // degC per hour
+
+	outdoor, relH := syntheticOutdoor(t)
+	hours := t.Sub(h.last).Hours()
+	h.last = t
+
+	dT := (float64(outdoor) - h.indoorTemp) / lossTimeConstant
+	if fakes[OutCirculator].On() {
+		if fakes[OutHpMode].On() {
+			dT -= coolingRate
+		} else if supply := float64(currentState.SupplyTarget); supply > 0 {
+			dT += heatingRate * max(0, supply-h.indoorTemp)
+		} else {
+			dT += heatingDefault
+		}
+	}
+	h.indoorTemp += dT * hours
+
+	var events []simEvent
+	add := func(topic string, data interface{}) {
+		payload, _ := json.Marshal(data)
+		events = append(events, simEvent{t, topic, payload})
+	}
+
+	if !t.Before(h.nextForecast) {
+		var forecast weather.Forecast
+		for i := 1; i <= 24; i++ {
+			temp, relH := syntheticOutdoor(t.Add(time.Duration(i) * time.Hour))
+			forecast.Temperature = append(forecast.Temperature, temp)
+			forecast.RelHumidity = append(forecast.RelHumidity, relH)
+		}
+		add("weather/forecast", forecast)
+		add("weather/aqhi", weathergcca.AqhiForecast{
+			AQHI: []int{3},
+			Time: []time.Time{t},
+		})
+		h.nextForecast = t.Add(time.Hour)
+	}
+	if !t.Before(h.nextCurrent) {
+		add("weather/current", weather.Current{
+			Temperature: outdoor,
+			RelHumidity: relH,
+		})
+		h.nextCurrent = t.Add(15 * time.Minute)
+	}
+	if !t.Before(h.nextThermostat) {
+		indoorRelH := float32(45)
+		temp := float32(h.indoorTemp)
+		add("controller/thermostats/sim", controller.Thermostat{
+			ID:           "sim",
+			Name:         "simulated",
+			Time:         t,
+			Temperature:  temp,
+			Humidity:     indoorRelH,
+			Dewpoint:     psychro.Dewpoint(temp, indoorRelH),
+			HeatSetpoint: 20,
+			CoolSetpoint: 24,
+			Battery:      100,
+			LinkQuality:  100,
+		})
+		h.nextThermostat = t.Add(10 * time.Minute)
+	}
+	return events
+}
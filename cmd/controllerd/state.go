@@ -0,0 +1,106 @@
+package main
+
+import (
+	"burlo/config"
+	"burlo/pkg/models/controller"
+	"burlo/pkg/store"
+	"fmt"
+	"time"
+)
+
+// The controller state that must survive restarts: the DX2W mode and
+// when it last changed (the mode change debounce), the overrides, the
+// DHW priority lockout, the heating curve applied by the tuner, the
+// duty cycle history it learns from, and the fault log.
+
+var stateStore *store.Store
+
+type controllerState struct {
+	DX2W      DX2W
+	Overrides map[string]controller.Override
+	DHW       DHWState
+	Interlock Interlock
+}
+
+// appliedCurve is the heating curve set by the tuner, it is only
+// restored while the configured curve is still the one it replaced
+type appliedCurve struct {
+	Configured CurvePoints
+	Applied    CurvePoints
+}
+
+var configuredCurve CurvePoints
+var lastTrackerSave time.Time
+
+func initStore(cfg config.ServiceConf) {
+	stateStore = store.OpenOrMemory(cfg.Controller.StatePath, "[controller]")
+	configuredCurve = currentCurve()
+
+	inputMutex.Lock()
+	defer inputMutex.Unlock()
+
+	var state controllerState
+	if ok := loadState("controller", &state); ok {
+		currentState.DX2W = state.DX2W
+		currentState.DHW = state.DHW
+		currentState.Interlock = state.Interlock
+		if state.Overrides != nil {
+			inputs.Overrides = state.Overrides
+		}
+		fmt.Println("[controller] restored state:", state.DX2W, "since", state.DX2W.LastChange.Format(time.DateTime))
+	}
+
+	var curve appliedCurve
+	if ok := loadState("curve", &curve); ok && curve.Configured == configuredCurve {
+		ctrlConfig.Heating.ZeroLoadSupplyTemperature = curve.Applied.ZeroLoadSupply
+		ctrlConfig.Heating.DesignLoadSupplyTemperature = curve.Applied.DesignLoadSupply
+	}
+	loadState("duty_cycle", &dutyTracker)
+	loadState("faults", &faultLog)
+}
+
+func loadState(key string, v any) bool {
+	ok, err := stateStore.Get(key, v)
+	if err != nil {
+		fmt.Println("[controller] failed to load state:", err)
+	}
+	return ok && err == nil
+}
+
+// saveState is called after every controller run, the
+// store only writes to disk when something has changed
+func saveState(inputs CtrlInput, output CtrlOutput) {
+	if stateStore == nil {
+		return
+	}
+	putState("controller", controllerState{
+		DX2W:      output.DX2W,
+		Overrides: inputs.Overrides,
+		DHW:       output.DHW,
+		Interlock: output.Interlock,
+	})
+	putState("curve", appliedCurve{
+		Configured: configuredCurve,
+		Applied:    currentCurve(),
+	})
+
+	// the duty cycle history changes with every sample
+	if now().Sub(lastTrackerSave) >= time.Hour {
+		saveDutyTracker()
+	}
+}
+
+func saveDutyTracker() {
+	if stateStore == nil {
+		return
+	}
+	putState("duty_cycle", &dutyTracker)
+	lastTrackerSave = now()
+}
+
+func putState(key string, v any) {
+	err := stateStore.Put(key, v)
+	if err != nil {
+		fmt.Println("[controller] failed to save state:", err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// heatingCurve returns the target supply temperature for the outdoor
+// temperature, a straight line from the zero load point (no heat loss)
+// to the design load point (coldest design day). re: Heating Load Line
+func heatingCurve(outdoorTemp float32) float32 {
+	cfg := ctrlConfig.Heating
+
+	m := (cfg.DesignLoadSupplyTemperature - cfg.ZeroLoadSupplyTemperature) /
+		(cfg.DesignLoadOutdoorAirTemperature - cfg.ZeroLoadOutdoorAirTemperature)
+	b := cfg.ZeroLoadSupplyTemperature - m*cfg.ZeroLoadOutdoorAirTemperature
+	target := m*outdoorTemp + b
+
+	// no lower than the zero load supply temperature,
+	// and never above the max allowed in the system
+	target = max(target, cfg.ZeroLoadSupplyTemperature)
+	if cfg.MaxSupplyTemperature > 0 {
+		target = min(target, cfg.MaxSupplyTemperature)
+	}
+	return target
+}
+
+func outdoorResetEnabled() bool {
+	cfg := ctrlConfig.Heating
+	return cfg.OutdoorReset &&
+		cfg.DesignLoadOutdoorAirTemperature != cfg.ZeroLoadOutdoorAirTemperature
+}
+
+// selectSupplyTarget returns the heating supply temperature target,
+// or zero when the outdoor reset is not in control
+func selectSupplyTarget(inputs CtrlInput, current CtrlOutput) float32 {
+	if !outdoorResetEnabled() || current.DX2W.Mode != DX2W_HEAT {
+		return 0
+	}
+	return heatingCurve(inputs.Outdoor.Temperature)
+}
+
+// last supply target successfully written to the DX2W, in the
+// register's units (°F, whole degrees)
+var supplyTargetApplied float32
+
+func set_supply_target(target float32) {
+	if target == 0 {
+		return
+	}
+	register := ctrlConfig.Heating.SetpointRegister
+	if register == "" {
+		register = "ODR_TARGET_WATER_TEMP"
+	}
+	targetF := float32(math.Round(float64(celsiusToFahrenheit(target))))
+
+	publishSupplyTarget(target, targetF, register)
+
+	if dx2w_client == nil || targetF == supplyTargetApplied {
+		return
+	}
+	_, err := dx2w_client.Write(register, targetF)
+	if err != nil {
+		fmt.Printf("[controller] set_supply_target: failed to write %s: %v\r\n", register, err)
+		return
+	}
+	supplyTargetApplied = targetF
+}
+
+func publishSupplyTarget(target, targetF float32, register string) {
+	if publisher == nil {
+		return
+	}
+	const RETAIN = true
+	err := publisher.Publish(RETAIN, "controller/supply_target", struct {
+		Temperature  float32
+		TemperatureF float32
+		Outdoor      float32
+		Register     string
+	}{
+		Temperature:  target,
+		TemperatureF: targetF,
+		Outdoor:      inputs.Outdoor.Temperature,
+		Register:     register,
+	})
+	if err != nil {
+		fmt.Println("[controller] publishSupplyTarget:", err)
+	}
+}
+
+func celsiusToFahrenheit(celsius float32) float32 {
+	return celsius*9.0/5.0 + 32.0
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"burlo/config"
+	"burlo/pkg/psychro"
+	"fmt"
+	"time"
+)
+
+// The ventilation engine advises opening the windows when the outdoor
+// air helps: while heating when it is mild out, and while cooling when
+// the outdoor air carries less heat and moisture (enthalpy) than the
+// indoor air. It looks ahead in the forecast so windows are only opened
+// when they can stay open for a while, keeps them closed before rain,
+// and uses hysteresis and a minimum interval between changes.
+
+type Ventilation struct {
+	Window          wmode
+	Reasons         []string
+	Favourable      bool // the outdoor air helps, lockouts aside
+	FavourableHours int  // consecutive hours the outdoor air stays favourable
+	// rain or wind keep the windows closed,
+	// poor air quality stops all ventilation
+	WeatherLockout    bool
+	AirQualityLockout bool
+	IndoorEnthalpy    float32 // kJ/kg
+	OutdoorEnthalpy   float32 // kJ/kg
+	Since             time.Time
+}
+
+// outdoorAir is the current or forecast outdoor conditions
+type outdoorAir struct {
+	Temperature float32
+	Humidity    float32
+	Dewpoint    float32
+	CloudCover  float32
+}
+
+func ventilationConfig() config.Ventilation {
+	cfg := ctrlConfig.Ventilation
+	orDefault(&cfg.MaxAQHI, 5)
+	setDefault(&cfg.MinOutdoor, 18)
+	setDefault(&cfg.SunnyAllowance, 2)
+	setDefault(&cfg.MaxDewpoint, 16)
+	setDefault(&cfg.EnthalpyMargin, 2)
+	orDefault(&cfg.MaxWind, 40)
+	orDefault(&cfg.RainProbability, 50)
+	orDefault(&cfg.RainLookahead, 2)
+	orDefault(&cfg.MinHours, 2)
+	setDefault(&cfg.Hysteresis, 1)
+	setDefault(&cfg.MinInterval, 30)
+	return cfg
+}
+
+func orDefault[T int | float32](value *T, fallback T) {
+	if *value <= 0 {
+		*value = fallback
+	}
+}
+
+// setDefault is orDefault for the options where 0 is a valid value
+func setDefault[T int | float32](value **T, fallback T) {
+	if *value == nil {
+		*value = &fallback
+	}
+}
+
+// adviseVentilation decides if the windows should be open at time t
+func adviseVentilation(inputs CtrlInput, current CtrlOutput, t time.Time) Ventilation {
+	cfg := ventilationConfig()
+	open := current.Window == OPEN
+
+	indoorRelH := psychro.RelativeHumidity(inputs.Indoor.Temperature, inputs.Indoor.Dewpoint)
+	advice := Ventilation{
+		Window:          current.Window,
+		IndoorEnthalpy:  psychro.Enthalpy(inputs.Indoor.Temperature, indoorRelH),
+		OutdoorEnthalpy: psychro.Enthalpy(inputs.Outdoor.Temperature, inputs.Outdoor.Humidity),
+		Since:           current.Ventilation.Since,
+	}
+
+	forecast := forecastAir(inputs, t)
+	outdoor := outdoorAir{
+		Temperature: inputs.Outdoor.Temperature,
+		Humidity:    inputs.Outdoor.Humidity,
+		Dewpoint:    inputs.Outdoor.Dewpoint,
+		CloudCover:  inputs.Outdoor.CloudCover,
+	}
+	ok, reasons := favourable(inputs, current, outdoor, advice.IndoorEnthalpy, open, cfg)
+	if ok {
+		advice.FavourableHours = 1
+		for _, air := range forecast {
+			if ok, _ := favourable(inputs, current, air, advice.IndoorEnthalpy, open, cfg); !ok {
+				break
+			}
+			advice.FavourableHours += 1
+		}
+		// the forecast may not reach min_hours ahead
+		enough := advice.FavourableHours >= cfg.MinHours || advice.FavourableHours == len(forecast)+1
+		if open || enough {
+			advice.Favourable = true
+			reasons = append(reasons, fmt.Sprintf("favourable for %dh", advice.FavourableHours))
+		} else {
+			reasons = append(reasons, fmt.Sprintf("only favourable for %dh, not opening for less than %dh",
+				advice.FavourableHours, cfg.MinHours))
+		}
+	}
+
+	// lockouts close the windows right away
+	lockouts := advice.checkLockouts(inputs, t, cfg)
+	if len(lockouts) > 0 {
+		advice.Window = CLOSE
+		advice.Reasons = lockouts
+		return advice
+	}
+
+	window := CLOSE
+	if advice.Favourable {
+		window = OPEN
+	}
+	interval := time.Duration(*cfg.MinInterval) * time.Minute
+	if window != current.Window && t.Sub(advice.Since) < interval {
+		reasons = append(reasons, fmt.Sprintf("holding %s until %s",
+			current.Window, advice.Since.Add(interval).Format("15:04")))
+		window = current.Window
+	}
+	advice.Window = window
+	advice.Reasons = reasons
+	return advice
+}
+
+// forecastAir returns the forecast hours after t, the first
+// forecast hour is the hour after the forecast was received
+func forecastAir(inputs CtrlInput, t time.Time) []outdoorAir {
+	forecast := inputs.Outdoor.Forecast
+	skip := forecastOffset(inputs, t)
+	at := func(list []float32, i int) float32 {
+		if i < len(list) {
+			return list[i]
+		}
+		return 0
+	}
+	var air []outdoorAir
+	for i := skip; i < len(forecast.Temperature) && i < len(forecast.RelHumidity); i++ {
+		temp, relH := forecast.Temperature[i], forecast.RelHumidity[i]
+		air = append(air, outdoorAir{
+			Temperature: temp,
+			Humidity:    relH,
+			Dewpoint:    psychro.Dewpoint(temp, relH),
+			CloudCover:  at(forecast.CloudCover, i),
+		})
+	}
+	return air
+}
+
+// forecastOffset is the number of forecast hours already past at t
+func forecastOffset(inputs CtrlInput, t time.Time) int {
+	if inputs.Outdoor.ForecastTime.IsZero() {
+		return 0
+	}
+	return max(0, int(t.Sub(inputs.Outdoor.ForecastTime).Hours()))
+}
+
+// checkLockouts lists the reasons to keep the windows closed no
+// matter the temperature or humidity. Rain and wind only keep the
+// windows closed, poor air quality stops all ventilation
+func (v *Ventilation) checkLockouts(inputs CtrlInput, t time.Time, cfg config.Ventilation) []string {
+	var lockouts []string
+	// air quality health risk: Low (1-3) Moderate (4-6) High (7-10) Very high (above 10)
+	if inputs.Outdoor.AQHI > int32(cfg.MaxAQHI) {
+		v.AirQualityLockout = true
+		lockouts = append(lockouts, fmt.Sprintf("AQHI %d is above %d", inputs.Outdoor.AQHI, cfg.MaxAQHI))
+	}
+	if inputs.Outdoor.Precipitation > 0 {
+		v.WeatherLockout = true
+		lockouts = append(lockouts, fmt.Sprintf("raining (%.1fmm)", inputs.Outdoor.Precipitation))
+	}
+	if inputs.Outdoor.WindSpeed > cfg.MaxWind {
+		v.WeatherLockout = true
+		lockouts = append(lockouts, fmt.Sprintf("windy (%.0fkm/h)", inputs.Outdoor.WindSpeed))
+	}
+	probs := inputs.Outdoor.Forecast.ProbPrecipitation
+	skip := forecastOffset(inputs, t)
+	for i := 0; i < cfg.RainLookahead && skip+i < len(probs); i++ {
+		if prob := probs[skip+i]; prob >= cfg.RainProbability {
+			v.WeatherLockout = true
+			lockouts = append(lockouts, fmt.Sprintf("rain likely within %dh (%.0f%%)", i+1, prob))
+			break
+		}
+	}
+	return lockouts
+}
+
+// favourable decides if the outdoor air helps, open windows use
+// the hysteresis to stay open until conditions are worse
+func favourable(inputs CtrlInput, current CtrlOutput, air outdoorAir, indoorEnthalpy float32, open bool, cfg config.Ventilation) (bool, []string) {
+	var h float32
+	if open {
+		h = *cfg.Hysteresis
+	}
+	// important to take dewpoint into account, it can get very
+	// humid out and radiant cooling can't remove moisture
+	if air.Dewpoint > *cfg.MaxDewpoint+h {
+		return false, []string{fmt.Sprintf("too humid out, dewpoint %.1f°C", air.Dewpoint)}
+	}
+
+	switch current.DX2W.Mode {
+	case DX2W_HEAT:
+		minOutdoor := *cfg.MinOutdoor - h
+		sunny := air.CloudCover < 30
+		if sunny {
+			minOutdoor -= *cfg.SunnyAllowance
+		}
+		if air.Temperature < minOutdoor {
+			return false, []string{fmt.Sprintf("too cold out, %.1f°C", air.Temperature)}
+		}
+		reason := fmt.Sprintf("mild out, %.1f°C", air.Temperature)
+		if sunny {
+			reason += " and sunny"
+		}
+		return true, []string{reason}
+
+	case DX2W_COOL:
+		coolSetpoint := inputs.Indoor.Temperature - inputs.Indoor.CoolSetpointErr
+		heatSetpoint := inputs.Indoor.Temperature - inputs.Indoor.HeatSetpointErr
+		lowpoint := heatSetpoint + min(0, heatSetpoint-inputs.Indoor.Temperature) - 1
+
+		if air.Temperature < lowpoint-h {
+			return false, []string{fmt.Sprintf("too cold out, %.1f°C", air.Temperature)}
+		}
+		if air.Temperature > coolSetpoint+h {
+			return false, []string{fmt.Sprintf("too warm out, %.1f°C", air.Temperature)}
+		}
+		// open windows stay open while the outdoor air still helps
+		outdoorEnthalpy := psychro.Enthalpy(air.Temperature, air.Humidity)
+		margin := *cfg.EnthalpyMargin
+		if open {
+			margin = 0
+		}
+		if outdoorEnthalpy > indoorEnthalpy-margin {
+			return false, []string{fmt.Sprintf("outdoor air has more heat and moisture, %.1f vs %.1f kJ/kg indoors",
+				outdoorEnthalpy, indoorEnthalpy)}
+		}
+		return true, []string{fmt.Sprintf("outdoor air has less heat and moisture, %.1f vs %.1f kJ/kg indoors",
+			outdoorEnthalpy, indoorEnthalpy)}
+
+	default:
+		return false, []string{"heatpump mode not selected yet"}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"burlo/config"
+	"burlo/pkg/mqtt"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// The window and ventilation outputs follow the window advice:
+// motorized openers open the windows, whole house fans run only
+// once the windows are open, and the ERV/HRV boosts while the
+// outdoor air helps. Rain and wind close the windows and stop the
+// fans right away, poor air quality stops everything. Contact
+// sensors confirm the windows are open, pause the zone calls, and
+// detect windows moved by hand, which the openers then leave alone.
+
+type WindowState struct {
+	Open        bool            // any contact sensor reports open
+	Contacts    map[string]bool // open, by contact sensor topic
+	Openers     WindowOutput
+	Fans        WindowOutput
+	ERV         WindowOutput
+	ManualUntil time.Time
+}
+
+type WindowOutput struct {
+	On      bool
+	Changed time.Time
+}
+
+// set changes the output at time t, at most once per interval
+// unless it is stopping right away (lockouts, windows closed)
+func (out *WindowOutput) set(on, stop bool, t time.Time, interval time.Duration) {
+	if out.On == on {
+		return
+	}
+	if t.Sub(out.Changed) < interval && !(stop && !on) {
+		return
+	}
+	out.On = on
+	out.Changed = t
+}
+
+// openers take a while to move, contact changes within
+// this time of a change are not treated as manual
+const openerTravel = 2 * time.Minute
+
+func windowsConfig() config.Windows {
+	cfg := ctrlConfig.Windows
+	orDefault(&cfg.MinInterval, 15)
+	orDefault(&cfg.ManualHold, 120)
+	return cfg
+}
+
+func isContactTopic(topic string) bool {
+	return slices.Contains(ctrlConfig.Windows.Contacts, topic)
+}
+
+// run_contacts subscribes to the contact sensors,
+// they publish outside of the burlo prefix
+func run_contacts(ctx context.Context, cfg config.ServiceConf) {
+	contacts := cfg.Controller.Windows.Contacts
+	if len(contacts) == 0 {
+		return
+	}
+	mqtt.NewClient(mqtt.Opts{
+		Context:  ctx,
+		Address:  cfg.Mqtt.Address,
+		User:     cfg.Mqtt.User,
+		Pass:     []byte(cfg.Mqtt.Pass),
+		ClientID: "controllerd_contacts",
+		Topics:   contacts,
+		OnPublishRecv: func(topic string, payload []byte) {
+			if recorder != nil {
+				recorder.record(topic, payload)
+			}
+			onMessage(topic, payload)
+		},
+	})
+}
+
+func onContactUpdate(topic string, payload []byte) {
+	// zigbee2mqtt contact sensors report contact=true when closed
+	var data struct {
+		Contact *bool `json:"contact"`
+	}
+	err := json.Unmarshal(payload, &data)
+	if err != nil {
+		fmt.Println("onContactUpdate:", err)
+		return
+	}
+	if data.Contact == nil {
+		return
+	}
+	inputMutex.Lock()
+	defer inputMutex.Unlock()
+
+	if inputs.Contacts == nil {
+		inputs.Contacts = make(map[string]bool)
+	}
+	inputs.Contacts[topic] = !*data.Contact
+	tryRunController()
+}
+
+// updateWindows decides the window and ventilation outputs at time t
+func updateWindows(inputs CtrlInput, current CtrlOutput, t time.Time) WindowState {
+	cfg := windowsConfig()
+	advice := current.Ventilation
+	state := current.Windows
+	previous := state.Contacts
+
+	state.Contacts = make(map[string]bool, len(inputs.Contacts))
+	state.Open = false
+	for topic, open := range inputs.Contacts {
+		state.Contacts[topic] = open
+		state.Open = state.Open || open
+	}
+
+	// a window moved by hand, and not by the openers
+	if len(cfg.Openers) > 0 && t.Sub(state.Openers.Changed) > openerTravel {
+		for topic, open := range state.Contacts {
+			was, known := previous[topic]
+			if known && open != was && open != state.Openers.On {
+				state.ManualUntil = t.Add(time.Duration(cfg.ManualHold) * time.Minute)
+				notifyManualWindow(topic, open, state.ManualUntil)
+			}
+		}
+	}
+
+	// without contact sensors, the openers or the advice are trusted
+	confirmedOpen := state.Open
+	if len(cfg.Contacts) == 0 {
+		confirmedOpen = state.Openers.On || (len(cfg.Openers) == 0 && advice.Window == OPEN)
+	}
+
+	lockout := advice.WeatherLockout || advice.AirQualityLockout
+	openers := advice.Window == OPEN
+	if t.Before(state.ManualUntil) && !lockout {
+		openers = state.Openers.On
+	}
+	interval := time.Duration(cfg.MinInterval) * time.Minute
+	state.Openers.set(openers, lockout, t, interval)
+	state.Fans.set(advice.Window == OPEN && confirmedOpen, lockout || !confirmedOpen, t, interval)
+	state.ERV.set(advice.Favourable && !advice.AirQualityLockout, advice.AirQualityLockout, t, interval)
+	return state
+}
+
+func setWindowOutputs(state WindowState) {
+	cfg := ctrlConfig.Windows
+	for _, name := range cfg.Openers {
+		setOutputBool(name, state.Openers.On)
+	}
+	for _, name := range cfg.Fans {
+		setOutputBool(name, state.Fans.On)
+	}
+	for _, name := range cfg.ERV {
+		setOutputBool(name, state.ERV.On)
+	}
+}
+
+// windowOutputs lists every configured window and ventilation output
+func windowOutputs() []string {
+	cfg := ctrlConfig.Windows
+	return slices.Concat(cfg.Openers, cfg.Fans, cfg.ERV)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"burlo/config"
+	"burlo/pkg/models/controller"
+	"slices"
+)
+
+// Each zone has its own circulator (output) and thermostats, and calls
+// for heat or cooling independently. The heatpump mode, ventilation and
+// cooling supply dewpoint are still decided for the whole house.
+
+const defaultZone = "main"
+
+// zones returns the configured zones, or a single zone with
+// every thermostat driving the circulator output
+func zones() []config.Zone {
+	if len(ctrlConfig.Zones) > 0 {
+		return ctrlConfig.Zones
+	}
+	return []config.Zone{{Name: defaultZone, Output: OutCirculator}}
+}
+
+// zoneOf finds the zone a sensor belongs to, sensors not listed in
+// any zone belong to the first zone without thermostats (if any)
+func zoneOf(id string, dewpointOnly bool) (config.Zone, bool) {
+	all := zones()
+	for _, zone := range all {
+		members := zone.Thermostats
+		if dewpointOnly {
+			members = zone.Humidistats
+		}
+		if slices.Contains(members, id) {
+			return zone, true
+		}
+	}
+	for _, zone := range all {
+		if len(zone.Thermostats) == 0 {
+			return zone, true
+		}
+	}
+	return config.Zone{}, false
+}
+
+// updateIndoorInputs aggregates the thermostats and humidistats into
+// house wide and per-zone inputs. The house dewpoint is the max over
+// every sensor, since the cooling supply is shared by all zones
+func updateIndoorInputs(inputs *CtrlInput) {
+	zoneStats := make(map[string][]controller.Thermostat)
+	var all []controller.Thermostat
+	var maxDewpoint float32
+
+	for id, tstat := range thermostats {
+		all = append(all, tstat)
+		maxDewpoint = max(maxDewpoint, tstat.Dewpoint)
+		if zone, ok := zoneOf(id, false); ok {
+			zoneStats[zone.Name] = append(zoneStats[zone.Name], tstat)
+		}
+	}
+
+	inputs.Indoor = aggregateIndoor(all, config.Zone{})
+	inputs.Zones = make(map[string]IndoorInput)
+	for _, zone := range zones() {
+		if len(zoneStats[zone.Name]) == 0 {
+			continue
+		}
+		inputs.Zones[zone.Name] = aggregateIndoor(zoneStats[zone.Name], zone)
+	}
+
+	for id, hstat := range humidistats {
+		maxDewpoint = max(maxDewpoint, hstat.Dewpoint)
+		if zone, ok := zoneOf(id, true); ok {
+			if indoor, ok := inputs.Zones[zone.Name]; ok {
+				indoor.Dewpoint = max(indoor.Dewpoint, hstat.Dewpoint)
+				inputs.Zones[zone.Name] = indoor
+			}
+		}
+	}
+	inputs.Indoor.Dewpoint = maxDewpoint
+}
+
+// aggregateIndoor finds the mean temperature and setpoint errors and
+// the max dewpoint, using the zone setpoints instead of the thermostat
+// setpoints when they are configured
+func aggregateIndoor(tstats []controller.Thermostat, zone config.Zone) IndoorInput {
+	var indoor IndoorInput
+	if len(tstats) == 0 {
+		return indoor
+	}
+	for _, tstat := range tstats {
+		heatSetpoint, coolSetpoint := tstat.HeatSetpoint, tstat.CoolSetpoint
+		if zone.HeatSetpoint != 0 {
+			heatSetpoint = zone.HeatSetpoint
+		}
+		if zone.CoolSetpoint != 0 {
+			coolSetpoint = zone.CoolSetpoint
+		}
+		indoor.Dewpoint = max(indoor.Dewpoint, tstat.Dewpoint)
+		indoor.Temperature += tstat.Temperature
+		indoor.HeatSetpointErr += tstat.Temperature - heatSetpoint
+		indoor.CoolSetpointErr += tstat.Temperature - coolSetpoint
+	}
+	n := float32(len(tstats))
+	indoor.Temperature /= n
+	indoor.HeatSetpointErr /= n
+	indoor.CoolSetpointErr /= n
+	return indoor
+}
+
+// updateZoneCalls decides the call for each zone. Without a fresh
+// dewpoint from every sensor there are no cooling calls, and zones
+// without fresh thermostat data heat following the outdoor reset
+func updateZoneCalls(inputs CtrlInput, current CtrlOutput) map[string]bool {
+	calls := make(map[string]bool)
+	for _, zone := range zones() {
+		indoor, ok := inputs.Zones[zone.Name]
+		switch {
+		case current.DX2W.Mode == DX2W_COOL && inputs.Stale&(IndoorReady|DewpointStale) != 0:
+			calls[zone.Name] = false
+		case !ok:
+			calls[zone.Name] = current.DX2W.Mode == DX2W_HEAT &&
+				current.DX2W.State != DX2W_OFF && current.Window != OPEN &&
+				inputs.Stale&CurrentReady == 0 && inputs.Outdoor.Temperature < 16
+		default:
+			calls[zone.Name] = zoneCall(inputs, indoor, current)
+		}
+	}
+	return calls
+}
+
+// anyZoneCall is true when at least one zone is calling
+func anyZoneCall(calls map[string]bool) bool {
+	for _, call := range calls {
+		if call {
+			return true
+		}
+	}
+	return false
+}
+
+// setZoneOutputs drives each zone circulator
+func setZoneOutputs(calls map[string]bool) {
+	for _, zone := range zones() {
+		setOutputBool(zone.Output, calls[zone.Name])
+	}
+}
@@ -37,6 +37,7 @@ func (t Temperature) asFloat(unit Unit) float32 {
 
 type Dashboard struct {
 	Thermostats map[string]controller.Thermostat
+	Overrides   map[string]controller.Override
 	Weather     Weather
 	Setpoint    SetpointData
 	Unit        Unit
@@ -62,6 +63,7 @@ type SetpointData struct {
 func NewDashboard() Dashboard {
 	return Dashboard{
 		Thermostats: make(map[string]controller.Thermostat),
+		Overrides:   make(map[string]controller.Override),
 		Setpoint: SetpointData{
 			Mode:            Heat,
 			HeatingSetpoint: 20,
@@ -129,6 +131,13 @@ func (d *Dashboard) setThermostat(tstat controller.Thermostat) {
 	pushThermostatToDashboards(tstat)
 }
 
+func (d *Dashboard) setOverrides(overrides map[string]controller.Override) {
+	d.Mutex.Lock()
+	d.Overrides = overrides
+	d.Mutex.Unlock()
+	pushOverridesToDashboards(overrides)
+}
+
 func (d *Dashboard) updateTemperatureForcast(data weather.Forecast) {
 	if len(data.Temperature) == 0 {
 		fmt.Println("ERROR bad data from Temperature Forcast update")
@@ -169,11 +178,3 @@ func sliceMean(list []float32) float32 {
 	}
 	return sum / float32(len(list))
 }
-
-// func calculate_dewpoint_simple(temp, relH float32) float32 {
-// 	if relH >= 50 && temp >= 25 {
-// 		return temp - ((100 - relH) / 5)
-// 	} else {
-// 		return temp - ((100 - relH) / 4)
-// 	}
-// }
@@ -94,7 +94,8 @@ func (s *DashboardServer) RenderDashboard() http.HandlerFunc {
 	tmpl, err := template.ParseFiles(
 		filepath.Join(wwwpath, "templates/dashboard/main.html"),
 		filepath.Join(wwwpath, "templates/dashboard/setpoint.html"),
-		filepath.Join(wwwpath, "templates/dashboard/roomstats.html"))
+		filepath.Join(wwwpath, "templates/dashboard/roomstats.html"),
+		filepath.Join(wwwpath, "templates/dashboard/overrides.html"))
 	if err != nil {
 		panic(err)
 	}
@@ -103,6 +104,7 @@ func (s *DashboardServer) RenderDashboard() http.HandlerFunc {
 		Heading     string
 		Setpoint    SetpointData
 		Thermostats map[string]controller.Thermostat
+		Overrides   map[string]controller.Override
 		Unit        string
 		HostAddr    string
 	}
@@ -114,12 +116,14 @@ func (s *DashboardServer) RenderDashboard() http.HandlerFunc {
 			Unit:        "°C",
 			Setpoint:    s.dashboard.Setpoint,
 			Thermostats: s.dashboard.Thermostats,
+			Overrides:   s.dashboard.Overrides,
 		}
 		// reload the templates on each request ONLY in dev
 		tmpl, err = template.ParseFiles(
 			filepath.Join(wwwpath, "templates/dashboard/main.html"),
 			filepath.Join(wwwpath, "templates/dashboard/setpoint.html"),
-			filepath.Join(wwwpath, "templates/dashboard/roomstats.html"))
+			filepath.Join(wwwpath, "templates/dashboard/roomstats.html"),
+			filepath.Join(wwwpath, "templates/dashboard/overrides.html"))
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
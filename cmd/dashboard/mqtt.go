@@ -23,6 +23,7 @@ func (d *Dashboard) mqttListener(ctx context.Context, cfg config.ServiceConf) {
 		Topics: []string{
 			"burlo/controller/thermostats/#",
 			"burlo/controller/humidistat/#",
+			"burlo/controller/overrides",
 			"burlo/controller/setpoints/selected_tstat",
 			"burlo/controller/setpoints/heating",
 			"burlo/controller/setpoints/cooling",
@@ -44,6 +45,9 @@ func (d *Dashboard) handleMqttUpdates(topic string, payload []byte) {
 	case strings.HasPrefix(topic, "controller/thermostats/"):
 		d.onMqttThermostatsUpdate(payload)
 
+	case topic == "controller/overrides":
+		d.onMqttOverridesUpdate(payload)
+
 	case strings.HasPrefix(topic, "weather/current"):
 		d.onMqttCurrentWeatherUpdate(payload)
 
@@ -72,6 +76,16 @@ func (d *Dashboard) onMqttThermostatsUpdate(payload []byte) {
 	d.setThermostat(tstat)
 }
 
+func (d *Dashboard) onMqttOverridesUpdate(payload []byte) {
+	var overrides map[string]controller.Override
+	err := json.Unmarshal(payload, &overrides)
+	if err != nil {
+		fmt.Println("ERROR onMqttOverridesUpdate: invalid overrides data:", err, string(payload))
+		return
+	}
+	d.setOverrides(overrides)
+}
+
 func (d *Dashboard) onMqttForecastUpdate(payload []byte) {
 	var data weather.Forecast
 	err := json.Unmarshal(payload, &data)
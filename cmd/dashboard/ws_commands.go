@@ -16,6 +16,11 @@ func pushThermostatToDashboards(tstat controller.Thermostat) {
 	// ws.writeAll(tstat)
 }
 
+func pushOverridesToDashboards(overrides map[string]controller.Override) {
+	fmt.Println("pushOverridesToDashboards:", overrides)
+	// ws.writeAll(overrides)
+}
+
 func pushWeatherToDashboards(weather Weather) {
 	fmt.Println("pushWeatherToDashboards:", weather)
 	// ws.writeAll(weather)
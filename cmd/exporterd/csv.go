@@ -0,0 +1,78 @@
+package main
+
+import (
+	"burlo/config"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// csvFiles appends the samples to one file per source per day,
+// eg. dx2w-2024-07-01.csv. The columns are set when the file is
+// created, from the fields of its first sample
+type csvFiles struct {
+	dir     string
+	headers map[string][]string // by file path
+}
+
+func newCSV(cfg config.ExporterSink) *csvFiles {
+	return &csvFiles{dir: cfg.Path, headers: make(map[string][]string)}
+}
+
+func (c *csvFiles) Write(samples []Sample) (int, error) {
+	err := os.MkdirAll(c.dir, 0755)
+	if err != nil {
+		return 0, err
+	}
+	for i, sample := range samples {
+		name := fmt.Sprintf("%s-%s.csv", sample.Source, sample.Time.Format("2006-01-02"))
+		err := c.append(filepath.Join(c.dir, name), sample)
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(samples), nil
+}
+
+func (c *csvFiles) append(path string, sample Sample) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	header, ok := c.headers[path]
+	if !ok {
+		header = readHeader(file)
+	}
+	w := csv.NewWriter(file)
+	if header == nil {
+		header = append([]string{"time"}, sample.Names()...)
+		w.Write(header)
+	}
+	c.headers[path] = header
+
+	row := []string{sample.Time.Format("2006-01-02T15:04:05Z07:00")}
+	for _, name := range header[1:] {
+		value, ok := sample.Fields[name]
+		if !ok {
+			row = append(row, "")
+			continue
+		}
+		row = append(row, strconv.FormatFloat(value, 'f', -1, 64))
+	}
+	w.Write(row)
+	w.Flush()
+	return w.Error()
+}
+
+// readHeader reads the columns of an existing file, nil when empty
+func readHeader(file *os.File) []string {
+	header, err := csv.NewReader(file).Read()
+	if err != nil {
+		return nil
+	}
+	return header
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"burlo/config"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// emoncms posts each sample to its input api, the source is
+// the node and the sample time is kept for replays
+type emoncms struct {
+	address string
+	key     string
+}
+
+func newEmoncms(cfg config.ExporterSink) *emoncms {
+	return &emoncms{address: cfg.Address, key: cfg.Key}
+}
+
+func (e *emoncms) Write(samples []Sample) (int, error) {
+	for i, sample := range samples {
+		data, err := json.Marshal(sample.Fields)
+		if err != nil {
+			return i, err
+		}
+		query := url.Values{
+			"node":     {sample.Source},
+			"time":     {strconv.FormatInt(sample.Time.Unix(), 10)},
+			"apikey":   {e.key},
+			"fulljson": {string(data)},
+		}
+		resp, err := httpClient.Get(fmt.Sprintf("%s/input/post?%s", e.address, query.Encode()))
+		if err != nil {
+			return i, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != 200 {
+			return i, fmt.Errorf("emoncms: unexpected status: %s", resp.Status)
+		}
+	}
+	return len(samples), nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"burlo/config"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSample(t *testing.T) {
+	payload := `{
+		"NET_COP": {"Float32": 3.2, "Uint16": 32, "Bool": true, "Type": "UINT16", "Units": ""},
+		"COMPRESSOR_CALL": {"Float32": 1, "Uint16": 1, "Bool": true, "Type": "BOOL", "Units": ""},
+		"BUFFER_TANK_TEMP": {"Float32": 104.5, "Uint16": 1045, "Bool": true, "Type": "INT16", "Units": "°F"},
+		"ZoneCalls": {"main": true, "basement": false},
+		"Mode": "HEAT"
+	}`
+	sample, err := parseSample("dx2w", []byte(payload), time.Unix(1719835200, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{
+		"NET_COP":            3.2,
+		"COMPRESSOR_CALL":    1,
+		"BUFFER_TANK_TEMP":   104.5,
+		"ZoneCalls_main":     1,
+		"ZoneCalls_basement": 0,
+	}
+	if len(sample.Fields) != len(want) {
+		t.Errorf("expected %v, got %v", want, sample.Fields)
+	}
+	for name, value := range want {
+		if sample.Fields[name] != value {
+			t.Errorf("expected %s=%v, got %v", name, value, sample.Fields[name])
+		}
+	}
+	if sample.Units["BUFFER_TANK_TEMP"] != "°F" {
+		t.Errorf("expected the register units, got %v", sample.Units)
+	}
+
+	line := lineProtocol(Sample{Source: "dx2w", Time: sample.Time, Fields: map[string]float64{"BUFFER_TANK_TEMP": 104.5}, Units: sample.Units})
+	if line != "BUFFER_TANK_TEMP,device=dx2w,units=°F value=104.5 1719835200\n" {
+		t.Errorf("unexpected line protocol: %q", line)
+	}
+}
+
+type fakeSink struct {
+	down    bool
+	limit   int // fails after writing this many samples, when > 0
+	written []Sample
+}
+
+func (f *fakeSink) Write(samples []Sample) (int, error) {
+	if f.down {
+		return 0, errors.New("connection refused")
+	}
+	if f.limit > 0 && len(samples) > f.limit {
+		f.written = append(f.written, samples[:f.limit]...)
+		return f.limit, errors.New("connection reset")
+	}
+	f.written = append(f.written, samples...)
+	return len(samples), nil
+}
+
+// samples are buffered while the sink is down, and replayed
+// in order once it is back, only the most recent are kept
+func TestBufferedSink(t *testing.T) {
+	sink := &fakeSink{down: true}
+	buffered := newBufferedSink(config.ExporterSink{
+		Sources: []string{"dx2w"},
+		Fields:  []string{"NET_COP"},
+	}, sink, 3)
+
+	start := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		at := start.Add(time.Duration(i) * 15 * time.Second)
+		buffered.offer(Sample{Source: "dx2w", Time: at, Fields: map[string]float64{"NET_COP": float64(i), "HP_CT": 9}})
+		buffered.offer(Sample{Source: "controller", Time: at, Fields: map[string]float64{"NET_COP": 1}})
+		buffered.flush(at)
+	}
+	if len(sink.written) != 0 {
+		t.Fatalf("expected nothing written while down, got %v", sink.written)
+	}
+
+	sink.down = false
+	buffered.flush(start.Add(time.Minute)) // still backing off
+	if len(sink.written) != 0 {
+		t.Fatalf("expected the retry to wait, got %v", sink.written)
+	}
+	buffered.flush(start.Add(10 * time.Minute))
+
+	var got []string
+	for _, sample := range sink.written {
+		got = append(got, strings.Join(sample.Names(), ","))
+		if sample.Source != "dx2w" {
+			t.Errorf("expected only the dx2w source, got %s", sample.Source)
+		}
+	}
+	if len(sink.written) != 3 || sink.written[0].Fields["NET_COP"] != 2 || sink.written[2].Fields["NET_COP"] != 4 {
+		t.Errorf("expected the last 3 samples in order, got %v", sink.written)
+	}
+	if strings.Join(got, ";") != "NET_COP;NET_COP;NET_COP" {
+		t.Errorf("expected only the selected fields, got %v", got)
+	}
+}
+
+// a failure mid batch only retries the samples that weren't written
+func TestBufferedSinkPartialWrite(t *testing.T) {
+	sink := &fakeSink{limit: 2}
+	buffered := newBufferedSink(config.ExporterSink{}, sink, 10)
+
+	start := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		buffered.offer(Sample{Source: "dx2w", Time: start, Fields: map[string]float64{"NET_COP": float64(i)}})
+	}
+	buffered.flush(start)
+	if len(sink.written) != 2 || len(buffered.queue) != 3 {
+		t.Fatalf("expected 2 written and 3 queued, got %v and %v", sink.written, buffered.queue)
+	}
+
+	sink.limit = 0
+	buffered.flush(start.Add(10 * time.Minute))
+	if len(sink.written) != 5 {
+		t.Fatalf("expected each sample written once, got %v", sink.written)
+	}
+	for i, sample := range sink.written {
+		if sample.Fields["NET_COP"] != float64(i) {
+			t.Errorf("expected the samples in order, got %v", sink.written)
+			break
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"burlo/config"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// graphite sends the plaintext protocol over tcp,
+// eg. burlo.dx2w.NET_COP 3.2 1719835200
+type graphite struct {
+	address string
+	prefix  string
+}
+
+func newGraphite(cfg config.ExporterSink) *graphite {
+	return &graphite{address: cfg.Address, prefix: cfg.Prefix}
+}
+
+// Write sends the batch as one write, it is all or nothing
+func (g *graphite) Write(samples []Sample) (int, error) {
+	conn, err := net.DialTimeout("tcp", g.address, 10*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+
+	var lines strings.Builder
+	for _, sample := range samples {
+		for _, name := range sample.Names() {
+			path := []string{graphiteName(sample.Source), graphiteName(name)}
+			if g.prefix != "" {
+				path = append([]string{g.prefix}, path...)
+			}
+			fmt.Fprintf(&lines, "%s %v %d\n", strings.Join(path, "."), sample.Fields[name], sample.Time.Unix())
+		}
+	}
+	_, err = conn.Write([]byte(lines.String()))
+	if err != nil {
+		return 0, err
+	}
+	return len(samples), nil
+}
+
+// graphiteName replaces the path separator and whitespace
+var graphiteName = strings.NewReplacer(".", "_", " ", "_", "\t", "_", "\n", "_").Replace
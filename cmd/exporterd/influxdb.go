@@ -0,0 +1,74 @@
+package main
+
+import (
+	"burlo/config"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// influxdb writes to the InfluxDB v2 api in line protocol, as
+// before each field is a measurement tagged with the source
+// (device) and units, eg. NET_COP,device=dx2w value=3.2 1719835200
+type influxdb struct {
+	url   string
+	token string
+}
+
+func newInfluxDB(cfg config.ExporterSink) *influxdb {
+	query := url.Values{
+		"org":       {cfg.Org},
+		"bucket":    {cfg.Bucket},
+		"precision": {"s"},
+	}
+	return &influxdb{
+		url:   fmt.Sprintf("%s/api/v2/write?%s", cfg.Address, query.Encode()),
+		token: cfg.Key,
+	}
+}
+
+// Write posts the batch as one request, it is all or nothing
+func (i *influxdb) Write(samples []Sample) (int, error) {
+	var body bytes.Buffer
+	for _, sample := range samples {
+		body.WriteString(lineProtocol(sample))
+	}
+	req, err := http.NewRequest("POST", i.url, &body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Token "+i.token)
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return 0, fmt.Errorf("influxdb: unexpected status: %s %s", resp.Status, message)
+	}
+	return len(samples), nil
+}
+
+var measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+var tagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+func lineProtocol(sample Sample) string {
+	var lines strings.Builder
+	timestamp := strconv.FormatInt(sample.Time.Unix(), 10)
+	for _, name := range sample.Names() {
+		lines.WriteString(measurementEscaper.Replace(name))
+		lines.WriteString(",device=" + tagEscaper.Replace(sample.Source))
+		if units := sample.Units[name]; units != "" {
+			lines.WriteString(",units=" + tagEscaper.Replace(units))
+		}
+		lines.WriteString(" value=" + strconv.FormatFloat(sample.Fields[name], 'f', -1, 64))
+		lines.WriteString(" " + timestamp + "\n")
+	}
+	return lines.String()
+}
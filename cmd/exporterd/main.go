@@ -0,0 +1,74 @@
+package main
+
+import (
+	"burlo/config"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// exporterd: collects telemetry from the burlo services, by polling their
+// http apis (eg. /dx2w/registers, /controller/emoncms) or subscribing to
+// mqtt, and sends it to EmonCMS, InfluxDB, csv files or Graphite. Each sink
+// selects its sources and fields, and buffers the samples while it is
+// unreachable, replaying them once it is back.
+
+func main() {
+	configPath := flag.String("c", "", "Path to config file")
+	flag.Parse()
+
+	cfg := config.LoadV2(*configPath)
+	exporter := exporterConfig(cfg.Exporter)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Println("started")
+	defer fmt.Println("stopped")
+
+	var sinks []*bufferedSink
+	for _, sinkCfg := range exporter.Sinks {
+		sink, err := newSink(sinkCfg)
+		if err != nil {
+			fmt.Println("[exporter]", err)
+			os.Exit(1)
+		}
+		buffered := newBufferedSink(sinkCfg, sink, exporter.Buffer)
+		go buffered.run(ctx)
+		sinks = append(sinks, buffered)
+	}
+	export := func(sample Sample) {
+		for _, sink := range sinks {
+			sink.offer(sample)
+		}
+	}
+
+	interval := time.Duration(exporter.Interval) * time.Second
+	for _, source := range exporter.Sources {
+		switch {
+		case source.URL != "":
+			go poll(ctx, source, interval, export)
+		case source.Topic != "":
+			subscribe(ctx, cfg, source, export)
+		default:
+			fmt.Printf("[exporter] source '%s' has no url or topic\r\n", source.Name)
+		}
+	}
+
+	// waits for signal
+	<-ctx.Done()
+}
+
+func exporterConfig(cfg config.Exporter) config.Exporter {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 15
+	}
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = 24 * 60 * 60 / cfg.Interval
+	}
+	return cfg
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"burlo/config"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Sink sends samples to a time series store, the samples are in
+// order, and may be old ones being replayed after an outage. Write
+// returns how many were written, from the front, so that a failure
+// mid batch doesn't send the written ones again
+type Sink interface {
+	Write(samples []Sample) (int, error)
+}
+
+func newSink(cfg config.ExporterSink) (Sink, error) {
+	switch cfg.Type {
+	case "emoncms":
+		return newEmoncms(cfg), nil
+	case "influxdb":
+		return newInfluxDB(cfg), nil
+	case "csv":
+		return newCSV(cfg), nil
+	case "graphite":
+		return newGraphite(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown sink type '%s', expected emoncms, influxdb, csv or graphite", cfg.Type)
+	}
+}
+
+// samples sent per write, so a long replay is spread out
+const maxBatch = 100
+
+const minRetry = 15 * time.Second
+const maxRetry = 5 * time.Minute
+
+// bufferedSink selects the samples for its sink and queues them,
+// while the sink fails the queue keeps the most recent samples
+// and retries with backoff
+type bufferedSink struct {
+	cfg  config.ExporterSink
+	sink Sink
+	max  int
+
+	mutex   sync.Mutex
+	queue   []Sample
+	dropped int // samples dropped from the front of the queue
+	retry   time.Duration
+	retryAt time.Time
+	failing bool
+	wake    chan struct{}
+}
+
+func newBufferedSink(cfg config.ExporterSink, sink Sink, size int) *bufferedSink {
+	return &bufferedSink{
+		cfg:  cfg,
+		sink: sink,
+		max:  size,
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// offer queues the selected fields of the sample
+func (b *bufferedSink) offer(sample Sample) {
+	sample, ok := b.selectFields(sample)
+	if !ok {
+		return
+	}
+	b.mutex.Lock()
+	b.queue = append(b.queue, sample)
+	if len(b.queue) > b.max {
+		b.dropped += len(b.queue) - b.max
+		b.queue = b.queue[len(b.queue)-b.max:]
+	}
+	b.mutex.Unlock()
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (b *bufferedSink) selectFields(sample Sample) (Sample, bool) {
+	if len(b.cfg.Sources) > 0 && !slices.Contains(b.cfg.Sources, sample.Source) {
+		return sample, false
+	}
+	if len(b.cfg.Fields) == 0 {
+		return sample, true
+	}
+	selected := Sample{
+		Source: sample.Source,
+		Time:   sample.Time,
+		Fields: make(map[string]float64),
+		Units:  make(map[string]string),
+	}
+	for _, name := range b.cfg.Fields {
+		if value, ok := sample.Fields[name]; ok {
+			selected.Fields[name] = value
+			selected.Units[name] = sample.Units[name]
+		}
+	}
+	return selected, len(selected.Fields) > 0
+}
+
+func (b *bufferedSink) run(ctx context.Context) {
+	ticker := time.NewTicker(minRetry)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.wake:
+		case <-ticker.C:
+		}
+		b.flush(time.Now())
+	}
+}
+
+// flush writes the queue in batches, until it is empty or the sink
+// fails. The queue is not locked during writes, samples can be added
+// or dropped meanwhile
+func (b *bufferedSink) flush(t time.Time) {
+	for {
+		b.mutex.Lock()
+		if len(b.queue) == 0 || t.Before(b.retryAt) {
+			b.mutex.Unlock()
+			return
+		}
+		batch := slices.Clone(b.queue[:min(len(b.queue), maxBatch)])
+		dropped := b.dropped
+		b.mutex.Unlock()
+
+		written, err := b.sink.Write(batch)
+
+		b.mutex.Lock()
+		// the batch was at the front, unless some of it was dropped
+		sent := max(0, written-(b.dropped-dropped))
+		b.queue = b.queue[sent:]
+		if err != nil {
+			if !b.failing {
+				fmt.Printf("[exporter] %s: %v, buffering\r\n", b.cfg.Type, err)
+			}
+			b.failing = true
+			b.retry = min(max(2*b.retry, minRetry), maxRetry)
+			b.retryAt = t.Add(b.retry)
+			b.mutex.Unlock()
+			return
+		}
+		if b.failing {
+			fmt.Printf("[exporter] %s: back, replaying %d samples (%d dropped in total)\r\n", b.cfg.Type, len(b.queue)+sent, b.dropped)
+			b.failing = false
+		}
+		b.retry = 0
+		b.mutex.Unlock()
+	}
+}
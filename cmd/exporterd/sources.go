@@ -0,0 +1,149 @@
+package main
+
+import (
+	"burlo/config"
+	"burlo/pkg/mqtt"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Sample is one reading of a source
+type Sample struct {
+	Source string
+	Time   time.Time
+	Fields map[string]float64
+	Units  map[string]string // when the source reports them
+}
+
+// Names are the field names, sorted
+func (s Sample) Names() []string {
+	var names []string
+	for name := range s.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// poll fetches the source every interval, failures are
+// logged and retried on the next interval
+func poll(ctx context.Context, source config.ExporterSource, interval time.Duration, export func(Sample)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		sample, err := fetch(source)
+		if err != nil {
+			fmt.Printf("[exporter] %s: %v\r\n", source.Name, err)
+		} else {
+			export(sample)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func fetch(source config.ExporterSource) (Sample, error) {
+	resp, err := httpClient.Get(source.URL)
+	if err != nil {
+		return Sample{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Sample{}, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Sample{}, err
+	}
+	return parseSample(source.Name, body, time.Now())
+}
+
+// subscribe exports every message on the source topic
+func subscribe(ctx context.Context, cfg config.ServiceConf, source config.ExporterSource, export func(Sample)) {
+	mqtt.NewClient(mqtt.Opts{
+		Context:  ctx,
+		Address:  cfg.Mqtt.Address,
+		User:     cfg.Mqtt.User,
+		Pass:     []byte(cfg.Mqtt.Pass),
+		ClientID: "exporterd_" + source.Name,
+		Topics:   []string{source.Topic},
+		OnPublishRecv: func(topic string, payload []byte) {
+			sample, err := parseSample(source.Name, payload, time.Now())
+			if err != nil {
+				fmt.Printf("[exporter] %s: %s: %v\r\n", source.Name, topic, err)
+				return
+			}
+			export(sample)
+		},
+	})
+}
+
+// parseSample reads the numbers and booleans of a json object,
+// nested objects are flattened as parent_child, DX2W register
+// values ({"Float32": 1.5, "Units": "kW", ...}) are read as numbers
+func parseSample(source string, payload []byte, t time.Time) (Sample, error) {
+	var data map[string]interface{}
+	err := json.Unmarshal(payload, &data)
+	if err != nil {
+		return Sample{}, err
+	}
+	sample := Sample{
+		Source: source,
+		Time:   t,
+		Fields: make(map[string]float64),
+		Units:  make(map[string]string),
+	}
+	flatten(sample, "", data)
+	return sample, nil
+}
+
+func flatten(sample Sample, prefix string, data map[string]interface{}) {
+	for key, value := range data {
+		name := prefix + key
+		switch v := value.(type) {
+		case float64:
+			sample.Fields[name] = v
+		case bool:
+			sample.Fields[name] = boolValue(v)
+		case map[string]interface{}:
+			if number, ok := registerValue(v); ok {
+				sample.Fields[name] = number
+				if units, _ := v["Units"].(string); units != "" {
+					sample.Units[name] = units
+				}
+				continue
+			}
+			flatten(sample, name+"_", v)
+		}
+	}
+}
+
+// registerValue reads a dx2w.Value
+func registerValue(v map[string]interface{}) (float64, bool) {
+	number, ok := v["Float32"].(float64)
+	if !ok {
+		return 0, false
+	}
+	if v["Type"] == "BOOL" {
+		on, _ := v["Bool"].(bool)
+		return boolValue(on), true
+	}
+	return number, true
+}
+
+func boolValue(on bool) float64 {
+	if on {
+		return 1
+	}
+	return 0
+}
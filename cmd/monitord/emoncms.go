@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// emoncms writes values directly to feeds, by name,
+// creating the missing feeds (PHPFina, fixed interval)
+type emoncms struct {
+	address  string
+	key      string
+	tag      string
+	interval int
+	client   *http.Client
+	feeds    map[string]string // feed id, by name
+}
+
+func newEmoncms(address, key, tag string, interval int) *emoncms {
+	return &emoncms{
+		address:  address,
+		key:      key,
+		tag:      tag,
+		interval: interval,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		feeds:    make(map[string]string),
+	}
+}
+
+func (e *emoncms) get(path string, query url.Values, result interface{}) error {
+	query.Set("apikey", e.key)
+	resp, err := e.client.Get(fmt.Sprintf("%s/%s?%s", e.address, path, query.Encode()))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("emoncms %s: unexpected status: %s", path, resp.Status)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// loadFeeds finds the ids of the existing feeds
+func (e *emoncms) loadFeeds() error {
+	var feeds []struct {
+		ID   interface{} `json:"id"` // a string or a number
+		Name string      `json:"name"`
+		Tag  string      `json:"tag"`
+	}
+	err := e.get("feed/list.json", url.Values{}, &feeds)
+	if err != nil {
+		return err
+	}
+	for _, feed := range feeds {
+		if feed.Tag == e.tag {
+			e.feeds[feed.Name] = fmt.Sprint(feed.ID)
+		}
+	}
+	return nil
+}
+
+func (e *emoncms) feedID(name string) (string, error) {
+	if id, ok := e.feeds[name]; ok {
+		return id, nil
+	}
+	var result struct {
+		Success bool        `json:"success"`
+		FeedID  interface{} `json:"feedid"`
+		Message string      `json:"message"`
+	}
+	err := e.get("feed/create.json", url.Values{
+		"tag":     {e.tag},
+		"name":    {name},
+		"engine":  {"5"}, // PHPFina
+		"options": {fmt.Sprintf(`{"interval":%d}`, e.interval)},
+	}, &result)
+	if err != nil {
+		return "", err
+	}
+	if !result.Success {
+		return "", fmt.Errorf("failed to create feed %s: %s", name, result.Message)
+	}
+	id := fmt.Sprint(result.FeedID)
+	fmt.Printf("[monitor] created feed %s (%s)\r\n", name, id)
+	e.feeds[name] = id
+	return id, nil
+}
+
+// insert writes the values at time t, returns the first error
+// but still tries every feed
+func (e *emoncms) insert(values map[string]float64, t time.Time) error {
+	var first error
+	for name, value := range values {
+		id, err := e.feedID(name)
+		if err == nil {
+			err = e.get("feed/insert.json", url.Values{
+				"id":    {id},
+				"time":  {strconv.FormatInt(t.Unix(), 10)},
+				"value": {strconv.FormatFloat(value, 'f', -1, 64)},
+			}, nil)
+		}
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"burlo/pkg/dx2w"
+	"burlo/pkg/psychro"
+	"time"
+)
+
+// The feeds expected by the EmonCMS My Heatpump app, which
+// heatpumpmonitor.org reads. Power in W, energy in kWh (cumulative),
+// temperatures in °C, flow in L/min, flags are 0 or 1
+const (
+	FeedElec     = "heatpump_elec"
+	FeedElecKWh  = "heatpump_elec_kwh"
+	FeedHeat     = "heatpump_heat"
+	FeedHeatKWh  = "heatpump_heat_kwh"
+	FeedFlowT    = "heatpump_flowT"
+	FeedReturnT  = "heatpump_returnT"
+	FeedOutsideT = "heatpump_outsideT"
+	FeedRoomT    = "heatpump_roomT"
+	FeedTargetT  = "heatpump_targetT"
+	FeedFlowRate = "heatpump_flowrate"
+	FeedRunning  = "heatpump_running"
+	FeedCH       = "heatpump_ch"
+	FeedDHW      = "heatpump_dhw"
+	FeedCooling  = "heatpump_cooling"
+)
+
+// registers read from dx2wlogger
+var registerFields = []string{
+	"HP_INPUT_KW",
+	"HP_OUTPUT_KW",
+	"HP_KWH",
+	"HP_OUTPUT_KWH",
+	"HP_EXITING_WATER_TEMP",
+	"HP_ENTERING_WATER_TEMP",
+	"OUTSIDE_AIR_TEMP",
+	"BUFFER_FLOW",
+	"COMPRESSOR_CALL",
+	"COOLING_MODE",
+}
+
+// energy counters, by feed
+var counterRegisters = map[string]string{
+	FeedElecKWh: "HP_KWH",
+	FeedHeatKWh: "HP_OUTPUT_KWH",
+}
+
+// dx2wlogger reads the kWh registers every 10 minutes
+const counterMaxAge = 20 * time.Minute
+
+const litersPerGallon = 3.78541
+
+// controllerState is the part of /controller/state used here
+type controllerState struct {
+	Inputs struct {
+		Indoor struct {
+			Temperature float32
+		}
+	}
+	Outputs struct {
+		SupplyTarget float32
+		DHW          struct {
+			Priority bool
+		}
+	}
+}
+
+// Counter accumulates a kWh register, which resets (RESET_KWH_COUNTERS)
+// and wraps around, into a total that only increases
+type Counter struct {
+	Last   uint16
+	Total  float64
+	Valid  bool   // Last was read
+	Jump   uint16 // a reading too far from Last
+	Jumped bool
+}
+
+// a reading more than this above the last one is a bad read,
+// unless the next reading follows it
+const maxCounterStep = 100 // kWh
+
+// update adds the energy since the last reading
+func (c *Counter) update(raw uint16) {
+	if !c.Valid {
+		c.Last, c.Valid = raw, true
+		return
+	}
+	from := c.Last
+	delta := counterStep(from, raw)
+	if delta > maxCounterStep && c.Jumped {
+		// the register stayed after the jump (eg. monitord was stopped
+		// for a while), continue from there without counting the jump
+		from = c.Jump
+		delta = counterStep(from, raw)
+	}
+	if delta > maxCounterStep {
+		c.Jump, c.Jumped = raw, true
+		return
+	}
+	c.Last, c.Jumped = raw, false
+	c.Total += float64(delta)
+}
+
+// counterStep is the energy from last to raw
+func counterStep(last, raw uint16) int {
+	delta := int(raw) - int(last)
+	switch {
+	case delta < 0 && int(last)-int(raw) > 0x8000:
+		// wrapped around
+		delta += 0x10000
+	case delta < 0:
+		// reset, counted from zero since
+		delta = int(raw)
+	}
+	return delta
+}
+
+// freshRegisters drops the registers older than maxAge, so feeds aren't
+// written from the last values cached before dx2wlogger lost the DX2W
+func freshRegisters(registers map[string]dx2w.Value, t time.Time, maxAge time.Duration) map[string]dx2w.Value {
+	fresh := make(map[string]dx2w.Value)
+	for name, v := range registers {
+		age := maxAge
+		for _, register := range counterRegisters {
+			if name == register {
+				age = max(maxAge, counterMaxAge)
+			}
+		}
+		if t.Sub(v.Timestamp) <= age {
+			fresh[name] = v
+		}
+	}
+	return fresh
+}
+
+// deriveFeeds computes the feed values, feeds are left out when their
+// inputs are missing (ctrl is nil when the controller is unreachable)
+func deriveFeeds(registers map[string]dx2w.Value, ctrl *controllerState, counters map[string]*Counter) map[string]float64 {
+	feeds := make(map[string]float64)
+	value := func(name string) (float64, bool) {
+		v, ok := registers[name]
+		return float64(v.Float32), ok
+	}
+	temperature := func(feed, register string) {
+		if v, ok := registers[register]; ok {
+			feeds[feed] = float64(psychro.FahrenheitToCelsius(v.Float32))
+		}
+	}
+
+	if kw, ok := value("HP_INPUT_KW"); ok {
+		feeds[FeedElec] = kw * 1000
+	}
+	if kw, ok := value("HP_OUTPUT_KW"); ok {
+		feeds[FeedHeat] = kw * 1000
+	}
+	for feed, register := range counterRegisters {
+		v, ok := registers[register]
+		if !ok {
+			continue
+		}
+		counter := counters[feed]
+		counter.update(v.Uint16)
+		feeds[feed] = counter.Total
+	}
+	temperature(FeedFlowT, "HP_EXITING_WATER_TEMP")
+	temperature(FeedReturnT, "HP_ENTERING_WATER_TEMP")
+	temperature(FeedOutsideT, "OUTSIDE_AIR_TEMP")
+	// the configured buffer loop flow
+	if gpm, ok := value("BUFFER_FLOW"); ok {
+		feeds[FeedFlowRate] = gpm * litersPerGallon
+	}
+
+	running, ok := registers["COMPRESSOR_CALL"]
+	if !ok {
+		return feeds
+	}
+	cooling := registers["COOLING_MODE"].Bool
+	dhw := ctrl != nil && ctrl.Outputs.DHW.Priority
+	feeds[FeedRunning] = boolValue(running.Bool)
+	feeds[FeedCooling] = boolValue(running.Bool && cooling)
+	if ctrl == nil {
+		return feeds
+	}
+	feeds[FeedDHW] = boolValue(running.Bool && dhw)
+	feeds[FeedCH] = boolValue(running.Bool && !cooling && !dhw)
+	feeds[FeedRoomT] = float64(ctrl.Inputs.Indoor.Temperature)
+	feeds[FeedTargetT] = float64(ctrl.Outputs.SupplyTarget)
+	return feeds
+}
+
+func boolValue(on bool) float64 {
+	if on {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"burlo/pkg/dx2w"
+	"burlo/pkg/store"
+	"math"
+	"testing"
+	"time"
+)
+
+// the totals keep increasing across register resets and wrap around,
+// and ignore bad reads
+func TestCounter(t *testing.T) {
+	var c Counter
+	for _, raw := range []uint16{1200, 1205, 1210, 3, 7, 65534, 2, 5000, 4} {
+		c.update(raw)
+	}
+	// 1200 is the start, +5 +5, reset +3 +4, bad read (65534),
+	// 7 to 2 is a reset: +2, bad read (5000), +2
+	if c.Total != 21 || c.Last != 4 {
+		t.Errorf("expected total 21 (last 4), got %v (last %d)", c.Total, c.Last)
+	}
+
+	c = Counter{Last: 65530, Valid: true}
+	c.update(5)
+	if c.Total != 11 {
+		t.Errorf("expected the wrap around to add 11, got %v", c.Total)
+	}
+
+	// a jump that stays is the new baseline, after a long gap
+	c = Counter{Last: 1210, Valid: true}
+	for _, raw := range []uint16{1500, 1500, 1501, 1503} {
+		c.update(raw)
+	}
+	if c.Total != 3 || c.Last != 1503 {
+		t.Errorf("expected total 3 (last 1503), got %v (last %d)", c.Total, c.Last)
+	}
+}
+
+func TestFreshRegisters(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	registers := map[string]dx2w.Value{
+		"HP_INPUT_KW":     {Float32: 1.5, Timestamp: now.Add(-10 * time.Second)},
+		"HP_OUTPUT_KW":    {Float32: 4.8, Timestamp: now.Add(-5 * time.Minute)},
+		"HP_KWH":          {Uint16: 100, Timestamp: now.Add(-5 * time.Minute)},
+		"HP_OUTPUT_KWH":   {Uint16: 300, Timestamp: now.Add(-time.Hour)},
+		"COMPRESSOR_CALL": {Bool: true, Type: "BOOL"},
+	}
+	fresh := freshRegisters(registers, now, 30*time.Second)
+	if len(fresh) != 2 || fresh["HP_INPUT_KW"].Float32 != 1.5 || fresh["HP_KWH"].Uint16 != 100 {
+		t.Errorf("expected HP_INPUT_KW and HP_KWH, got %v", fresh)
+	}
+}
+
+func TestDeriveFeeds(t *testing.T) {
+	registers := map[string]dx2w.Value{
+		"HP_INPUT_KW":            {Float32: 1.5},
+		"HP_OUTPUT_KW":           {Float32: 4.8},
+		"HP_KWH":                 {Float32: 100, Uint16: 100},
+		"HP_EXITING_WATER_TEMP":  {Float32: 104},
+		"HP_ENTERING_WATER_TEMP": {Float32: 95},
+		"BUFFER_FLOW":            {Float32: 10},
+		"COMPRESSOR_CALL":        {Bool: true, Type: "BOOL"},
+		"COOLING_MODE":           {Bool: false, Type: "BOOL"},
+	}
+	stateStore, _ := store.Open("")
+	counters := loadCounters(stateStore)
+	counters[FeedElecKWh].Total = 50
+	counters[FeedElecKWh].update(98)
+
+	var ctrl controllerState
+	ctrl.Inputs.Indoor.Temperature = 21
+	ctrl.Outputs.SupplyTarget = 40
+	feeds := deriveFeeds(registers, &ctrl, counters)
+
+	want := map[string]float64{
+		FeedElec:     1500,
+		FeedHeat:     4800,
+		FeedElecKWh:  52,
+		FeedFlowT:    40,
+		FeedReturnT:  35,
+		FeedFlowRate: 37.8541,
+		FeedRunning:  1,
+		FeedCH:       1,
+		FeedDHW:      0,
+		FeedCooling:  0,
+		FeedRoomT:    21,
+		FeedTargetT:  40,
+	}
+	if len(feeds) != len(want) {
+		t.Errorf("expected %v, got %v", want, feeds)
+	}
+	for feed, value := range want {
+		if math.Abs(feeds[feed]-value) > 0.001 {
+			t.Errorf("expected %s=%v, got %v", feed, value, feeds[feed])
+		}
+	}
+
+	feeds = deriveFeeds(registers, nil, counters)
+	if _, ok := feeds[FeedRoomT]; ok {
+		t.Errorf("expected no controller feeds without the controller, got %v", feeds)
+	}
+}
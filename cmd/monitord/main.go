@@ -0,0 +1,123 @@
+package main
+
+import (
+	"burlo/config"
+	"burlo/pkg/dx2w"
+	"burlo/pkg/store"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// monitord: derives the standard heatpump feeds (HeatPumpMonitor.org,
+// EmonCMS My Heatpump app) from the DX2W registers and the controller
+// state, and writes them to EmonCMS. The kWh registers are accumulated
+// into totals that survive counter resets and restarts.
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+func main() {
+	configPath := flag.String("c", "", "Path to config file")
+	flag.Parse()
+
+	cfg := config.LoadV2(*configPath)
+	monitor := monitorConfig(cfg.Monitor)
+	if monitor.Emoncms == "" {
+		fmt.Println("[monitor] no emoncms url configured")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Println("started")
+	defer fmt.Println("stopped")
+
+	stateStore := store.OpenOrMemory(monitor.StatePath, "[monitor]")
+	counters := loadCounters(stateStore)
+
+	registers := dx2w.NewHTTPClient(cfg.ServiceHTTPAddresses.Dx2Wlogger)
+	emon := newEmoncms(monitor.Emoncms, monitor.Key, monitor.Tag, monitor.Interval)
+	err := emon.loadFeeds()
+	if err != nil {
+		fmt.Println("[monitor] failed to list feeds:", err)
+	}
+
+	interval := time.Duration(monitor.Interval) * time.Second
+	// dx2wlogger reads the other registers every 15 seconds
+	maxAge := max(2*interval, 30*time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			ctrl, err := fetchControllerState(cfg.ServiceHTTPAddresses.Controller)
+			if err != nil {
+				fmt.Println("[monitor] failed to read controller state:", err)
+			}
+			values := freshRegisters(registers.Read(registerFields), now, maxAge)
+			if len(values) == 0 {
+				continue
+			}
+			feeds := deriveFeeds(values, ctrl, counters)
+			err = stateStore.Put("counters", counters)
+			if err != nil {
+				fmt.Println("[monitor] failed to save counters:", err)
+			}
+			err = emon.insert(feeds, now)
+			if err != nil {
+				fmt.Println("[monitor] failed to write feeds:", err)
+			}
+		}
+	}
+}
+
+func monitorConfig(cfg config.Monitor) config.Monitor {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10
+	}
+	if cfg.Tag == "" {
+		cfg.Tag = "heatpump"
+	}
+	return cfg
+}
+
+// loadCounters restores the kWh totals
+func loadCounters(s *store.Store) map[string]*Counter {
+	counters := make(map[string]*Counter)
+	_, err := s.Get("counters", &counters)
+	if err != nil {
+		fmt.Println("[monitor] failed to load counters:", err)
+	}
+	for feed := range counterRegisters {
+		if counters[feed] == nil {
+			counters[feed] = &Counter{}
+		}
+	}
+	return counters
+}
+
+func fetchControllerState(address string) (*controllerState, error) {
+	resp, err := httpClient.Get(fmt.Sprintf("http://%s/controller/state", address))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	var state controllerState
+	err = json.NewDecoder(resp.Body).Decode(&state)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
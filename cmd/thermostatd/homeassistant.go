@@ -0,0 +1,120 @@
+package main
+
+import (
+	"burlo/config"
+	"burlo/pkg/homeassistant"
+	"burlo/pkg/models/controller"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// thermostats are climate entities in Home Assistant, changing
+// their target temperature range sets the heat and cool setpoints
+var hass *homeassistant.Client
+
+// initHomeAssistant must be called after the publisher is created
+func initHomeAssistant(cfg config.ServiceConf) {
+	hass = homeassistant.NewClient(cfg, publisher,
+		[]string{"thermostat/+/+"}, onHomeAssistantCommand)
+}
+
+func announceThermostat(tstat controller.Thermostat) {
+	topic := fmt.Sprintf("controller/thermostats/%s", tstat.ID)
+	device := homeassistant.Device{
+		Identifiers:  []string{"burlo_thermostat_" + tstat.ID},
+		Name:         tstat.Name,
+		Manufacturer: "burlo",
+		Model:        "thermostat",
+	}
+	id := homeassistant.ObjectID("thermostat", tstat.ID)
+	hass.Announce(
+		homeassistant.Entity{
+			Component:                    "climate",
+			ObjectID:                     id,
+			Name:                         "Thermostat",
+			Device:                       device,
+			Modes:                        []string{"heat_cool"},
+			ModeStateTopic:               homeassistant.StateTopic(topic),
+			ModeStateTemplate:            "heat_cool",
+			CurrentTemperatureTopic:      homeassistant.StateTopic(topic),
+			CurrentTemperatureTemplate:   homeassistant.JSONValue("Temperature"),
+			CurrentHumidityTopic:         homeassistant.StateTopic(topic),
+			CurrentHumidityTemplate:      homeassistant.JSONValue("Humidity"),
+			TemperatureLowStateTopic:     homeassistant.StateTopic(topic),
+			TemperatureLowStateTemplate:  homeassistant.JSONValue("HeatSetpoint"),
+			TemperatureLowCommandTopic:   homeassistant.CommandTopic("thermostat", tstat.ID, "heat_setpoint"),
+			TemperatureHighStateTopic:    homeassistant.StateTopic(topic),
+			TemperatureHighStateTemplate: homeassistant.JSONValue("CoolSetpoint"),
+			TemperatureHighCommandTopic:  homeassistant.CommandTopic("thermostat", tstat.ID, "cool_setpoint"),
+			TemperatureUnit:              "C",
+			MinTemp:                      10,
+			MaxTemp:                      35,
+			TempStep:                     0.5,
+		},
+		homeassistant.Sensor(device, id+"_dewpoint", "Dewpoint", topic, "Dewpoint", "°C", "temperature"),
+		homeassistant.Sensor(device, id+"_battery", "Battery", topic, "Battery", "%", "battery"),
+	)
+}
+
+func announceHumidistat(tstat controller.Thermostat) {
+	topic := fmt.Sprintf("controller/humidistat/%s", tstat.ID)
+	name := tstat.Name
+	if name == "" {
+		name = tstat.ID
+	}
+	device := homeassistant.Device{
+		Identifiers:  []string{"burlo_humidistat_" + tstat.ID},
+		Name:         name,
+		Manufacturer: "burlo",
+		Model:        "humidistat",
+	}
+	id := homeassistant.ObjectID("humidistat", tstat.ID)
+	hass.Announce(
+		homeassistant.Sensor(device, id+"_temperature", "Temperature", topic, "Temperature", "°C", "temperature"),
+		homeassistant.Sensor(device, id+"_humidity", "Humidity", topic, "Humidity", "%", "humidity"),
+		homeassistant.Sensor(device, id+"_dewpoint", "Dewpoint", topic, "Dewpoint", "°C", "temperature"),
+		homeassistant.Sensor(device, id+"_battery", "Battery", topic, "Battery", "%", "battery"),
+	)
+}
+
+// onHomeAssistantCommand handles thermostat/{id}/heat_setpoint
+// and thermostat/{id}/cool_setpoint
+func onHomeAssistantCommand(topic string, payload []byte) {
+	parts := strings.Split(topic, "/")
+	if len(parts) != 3 {
+		fmt.Println("[homeassistant] unhandled command:", topic)
+		return
+	}
+	id, setpoint := parts[1], parts[2]
+	value, err := strconv.ParseFloat(strings.TrimSpace(string(payload)), 32)
+	if err != nil {
+		fmt.Println("[homeassistant] invalid setpoint:", err)
+		return
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	tstat, ok := thermostats[id]
+	if !ok {
+		fmt.Println("[homeassistant] unknown thermostat:", id)
+		return
+	}
+	setpoints := controller.Setpoints{
+		HeatSetpoint: tstat.HeatSetpoint,
+		CoolSetpoint: tstat.CoolSetpoint,
+	}
+	switch setpoint {
+	case "heat_setpoint":
+		setpoints.HeatSetpoint = float32(value)
+	case "cool_setpoint":
+		setpoints.CoolSetpoint = float32(value)
+	default:
+		fmt.Println("[homeassistant] unhandled command:", topic)
+		return
+	}
+	err = setSetpoints(&tstat, setpoints)
+	if err != nil {
+		fmt.Println("[homeassistant]", err)
+	}
+}
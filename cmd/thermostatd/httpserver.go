@@ -2,6 +2,8 @@ package main
 
 import (
 	"burlo/config"
+	"burlo/pkg/metrics"
+	"burlo/pkg/models/controller"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -27,7 +29,17 @@ func http_server(ctx context.Context, cfg config.ServiceConf) {
 
 	mux.HandleFunc("PUT /thermostat/{id}/name", PutThermostatName)
 	mux.HandleFunc("PUT /thermostat/{id}/setpoint", PutThermostatSetpoint)
+	mux.HandleFunc("PUT /thermostat/{id}/hold", PutThermostatHold)
+	mux.HandleFunc("DELETE /thermostat/{id}/hold", DeleteThermostatHold)
+	mux.HandleFunc("PUT /thermostat/{id}/schedule", PutThermostatSchedule)
+	mux.HandleFunc("DELETE /thermostat/{id}/schedule", DeleteThermostatSchedule)
 	mux.HandleFunc("GET /thermostats", GetThermostats)
+	mux.HandleFunc("GET /schedules", GetSchedules)
+	mux.HandleFunc("PUT /schedules/house", PutHouseSchedule)
+	mux.HandleFunc("DELETE /schedules/house", DeleteHouseSchedule)
+	mux.HandleFunc("PUT /away", PutAway)
+	mux.HandleFunc("DELETE /away", DeleteAway)
+	mux.HandleFunc("GET /metrics", metrics.Handler())
 
 	for {
 		fmt.Println("http server listening on", server.Addr)
@@ -71,6 +83,7 @@ func PutThermostatName(w http.ResponseWriter, r *http.Request) {
 	}
 	tstat.Name = req.Name
 	thermostats[id] = tstat
+	saveName(tstat)
 
 	publishThermostat(tstat)
 	w.WriteHeader(http.StatusOK)
@@ -99,12 +112,213 @@ func PutThermostatSetpoint(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	tstat.HeatSetpoint = req.HeatSetpoint
-	tstat.CoolSetpoint = req.CoolSetpoint
+	err = setSetpoints(&tstat, controller.Setpoints{
+		HeatSetpoint: req.HeatSetpoint,
+		CoolSetpoint: req.CoolSetpoint,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// PutThermostatHold overrides the setpoints until a time, or
+// for a number of hours, or until the next scheduled change
+func PutThermostatHold(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		HeatSetpoint float32   `json:"heat_setpoint"`
+		CoolSetpoint float32   `json:"cool_setpoint"`
+		Until        time.Time `json:"until,omitempty"`
+		Hours        float32   `json:"hours,omitempty"`
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	id := r.PathValue("id")
+	tstat, ok := thermostats[id]
+	if !ok {
+		http.Error(w, "unknown id", http.StatusBadRequest)
+		return
+	}
+	req.HeatSetpoint = tstat.HeatSetpoint
+	req.CoolSetpoint = tstat.CoolSetpoint
 
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hold := controller.Hold{
+		Setpoints: controller.Setpoints{
+			HeatSetpoint: req.HeatSetpoint,
+			CoolSetpoint: req.CoolSetpoint,
+		},
+		Until: req.Until,
+	}
+	err = validateSetpoints(hold.Setpoints)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	t := time.Now()
+	if hold.Until.IsZero() && req.Hours > 0 {
+		hold.Until = t.Add(time.Duration(req.Hours * float32(time.Hour)))
+	}
+	if hold.Until.IsZero() {
+		hold.Until = holdUntil(id, t)
+	}
+	if !hold.Until.After(t) {
+		http.Error(w, "hold must end in the future", http.StatusBadRequest)
+		return
+	}
+	schedules.Holds[id] = hold
+	saveSchedules()
+
+	applySetpoints(&tstat, t)
 	thermostats[id] = tstat
 	publishThermostat(tstat)
+	w.WriteHeader(http.StatusOK)
+}
+
+func DeleteThermostatHold(w http.ResponseWriter, r *http.Request) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	delete(schedules.Holds, r.PathValue("id"))
+	saveSchedules()
+	applyAllSetpoints(time.Now())
+	w.WriteHeader(http.StatusOK)
+}
+
+func GetSchedules(w http.ResponseWriter, r *http.Request) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	bytes, err := json.MarshalIndent(schedules, "", "    ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(bytes)
+}
+
+func decodeSchedule(r *http.Request) (*controller.Schedule, error) {
+	var schedule controller.Schedule
+	err := json.NewDecoder(r.Body).Decode(&schedule)
+	if err != nil {
+		return nil, err
+	}
+	return &schedule, validateSchedule(&schedule)
+}
+
+func PutHouseSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, err := decodeSchedule(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	schedules.House = schedule
+	saveSchedules()
+	applyAllSetpoints(time.Now())
+	w.WriteHeader(http.StatusOK)
+}
+
+func DeleteHouseSchedule(w http.ResponseWriter, r *http.Request) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	schedules.House = nil
+	saveSchedules()
+	applyAllSetpoints(time.Now())
+	w.WriteHeader(http.StatusOK)
+}
+
+func PutThermostatSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, err := decodeSchedule(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	id := r.PathValue("id")
+	if _, ok := thermostats[id]; !ok {
+		http.Error(w, "unknown id", http.StatusBadRequest)
+		return
+	}
+	schedules.Thermostats[id] = schedule
+	saveSchedules()
+	applyAllSetpoints(time.Now())
+	w.WriteHeader(http.StatusOK)
+}
+
+func DeleteThermostatSchedule(w http.ResponseWriter, r *http.Request) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	delete(schedules.Thermostats, r.PathValue("id"))
+	saveSchedules()
+	applyAllSetpoints(time.Now())
+	w.WriteHeader(http.StatusOK)
+}
+
+// PutAway sets back every thermostat until the return
+// time (minus recovery), or until cancelled
+func PutAway(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		HeatSetpoint  float32   `json:"heat_setpoint"`
+		CoolSetpoint  float32   `json:"cool_setpoint"`
+		Return        time.Time `json:"return,omitempty"`
+		RecoveryHours float32   `json:"recovery_hours,omitempty"`
+	}
+	// vacation setbacks
+	req.HeatSetpoint = 16
+	req.CoolSetpoint = 28
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	away := controller.Away{
+		Enabled: true,
+		Setpoints: controller.Setpoints{
+			HeatSetpoint: req.HeatSetpoint,
+			CoolSetpoint: req.CoolSetpoint,
+		},
+		Return:   req.Return,
+		Recovery: time.Duration(req.RecoveryHours * float32(time.Hour)),
+	}
+	err = validateSetpoints(away.Setpoints)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !away.Return.IsZero() && !away.Return.After(time.Now()) {
+		http.Error(w, "return must be in the future", http.StatusBadRequest)
+		return
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	schedules.Away = away
+	saveSchedules()
+	applyAllSetpoints(time.Now())
+	w.WriteHeader(http.StatusOK)
+}
+
+func DeleteAway(w http.ResponseWriter, r *http.Request) {
+	mutex.Lock()
+	defer mutex.Unlock()
 
+	schedules.Away = controller.Away{}
+	saveSchedules()
+	applyAllSetpoints(time.Now())
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -16,7 +16,8 @@ import (
 // thermostatd: collects temperature and humidity data from various sensors,
 // computes the dewpoint, and then writes the sensor data in a common format
 // to the controller mqtt topic. This service also allows setting thermostat
-// heat and cool setpoints, and change its name
+// heat and cool setpoints (directly, from weekly schedules, temporary
+// holds or away mode), and change its name
 
 var publisher *mqtt.Client
 
@@ -44,6 +45,11 @@ func main() {
 		TopicPrefix: "burlo",
 	})
 
+	initHomeAssistant(cfg)
+	initMetrics()
+	initStore(cfg)
+	initSchedules(cfg)
+	go run_schedules(ctx)
 	go monitor_sonoff_zigbee2mqtt(ctx, cfg)
 	go monitor_picosense_mqtt(ctx, cfg)
 	go http_server(ctx, cfg)
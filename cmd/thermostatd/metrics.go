@@ -0,0 +1,36 @@
+package main
+
+import (
+	"burlo/pkg/metrics"
+	"burlo/pkg/models/controller"
+	"time"
+)
+
+// last readings of the humidistats, for the metrics
+var humidistats = make(map[string]controller.Thermostat)
+
+func initMetrics() {
+	metrics.Collect(func(r *metrics.Registry) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		for _, tstat := range thermostats {
+			labels := []string{"id", tstat.ID, "name", tstat.Name, "kind", "thermostat"}
+			collectSensor(r, tstat, labels)
+			r.SetGauge("burlo_thermostat_heat_setpoint_celsius", "Heat setpoint", float64(tstat.HeatSetpoint), labels...)
+			r.SetGauge("burlo_thermostat_cool_setpoint_celsius", "Cool setpoint", float64(tstat.CoolSetpoint), labels...)
+		}
+		for _, tstat := range humidistats {
+			collectSensor(r, tstat, []string{"id", tstat.ID, "name", tstat.Name, "kind", "humidistat"})
+		}
+	})
+}
+
+func collectSensor(r *metrics.Registry, tstat controller.Thermostat, labels []string) {
+	r.SetGauge("burlo_thermostat_temperature_celsius", "Sensor temperature", float64(tstat.Temperature), labels...)
+	r.SetGauge("burlo_thermostat_humidity_percent", "Sensor relative humidity", float64(tstat.Humidity), labels...)
+	r.SetGauge("burlo_thermostat_dewpoint_celsius", "Sensor dewpoint", float64(tstat.Dewpoint), labels...)
+	r.SetGauge("burlo_thermostat_battery_percent", "Sensor battery", float64(tstat.Battery), labels...)
+	r.SetGauge("burlo_thermostat_link_quality", "Sensor link quality", float64(tstat.LinkQuality), labels...)
+	r.SetGauge("burlo_thermostat_age_seconds", "Time since the sensor reported", time.Since(tstat.Time).Seconds(), labels...)
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"burlo/config"
+	"burlo/pkg/models/controller"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Setpoints come from, in order of priority: a temporary hold,
+// the away mode setbacks, the thermostat's own weekly schedule,
+// the house schedule, and finally the manual setpoints
+
+const (
+	SourceManual = "manual"
+	SourceHold   = "hold"
+	SourceAway   = "away"
+)
+
+var defaultSetpoints = controller.Setpoints{HeatSetpoint: 20, CoolSetpoint: 24}
+
+var schedules = controller.Schedules{
+	Thermostats: make(map[string]*controller.Schedule),
+	Holds:       make(map[string]controller.Hold),
+	Manual:      make(map[string]controller.Setpoints),
+}
+var awayRecovery time.Duration
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+func initSchedules(cfg config.ServiceConf) {
+	awayRecovery = time.Duration(cfg.Thermostat.AwayRecovery * float32(time.Hour))
+
+	var loaded controller.Schedules
+	ok, err := stateStore.Get("schedules", &loaded)
+	if err != nil {
+		fmt.Println("failed to load schedules:", err)
+	}
+	if !ok || err != nil {
+		return
+	}
+	if loaded.Thermostats == nil {
+		loaded.Thermostats = make(map[string]*controller.Schedule)
+	}
+	if loaded.Holds == nil {
+		loaded.Holds = make(map[string]controller.Hold)
+	}
+	if loaded.Manual == nil {
+		loaded.Manual = make(map[string]controller.Setpoints)
+	}
+	schedules = loaded
+}
+
+// saveSchedules persists and publishes the schedules,
+// must be called with the mutex held
+func saveSchedules() {
+	publishSchedules()
+	err := stateStore.Put("schedules", schedules)
+	if err != nil {
+		fmt.Println("failed to save schedules:", err)
+	}
+}
+
+func publishSchedules() {
+	if publisher == nil {
+		return
+	}
+	const RETAIN = true
+	publisher.Publish(RETAIN, "controller/schedules", schedules)
+}
+
+// run_schedules applies schedule changes as time passes
+func run_schedules(ctx context.Context) {
+	mutex.Lock()
+	publishSchedules()
+	mutex.Unlock()
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-ticker.C:
+			mutex.Lock()
+			if expireSchedules(t) {
+				saveSchedules()
+			}
+			applyAllSetpoints(t)
+			mutex.Unlock()
+		}
+	}
+}
+
+// expireSchedules removes expired holds and ends away mode
+// once its return time has passed
+func expireSchedules(t time.Time) bool {
+	changed := false
+	for id, hold := range schedules.Holds {
+		if !t.Before(hold.Until) {
+			delete(schedules.Holds, id)
+			changed = true
+		}
+	}
+	away := schedules.Away
+	if away.Enabled && !away.Return.IsZero() && !t.Before(away.Return) {
+		schedules.Away = controller.Away{}
+		changed = true
+	}
+	return changed
+}
+
+// applyAllSetpoints publishes the thermostats whose setpoints changed
+func applyAllSetpoints(t time.Time) {
+	for id, tstat := range thermostats {
+		updated := tstat
+		applySetpoints(&updated, t)
+		if updated.HeatSetpoint != tstat.HeatSetpoint ||
+			updated.CoolSetpoint != tstat.CoolSetpoint ||
+			updated.SetpointSource != tstat.SetpointSource {
+			thermostats[id] = updated
+			publishThermostat(updated)
+		}
+	}
+}
+
+// setSetpoints changes the setpoints of a thermostat, while a schedule
+// or away mode is in control this holds them until the next scheduled
+// change. Must be called with the mutex held
+func setSetpoints(tstat *controller.Thermostat, setpoints controller.Setpoints) error {
+	err := validateSetpoints(setpoints)
+	if err != nil {
+		return err
+	}
+	t := time.Now()
+	switch tstat.SetpointSource {
+	case SourceManual, "":
+		schedules.Manual[tstat.ID] = setpoints
+	case SourceHold:
+		hold := schedules.Holds[tstat.ID]
+		hold.Setpoints = setpoints
+		schedules.Holds[tstat.ID] = hold
+	default:
+		schedules.Holds[tstat.ID] = controller.Hold{Setpoints: setpoints, Until: holdUntil(tstat.ID, t)}
+	}
+	saveSchedules()
+
+	applySetpoints(tstat, t)
+	thermostats[tstat.ID] = *tstat
+	publishThermostat(*tstat)
+	return nil
+}
+
+func applySetpoints(tstat *controller.Thermostat, t time.Time) {
+	setpoints, source := effectiveSetpoints(tstat.ID, t)
+	tstat.HeatSetpoint = setpoints.HeatSetpoint
+	tstat.CoolSetpoint = setpoints.CoolSetpoint
+	tstat.SetpointSource = source
+}
+
+func effectiveSetpoints(id string, t time.Time) (controller.Setpoints, string) {
+	if hold, ok := schedules.Holds[id]; ok && t.Before(hold.Until) {
+		return hold.Setpoints, SourceHold
+	}
+	if awayActive(t) {
+		return schedules.Away.Setpoints, SourceAway
+	}
+	schedule := schedules.Thermostats[id]
+	if schedule == nil {
+		schedule = schedules.House
+	}
+	if period, _, ok := scheduledPeriod(schedule, t); ok {
+		return schedule.Periods[period], period
+	}
+	if manual, ok := schedules.Manual[id]; ok {
+		return manual, SourceManual
+	}
+	return defaultSetpoints, SourceManual
+}
+
+// holds without an end time last until the next scheduled
+// change, or defaultHold when there is no schedule
+const defaultHold = 2 * time.Hour
+
+func holdUntil(id string, t time.Time) time.Time {
+	schedule := schedules.Thermostats[id]
+	if schedule == nil {
+		schedule = schedules.House
+	}
+	_, next, ok := scheduledPeriod(schedule, t)
+	if ok && !next.IsZero() && !awayActive(t) {
+		return next
+	}
+	return t.Add(defaultHold)
+}
+
+func awayActive(t time.Time) bool {
+	away := schedules.Away
+	if !away.Enabled {
+		return false
+	}
+	if away.Return.IsZero() {
+		return true
+	}
+	recovery := away.Recovery
+	if recovery == 0 {
+		recovery = awayRecovery
+	}
+	return t.Before(away.Return.Add(-recovery))
+}
+
+type scheduleSwitch struct {
+	time   time.Time
+	period string
+}
+
+// scheduledPeriod finds the period in effect at t,
+// and when the schedule next switches period
+func scheduledPeriod(schedule *controller.Schedule, t time.Time) (string, time.Time, bool) {
+	if schedule == nil || len(schedule.Weekly) == 0 {
+		return "", time.Time{}, false
+	}
+	// every switch from a week before until a week after t
+	var switches []scheduleSwitch
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	for d := -7; d <= 7; d++ {
+		day := midnight.AddDate(0, 0, d)
+		for _, entry := range schedule.Weekly {
+			if !slices.Contains(entry.Days, weekdays[day.Weekday()]) {
+				continue
+			}
+			h, m, err := parseClock(entry.Start)
+			if err != nil {
+				continue
+			}
+			switches = append(switches, scheduleSwitch{
+				// the wall clock time, days aren't 24h on DST changes
+				time:   time.Date(day.Year(), day.Month(), day.Day(), h, m, 0, 0, day.Location()),
+				period: entry.Period,
+			})
+		}
+	}
+	slices.SortFunc(switches, func(a, b scheduleSwitch) int {
+		return a.time.Compare(b.time)
+	})
+
+	var current, next *scheduleSwitch
+	for i := range switches {
+		if !switches[i].time.After(t) {
+			current = &switches[i]
+		} else if next == nil {
+			next = &switches[i]
+		}
+	}
+	if current == nil {
+		return "", time.Time{}, false
+	}
+	if next == nil {
+		return current.period, time.Time{}, true
+	}
+	return current.period, next.time, true
+}
+
+func parseClock(clock string) (int, int, error) {
+	var h, m int
+	_, err := fmt.Sscanf(clock, "%d:%d", &h, &m)
+	if err != nil || h < 0 || h > 23 || m < 0 || m > 59 {
+		return 0, 0, fmt.Errorf("invalid time '%s', expected HH:MM", clock)
+	}
+	return h, m, nil
+}
+
+func validateSchedule(schedule *controller.Schedule) error {
+	if len(schedule.Periods) == 0 {
+		return fmt.Errorf("schedule has no periods")
+	}
+	for name, period := range schedule.Periods {
+		err := validateSetpoints(period)
+		if err != nil {
+			return fmt.Errorf("period %s: %w", name, err)
+		}
+	}
+	for _, entry := range schedule.Weekly {
+		if _, ok := schedule.Periods[entry.Period]; !ok {
+			return fmt.Errorf("unknown period '%s'", entry.Period)
+		}
+		if _, _, err := parseClock(entry.Start); err != nil {
+			return err
+		}
+		if len(entry.Days) == 0 {
+			return fmt.Errorf("entry at %s has no days", entry.Start)
+		}
+		for i, day := range entry.Days {
+			day = strings.ToLower(day)
+			if !slices.Contains(weekdays, day) {
+				return fmt.Errorf("unknown day '%s', expected one of %v", day, weekdays)
+			}
+			entry.Days[i] = day
+		}
+	}
+	return nil
+}
+
+func validateSetpoints(setpoints controller.Setpoints) error {
+	valid := func(t float32) bool {
+		return t >= 10 && t <= 35
+	}
+	if !valid(setpoints.HeatSetpoint) || !valid(setpoints.CoolSetpoint) {
+		return fmt.Errorf("setpoints must be within 10-35°C")
+	}
+	if setpoints.HeatSetpoint > setpoints.CoolSetpoint {
+		return fmt.Errorf("heat setpoint must not be above the cool setpoint")
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"burlo/pkg/models/controller"
+	"burlo/pkg/store"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestEffectiveSetpoints(t *testing.T) {
+	comfort := controller.Setpoints{HeatSetpoint: 21, CoolSetpoint: 24}
+	sleep := controller.Setpoints{HeatSetpoint: 18, CoolSetpoint: 25}
+	away := controller.Setpoints{HeatSetpoint: 16, CoolSetpoint: 28}
+
+	house := &controller.Schedule{
+		Periods: map[string]controller.Setpoints{
+			controller.PeriodComfort: comfort,
+			controller.PeriodSleep:   sleep,
+		},
+		Weekly: []controller.ScheduleEntry{
+			{Days: []string{"Mon", "tue", "wed", "thu", "fri"}, Start: "06:30", Period: controller.PeriodComfort},
+			{Days: []string{"sun", "mon", "tue", "wed", "thu"}, Start: "22:00", Period: controller.PeriodSleep},
+		},
+	}
+	stateStore, _ = store.Open("")
+	if err := validateSchedule(house); err != nil {
+		t.Fatal(err)
+	}
+	schedules = controller.Schedules{
+		House:       house,
+		Thermostats: make(map[string]*controller.Schedule),
+		Holds:       make(map[string]controller.Hold),
+		Manual:      make(map[string]controller.Setpoints),
+	}
+
+	// 2024-01-01 is a monday
+	monday := func(clock string) time.Time {
+		h, m, _ := parseClock(clock)
+		return time.Date(2024, 1, 1, h, m, 0, 0, time.UTC)
+	}
+	check := func(at time.Time, want controller.Setpoints, wantSource string) {
+		t.Helper()
+		got, source := effectiveSetpoints("01", at)
+		if got != want || source != wantSource {
+			t.Errorf("%s: got %v (%s), want %v (%s)", at, got, source, want, wantSource)
+		}
+	}
+
+	// sunday 22:00 sleep carries over to monday morning
+	check(monday("05:00"), sleep, controller.PeriodSleep)
+	check(monday("12:00"), comfort, controller.PeriodComfort)
+	check(monday("23:00"), sleep, controller.PeriodSleep)
+
+	// hold until the next scheduled change
+	hold := controller.Setpoints{HeatSetpoint: 22, CoolSetpoint: 24}
+	schedules.Holds["01"] = controller.Hold{Setpoints: hold, Until: holdUntil("01", monday("12:00"))}
+	check(monday("21:59"), hold, SourceHold)
+	check(monday("22:00"), sleep, controller.PeriodSleep)
+	if !expireSchedules(monday("22:00")) || len(schedules.Holds) != 0 {
+		t.Error("expected the hold to expire")
+	}
+
+	// away recovers 4 hours before returning
+	awayRecovery = 4 * time.Hour
+	schedules.Away = controller.Away{Enabled: true, Setpoints: away, Return: monday("18:00")}
+	check(monday("13:00"), away, SourceAway)
+	check(monday("14:00"), comfort, controller.PeriodComfort)
+
+	// manual setpoints without a schedule
+	schedules = controller.Schedules{Manual: map[string]controller.Setpoints{"01": hold}}
+	check(monday("12:00"), hold, SourceManual)
+	if _, source := effectiveSetpoints("02", monday("12:00")); source != SourceManual {
+		t.Error("expected default manual setpoints")
+	}
+}
+
+// switches follow the wall clock across DST changes
+func TestScheduledPeriodDST(t *testing.T) {
+	toronto, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	everyday := []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}
+	schedule := &controller.Schedule{
+		Weekly: []controller.ScheduleEntry{
+			{Days: everyday, Start: "07:00", Period: controller.PeriodComfort},
+			{Days: everyday, Start: "22:00", Period: controller.PeriodSleep},
+		},
+	}
+	// clocks go forward on 2024-03-10 at 02:00, and back on 2024-11-03
+	for _, day := range []time.Time{
+		time.Date(2024, 3, 10, 0, 0, 0, 0, toronto),
+		time.Date(2024, 11, 3, 0, 0, 0, 0, toronto),
+	} {
+		at := func(h, m int) time.Time {
+			return time.Date(day.Year(), day.Month(), day.Day(), h, m, 0, 0, toronto)
+		}
+
+		period, next, _ := scheduledPeriod(schedule, at(6, 59))
+		if period != controller.PeriodSleep || !next.Equal(at(7, 0)) {
+			t.Errorf("%s: expected sleep until 07:00, got %s until %s", at(6, 59), period, next)
+		}
+		period, next, _ = scheduledPeriod(schedule, at(7, 30))
+		if period != controller.PeriodComfort || !next.Equal(at(22, 0)) {
+			t.Errorf("%s: expected comfort until 22:00, got %s until %s", at(7, 30), period, next)
+		}
+	}
+}
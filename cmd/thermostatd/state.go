@@ -0,0 +1,40 @@
+package main
+
+import (
+	"burlo/config"
+	"burlo/pkg/models/controller"
+	"burlo/pkg/store"
+	"fmt"
+)
+
+// thermostat names and schedules (including manual setpoints)
+// are kept in the state store so they survive restarts
+var stateStore *store.Store
+
+// thermostat names by id, set when first seen or through the http api
+var thermostatNames = make(map[string]string)
+
+func initStore(cfg config.ServiceConf) {
+	stateStore = store.OpenOrMemory(cfg.Thermostat.StatePath, "[thermostat]")
+
+	var names map[string]string
+	_, err := stateStore.Get("names", &names)
+	if err != nil {
+		fmt.Println("failed to load thermostat names:", err)
+	}
+	for id, name := range names {
+		thermostatNames[id] = name
+	}
+}
+
+// saveName must be called with the mutex held
+func saveName(tstat controller.Thermostat) {
+	if thermostatNames[tstat.ID] == tstat.Name {
+		return
+	}
+	thermostatNames[tstat.ID] = tstat.Name
+	err := stateStore.Put("names", thermostatNames)
+	if err != nil {
+		fmt.Println("failed to save thermostat names:", err)
+	}
+}
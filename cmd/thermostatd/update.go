@@ -2,6 +2,7 @@ package main
 
 import (
 	"burlo/pkg/models/controller"
+	"burlo/pkg/psychro"
 	"fmt"
 	"net/url"
 	"strings"
@@ -17,26 +18,23 @@ func update(tstat controller.Thermostat) {
 	tstat.ID = safeID(tstat.ID)
 
 	tstat.Time = time.Now()
-	tstat.Dewpoint = calculate_dewpoint_simple(tstat.Temperature, tstat.Humidity)
+	tstat.Dewpoint = psychro.Dewpoint(tstat.Temperature, tstat.Humidity)
 
 	// humiditstats don't need temperature setpoints
 	// and friendly/customizable names
 	if tstat.DewpointOnly {
+		humidistats[tstat.ID] = tstat
 		publishHumidistat(tstat)
 		return
 	}
 
-	// default values for the thermostat
-	tstat.HeatSetpoint = 20
-	tstat.CoolSetpoint = 24
-
-	// match with existing tstat
-	existing, ok := thermostats[tstat.ID]
-	if ok {
-		tstat.Name = existing.Name
-		tstat.HeatSetpoint = existing.HeatSetpoint
-		tstat.CoolSetpoint = existing.CoolSetpoint
+	// keep the name given through the http api
+	if name, ok := thermostatNames[tstat.ID]; ok {
+		tstat.Name = name
+	} else {
+		saveName(tstat)
 	}
+	applySetpoints(&tstat, tstat.Time)
 	thermostats[tstat.ID] = tstat
 	publishThermostat(tstat)
 }
@@ -46,26 +44,17 @@ func publishThermostat(tstat controller.Thermostat) {
 	const RETAIN = true
 	topic := fmt.Sprintf("controller/thermostats/%s", tstat.ID)
 	publisher.Publish(RETAIN, topic, tstat)
+	announceThermostat(tstat)
 }
 
 func publishHumidistat(tstat controller.Thermostat) {
 	const RETAIN = true
 	topic := fmt.Sprintf("controller/humidistat/%s", tstat.ID)
 	publisher.Publish(RETAIN, topic, tstat)
+	announceHumidistat(tstat)
 }
 
 func safeID(id string) string {
 	id = url.PathEscape(id)
 	return strings.ReplaceAll(id, "%", "_")
 }
-
-// a simple approximation, should err on the side of
-// being too high, never too low. Temperature must be
-// in celcius. Accureate to within 1 degC when RelH > 50%
-func calculate_dewpoint_simple(temp, relH float32) float32 {
-	if relH >= 50 && temp >= 25 {
-		return temp - ((100 - relH) / 5)
-	} else {
-		return temp - ((100 - relH) / 4)
-	}
-}
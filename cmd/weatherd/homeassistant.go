@@ -0,0 +1,40 @@
+package main
+
+import (
+	"burlo/config"
+	"burlo/pkg/homeassistant"
+	"burlo/pkg/mqtt"
+)
+
+// announceHomeAssistant describes the current weather, the
+// forecast and the air quality as Home Assistant sensors
+func announceHomeAssistant(cfg config.ServiceConf, mqttc *mqtt.Client) {
+	hass := homeassistant.NewClient(cfg, mqttc, nil, nil)
+
+	device := homeassistant.Device{
+		Identifiers:  []string{"burlo_weather"},
+		Name:         "Burlo weather",
+		Manufacturer: "burlo",
+		Model:        "weatherd",
+	}
+	const current = "weather/current"
+	const forecast = "weather/forecast"
+
+	high := homeassistant.Sensor(device, "weather_forecast_high", "Forecast high (24h)", forecast, "", "°C", "temperature")
+	high.ValueTemplate = "{{ value_json['Temperature'][:24] | max }}"
+	low := homeassistant.Sensor(device, "weather_forecast_low", "Forecast low (24h)", forecast, "", "°C", "temperature")
+	low.ValueTemplate = "{{ value_json['Temperature'][:24] | min }}"
+	rain := homeassistant.Sensor(device, "weather_rain_probability", "Rain probability (24h)", forecast, "", "%", "")
+	rain.ValueTemplate = "{{ value_json['ProbPrecipitation'][:24] | max }}"
+	aqhi := homeassistant.Sensor(device, "weather_aqhi", "AQHI", "weather/aqhi", "", "", "aqi")
+	aqhi.ValueTemplate = "{{ value_json['AQHI'][0] }}"
+
+	hass.Announce(
+		homeassistant.Sensor(device, "weather_temperature", "Temperature", current, "Temperature", "°C", "temperature"),
+		homeassistant.Sensor(device, "weather_humidity", "Humidity", current, "RelHumidity", "%", "humidity"),
+		homeassistant.Sensor(device, "weather_wind_speed", "Wind speed", current, "WindSpeed", "km/h", "wind_speed"),
+		homeassistant.Sensor(device, "weather_cloud_cover", "Cloud cover", current, "CloudCover", "%", ""),
+		homeassistant.Sensor(device, "weather_precipitation", "Precipitation", current, "Precipitation", "mm", "precipitation"),
+		high, low, rain, aqhi,
+	)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"burlo/config"
+	"burlo/pkg/metrics"
+	"burlo/pkg/models/weather"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// metrics_server serves /metrics when weatherd has an address
+func metrics_server(ctx context.Context, cfg config.ServiceConf) {
+	port := config.GetPort(cfg.ServiceHTTPAddresses.Weatherd)
+	if port == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", metrics.Handler())
+	server := http.Server{
+		Addr:         fmt.Sprintf(":%s", port),
+		ReadTimeout:  time.Minute,
+		WriteTimeout: time.Minute,
+		Handler:      mux,
+	}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(ctx)
+	}()
+	fmt.Println("http server listening on", server.Addr)
+	err := server.ListenAndServe()
+	if err != http.ErrServerClosed {
+		fmt.Println(err)
+	}
+}
+
+func recordCurrent(current weather.Current) {
+	gauge := func(name, help string, value float32) {
+		metrics.SetGauge("burlo_weather_"+name, help, float64(value))
+	}
+	gauge("temperature_celsius", "Outdoor temperature", current.Temperature)
+	gauge("humidity_percent", "Outdoor relative humidity", current.RelHumidity)
+	gauge("wind_speed_kmh", "Wind speed", current.WindSpeed)
+	gauge("cloud_cover_percent", "Cloud cover", current.CloudCover)
+	gauge("precipitation_mm", "Precipitation", current.Precipitation)
+	gauge("code", "WMO weather code", float32(current.WeatherCode))
+}
+
+func recordFetch(source string, err error) {
+	metrics.AddCounter("burlo_weather_fetches_total", "Weather service requests", 1, "source", source)
+	if err != nil {
+		metrics.AddCounter("burlo_weather_fetch_errors_total", "Failed weather service requests", 1, "source", source)
+	}
+}
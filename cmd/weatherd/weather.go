@@ -2,6 +2,7 @@ package main
 
 import (
 	"burlo/config"
+	"burlo/pkg/metrics"
 	"burlo/pkg/models/weather"
 	"burlo/pkg/mqtt"
 	"burlo/pkg/openmateo"
@@ -36,6 +37,9 @@ func main() {
 	fmt.Println("started")
 	defer fmt.Println("stopped")
 
+	announceHomeAssistant(cfg, mqttc)
+	go metrics_server(ctx, cfg)
+
 	var wService weather.WeatherService
 	wService, err := openmateo.New(cfg.Location.Latitude, cfg.Location.Longitude)
 	if err != nil {
@@ -48,7 +52,9 @@ func main() {
 	go func() {
 		for {
 			current, err := wService.CurrentConditions()
+			recordFetch("current", err)
 			if err == nil {
+				recordCurrent(current)
 				mqttc.Publish(true, "weather/current", current)
 			} else {
 				mqttc.Publish(false, "error/weather/current", err.Error())
@@ -63,6 +69,7 @@ func main() {
 	go func() {
 		for {
 			forecast, err := wService.Forecast24h()
+			recordFetch("forecast", err)
 			if err == nil {
 				mqttc.Publish(true, "weather/forecast", forecast)
 			} else {
@@ -79,6 +86,7 @@ func main() {
 		for {
 			// TODO: location needs to be configurable
 			forecast, err := weathergcca.GetAqhiForecast(3, "Ottawa")
+			recordFetch("aqhi", err)
 			if err != nil {
 				mqttc.Publish(false, "error/weather/aqhi", err.Error())
 				fmt.Println("[Error] get aqhi forecast:", err)
@@ -91,6 +99,7 @@ func main() {
 				time.Sleep(15 * time.Minute)
 				continue
 			}
+			metrics.SetGauge("burlo_weather_aqhi", "Air quality health index", float64(forecast.AQHI[0]))
 			mqttc.Publish(true, "weather/aqhi", forecast)
 			time.Sleep(time.Hour)
 		}
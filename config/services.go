@@ -16,6 +16,11 @@ type ServiceConf struct {
 	Thermostat           Thermostat           `toml:"thermostat"`
 	Controller           Controller           `toml:"controller"`
 	Mqtt                 Mqtt                 `toml:"mqtt"`
+	Notify               Notify               `toml:"notify"`
+	HomeAssistant        HomeAssistant        `toml:"homeassistant"`
+	Exporter             Exporter             `toml:"exporter"`
+	Monitor              Monitor              `toml:"monitor"`
+	Analytics            Analytics            `toml:"analytics"`
 }
 type ServiceHTTPAddresses struct {
 	Dx2Wlogger string `toml:"dx2wlogger"`
@@ -25,6 +30,116 @@ type ServiceHTTPAddresses struct {
 	Actuators  string `toml:"actuators"`
 	Dashboard  string `toml:"dashboard"`
 	NtfyServer string `toml:"ntfyserver"`
+	Weatherd   string `toml:"weatherd"` // only serves /metrics
+	Analyticsd string `toml:"analyticsd"`
+}
+
+// Analytics integrates the heat pump power into daily energy rollups
+type Analytics struct {
+	Interval  int    `toml:"interval"`   // seconds, defaults to 15
+	BinSize   int    `toml:"bin_size"`   // °C, of the COP curve, defaults to 2
+	StatePath string `toml:"state_path"` // keeps the daily rollups
+}
+
+// Monitor writes the HeatPumpMonitor.org feeds to EmonCMS
+type Monitor struct {
+	Emoncms   string `toml:"emoncms"`    // url
+	Key       string `toml:"key"`        // read and write api key
+	Tag       string `toml:"tag"`        // feed tag, defaults to "heatpump"
+	Interval  int    `toml:"interval"`   // seconds, defaults to 10
+	StatePath string `toml:"state_path"` // keeps the kWh totals
+}
+
+// Exporter collects telemetry from the services, by polling their
+// http apis or subscribing to mqtt, and sends it to the sinks
+type Exporter struct {
+	Interval int `toml:"interval"` // seconds between polls, defaults to 15
+	// samples kept per sink while it is unreachable, replayed
+	// once it is back, defaults to a day of 15s polls
+	Buffer  int              `toml:"buffer"`
+	Sources []ExporterSource `toml:"sources"`
+	Sinks   []ExporterSink   `toml:"sinks"`
+}
+
+// ExporterSource is polled (url) or subscribed to (topic), its json
+// numbers and booleans become the fields, nested objects are flattened
+type ExporterSource struct {
+	Name  string `toml:"name"` // emoncms node, influxdb device tag, csv file name
+	URL   string `toml:"url"`
+	Topic string `toml:"topic"` // full mqtt topic, can have wildcards
+}
+
+// ExporterSink is one of emoncms, influxdb (v2), csv or graphite
+type ExporterSink struct {
+	Type    string `toml:"type"`
+	Address string `toml:"address"` // emoncms and influxdb url, graphite host:port
+	Key     string `toml:"key"`     // emoncms api key, influxdb token
+	Org     string `toml:"org"`     // influxdb
+	Bucket  string `toml:"bucket"`  // influxdb
+	Path    string `toml:"path"`    // csv directory, one file per source per day
+	Prefix  string `toml:"prefix"`  // graphite metric prefix
+	// the sources and fields sent to this sink, all when empty
+	Sources []string `toml:"sources"`
+	Fields  []string `toml:"fields"`
+}
+
+// HomeAssistant publishes MQTT discovery configs for the burlo
+// entities, and accepts setpoint and override commands from HA
+type HomeAssistant struct {
+	Enabled         bool   `toml:"enabled"`
+	DiscoveryPrefix string `toml:"discovery_prefix"` // defaults to "homeassistant"
+}
+
+// Notify configures how events are turned into notifications
+type Notify struct {
+	Topic string `toml:"topic"` // default ntfy topic
+	// "HH:MM-HH:MM", only high and urgent priority events go out
+	// during quiet hours, the rest are sent together afterwards
+	QuietHours string `toml:"quiet_hours"`
+	// "HH:MM", when the daily digest of minor events is sent
+	DigestTime string `toml:"digest_time"`
+	// delivery attempts before giving up, with exponential backoff
+	Retries int          `toml:"retries"`
+	Rules   []NotifyRule `toml:"rules"`
+	// "ntfy", "smtp", "webhook" and "mqtt", rules can choose their
+	// own, defaults to ntfy
+	Transports []string      `toml:"transports"`
+	SMTP       NotifySMTP    `toml:"smtp"`
+	Webhook    NotifyWebhook `toml:"webhook"`
+}
+
+// NotifySMTP sends notifications by email
+type NotifySMTP struct {
+	Address string   `toml:"address"` // host:port
+	User    string   `toml:"user"`
+	Pass    string   `toml:"pass"`
+	From    string   `toml:"from"`
+	To      []string `toml:"to"`
+}
+
+// NotifyWebhook posts notifications as json, the payload has
+// "text" (Slack, Matrix hookshot) and "content" (Discord)
+type NotifyWebhook struct {
+	URL string `toml:"url"`
+}
+
+// NotifyRule applies to events of one type, or every type with "*"
+type NotifyRule struct {
+	Event    string         `toml:"event"`
+	Topic    string         `toml:"topic"`
+	Priority int            `toml:"priority"` // 1 (min) to 5 (urgent)
+	Tags     []string       `toml:"tags"`
+	Click    string         `toml:"click"`
+	Actions  []NotifyAction `toml:"actions"`
+	// minutes before the same event (eg. the same sensor) is sent again
+	Cooldown   int      `toml:"cooldown"`
+	Digest     bool     `toml:"digest"`
+	Mute       bool     `toml:"mute"`
+	Transports []string `toml:"transports"`
+}
+type NotifyAction struct {
+	Label string `toml:"label"`
+	URL   string `toml:"url"`
 }
 type Dx2WModbus struct {
 	TCPAddress string `toml:"tcp_address"`
@@ -42,11 +157,19 @@ type Mqtt struct {
 }
 type Thermostat struct {
 	Mqtt Mqtt `toml:"mqtt"`
+	// state store for names, schedules, holds, away mode
+	// and manual setpoints, not saved when empty
+	StatePath string `toml:"state_path"`
+	// hours before the away return time to resume the schedule
+	AwayRecovery float32 `toml:"away_recovery"`
 }
 type RadiantCooling struct {
 	Enabled           bool `toml:"enabled"`
 	OvernightBoost    bool `toml:"overnight_boost"`
 	SupplyTemperature int  `toml:"supply_temperature"`
+	// the condensation interlock trips when the supply water is
+	// less than this (degC) above any sensor's dewpoint
+	CondensationMargin float32 `toml:"condensation_margin"`
 }
 type Circulator struct {
 	Hubport int    `toml:"hubport"`
@@ -68,9 +191,178 @@ type Phidgets struct {
 	Hpmode     Hpmode     `toml:"hpmode"`
 	Dewpoint   Dewpoint   `toml:"dewpoint"`
 }
+
+// Output configures a controller output, the type selects the backend:
+// "digital_output" and "voltage_output" (phidgets service), "mqtt",
+// "modbus_coil" or "fake" (in-memory, for running without hardware)
+type Output struct {
+	Type string `toml:"type"`
+	Name string `toml:"name"`
+
+	// phidgets
+	Hubport int `toml:"hubport"`
+	Channel int `toml:"channel"`
+
+	// mqtt
+	Topic    string `toml:"topic"`
+	Property string `toml:"property"`
+	On       string `toml:"on"`
+	Off      string `toml:"off"`
+	Analog   bool   `toml:"analog"`
+
+	// modbus_coil
+	Address string `toml:"address"`
+	UnitID  uint8  `toml:"unit_id"`
+	Coil    uint16 `toml:"coil"`
+}
+
+// Heating defines the outdoor reset (weather compensation) curve,
+// a straight line from the zero load point to the design load point
+type Heating struct {
+	OutdoorReset                    bool        `toml:"outdoor_reset"`
+	SetpointRegister                string      `toml:"setpoint_register"`
+	MaxSupplyTemperature            float32     `toml:"max_supply_temperature"`
+	DesignLoadOutdoorAirTemperature float32     `toml:"design_load_outdoor_air_temperature"`
+	DesignLoadSupplyTemperature     float32     `toml:"design_load_supply_temperature"`
+	ZeroLoadOutdoorAirTemperature   float32     `toml:"zero_load_outdoor_air_temperature"`
+	ZeroLoadSupplyTemperature       float32     `toml:"zero_load_supply_temperature"`
+	Tuning                          CurveTuning `toml:"tuning"`
+}
+
+// CurveTuning measures how much of the time the zones call for heat
+// at each outdoor temperature, and recommends (or applies) a curve
+// that would give the target duty cycle
+type CurveTuning struct {
+	Enabled              bool    `toml:"enabled"`
+	TargetDutyCycle      float32 `toml:"target_duty_cycle"`
+	HistoryDays          int     `toml:"history_days"`
+	MinHours             float32 `toml:"min_hours"`
+	AutoApply            bool    `toml:"auto_apply"`
+	MaxStep              float32 `toml:"max_step"`
+	MinSupplyTemperature float32 `toml:"min_supply_temperature"`
+}
+
+// Zone groups thermostats and humidistats that share a circulator
+// (output). A zone without thermostats gets every thermostat not
+// assigned to another zone. Setpoints override the thermostats'
+// own setpoints when set
+type Zone struct {
+	Name         string   `toml:"name"`
+	Thermostats  []string `toml:"thermostats"`
+	Humidistats  []string `toml:"humidistats"`
+	Output       string   `toml:"output"`
+	HeatSetpoint float32  `toml:"heat_setpoint"`
+	CoolSetpoint float32  `toml:"cool_setpoint"`
+}
+
+// DHW priority diverts the heatpump to the hot water tank when the
+// tank temperature (degC) drops below setpoint - differential, and
+// limits the space heating zone calls until it recovers
+type DHW struct {
+	Enabled      bool    `toml:"enabled"`
+	Setpoint     float32 `toml:"setpoint"`
+	Differential float32 `toml:"differential"`
+	// minutes, priority ends when exceeded and won't
+	// restart until the same time has passed again
+	MaxPriorityTime int `toml:"max_priority_time"`
+	// "suspend" stops all zone calls during priority,
+	// "limit" only lets zones that are too cold call
+	ZoneCalls string `toml:"zone_calls"`
+	// priority only starts within these "HH:MM-HH:MM"
+	// windows, any time when empty
+	Schedule []string `toml:"schedule"`
+	Output   string   `toml:"output"`
+}
+
+// Freshness sets how old (minutes) each input may get before the
+// controller treats it as stale and falls back to safe decisions
+type Freshness struct {
+	Thermostat int `toml:"thermostat"`
+	Humidistat int `toml:"humidistat"`
+	Current    int `toml:"current"`
+	Forecast   int `toml:"forecast"`
+	AQHI       int `toml:"aqhi"`
+	// added to the last known dewpoint (degC) while a
+	// dewpoint sensor is stale
+	DewpointMargin float32 `toml:"dewpoint_margin"`
+}
+
+// Diagnostics are the thresholds of the compressor and defrost checks
+type Diagnostics struct {
+	MaxStartsPerHour int `toml:"max_starts_per_hour"`
+	MinRunTime       int `toml:"min_run_time"` // minutes
+	// between defrosts in frosting conditions (around freezing, humid),
+	// twice this in dry or very cold air
+	MinDefrostInterval int     `toml:"min_defrost_interval"` // minutes
+	MinSubcooling      float32 `toml:"min_subcooling"`       // degC
+	// hydronic faults
+	MinDeltaT      float32 `toml:"min_delta_t"`      // degC, while the compressor runs
+	MaxBufferDrift float32 `toml:"max_buffer_drift"` // degC from the buffer target
+}
+
+// Ventilation tunes the window recommendations. The options where 0
+// (or below) is a valid value are pointers, nil when not set:
+// min_outdoor, sunny_allowance, max_dewpoint, enthalpy_margin,
+// hysteresis and min_interval
+type Ventilation struct {
+	// keep the windows closed above this air quality health index
+	MaxAQHI int `toml:"max_aqhi"`
+	// heating mode: the lowest outdoor temperature (degC) to open
+	// the windows at, lowered by sunny_allowance when it is sunny
+	MinOutdoor     *float32 `toml:"min_outdoor"`
+	SunnyAllowance *float32 `toml:"sunny_allowance"`
+	// keep the windows closed above this outdoor dewpoint (degC)
+	MaxDewpoint *float32 `toml:"max_dewpoint"`
+	// cooling mode: the outdoor air must have this much less
+	// enthalpy (kJ/kg) than the indoor air to open the windows
+	EnthalpyMargin *float32 `toml:"enthalpy_margin"`
+	// km/h
+	MaxWind float32 `toml:"max_wind"`
+	// keep the windows closed when rain is this likely (%)
+	// within the next rain_lookahead hours
+	RainProbability float32 `toml:"rain_probability"`
+	RainLookahead   int     `toml:"rain_lookahead"`
+	// only open when the forecast stays favourable this many hours
+	MinHours int `toml:"min_hours"`
+	// degC, open windows stay open until conditions are this much worse
+	Hysteresis *float32 `toml:"hysteresis"`
+	// minutes between changes in advice, unless closing for a lockout
+	MinInterval *int `toml:"min_interval"`
+}
+
+// Windows automates the window and ventilation outputs from the
+// window advice, outputs are names from [controller.outputs]
+type Windows struct {
+	// motorized window openers, on while the windows should be open
+	Openers []string `toml:"openers"`
+	// whole house fans, only run while the windows are open
+	Fans []string `toml:"fans"`
+	// ERV/HRV boost, on while the outdoor air is favourable,
+	// even when rain or wind keep the windows closed
+	ERV []string `toml:"erv"`
+	// zigbee2mqtt contact sensor topics, eg. "zigbee2mqtt/kitchen-window",
+	// zone calls pause while any window is open
+	Contacts []string `toml:"contacts"`
+	// minutes between output changes, lockouts apply right away
+	MinInterval int `toml:"min_interval"`
+	// minutes to leave the openers alone after a window
+	// is opened or closed by hand
+	ManualHold int `toml:"manual_hold"`
+}
 type Controller struct {
-	RadiantCooling RadiantCooling `toml:"radiant_cooling"`
-	Phidgets       Phidgets       `toml:"phidgets"`
+	RadiantCooling RadiantCooling    `toml:"radiant_cooling"`
+	Heating        Heating           `toml:"heating"`
+	Phidgets       Phidgets          `toml:"phidgets"`
+	Outputs        map[string]Output `toml:"outputs"`
+	Zones          []Zone            `toml:"zones"`
+	DHW            DHW               `toml:"dhw"`
+	Freshness      Freshness         `toml:"freshness"`
+	Ventilation    Ventilation       `toml:"ventilation"`
+	Windows        Windows           `toml:"windows"`
+	Diagnostics    Diagnostics       `toml:"diagnostics"`
+	// state store for the DX2W mode debounce, overrides and
+	// heating curve tuning, not saved when empty
+	StatePath string `toml:"state_path"`
 }
 
 func LoadV2(filepath string) ServiceConf {
@@ -5,19 +5,14 @@ go 1.22.0
 require (
 	github.com/eclipse/paho.golang v0.21.0
 	github.com/fsnotify/fsnotify v1.7.0
-	github.com/influxdata/influxdb-client-go/v2 v2.13.0
+	github.com/gorilla/websocket v1.5.1
 	github.com/pelletier/go-toml/v2 v2.1.1
 	github.com/simonvetter/modbus v1.6.1
 	golang.org/x/exp v0.0.0-20240325151524-a685a6edb6d8
 )
 
 require (
-	github.com/apapsch/go-jsonmerge/v2 v2.0.0 // indirect
 	github.com/goburrow/serial v0.1.0 // indirect
-	github.com/google/uuid v1.3.1 // indirect
-	github.com/gorilla/websocket v1.5.1 // indirect
-	github.com/influxdata/line-protocol v0.0.0-20200327222509-2487e7298839 // indirect
-	github.com/oapi-codegen/runtime v1.0.0 // indirect
 	golang.org/x/net v0.21.0 // indirect
 	golang.org/x/sys v0.17.0 // indirect
 )
@@ -0,0 +1,75 @@
+package actuator
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Actuator is a single physical output. Digital outputs (relays)
+// are on when the value is non-zero, analog outputs take the value
+// as is (eg. 0-10Vdc)
+type Actuator interface {
+	Set(value float32) error
+	String() string
+}
+
+func SetBool(a Actuator, on bool) error {
+	return a.Set(boolValue(on))
+}
+
+func boolValue(on bool) float32 {
+	if on {
+		return 1
+	}
+	return 0
+}
+
+// Fake keeps outputs in memory, useful for testing the
+// controller and running it without hardware
+type Fake struct {
+	name    string
+	mutex   sync.Mutex
+	value   float32
+	history []FakeEvent
+}
+
+type FakeEvent struct {
+	Time  time.Time
+	Value float32
+}
+
+func NewFake(name string) *Fake {
+	return &Fake{name: name}
+}
+
+func (f *Fake) Set(value float32) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if len(f.history) == 0 || f.value != value {
+		f.history = append(f.history, FakeEvent{time.Now(), value})
+	}
+	f.value = value
+	return nil
+}
+
+func (f *Fake) Value() float32 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.value
+}
+
+func (f *Fake) On() bool {
+	return f.Value() != 0
+}
+
+// History lists every change of value
+func (f *Fake) History() []FakeEvent {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]FakeEvent{}, f.history...)
+}
+
+func (f *Fake) String() string {
+	return fmt.Sprintf("fake(%s)", f.name)
+}
@@ -0,0 +1,75 @@
+package actuator
+
+import (
+	"burlo/pkg/modbustest"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMQTT_Payload(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  MQTTOpts
+		value float32
+		want  string
+	}{
+		{"on", MQTTOpts{}, 1, `{"state":"ON"}`},
+		{"off", MQTTOpts{}, 0, `{"state":"OFF"}`},
+		{"any non-zero is on", MQTTOpts{}, 0.5, `{"state":"ON"}`},
+		{"property", MQTTOpts{Property: "state_l2"}, 1, `{"state_l2":"ON"}`},
+		{"on and off values", MQTTOpts{On: "open", Off: "close"}, 0, `{"state":"close"}`},
+		{"analog", MQTTOpts{Property: "voltage", Analog: true}, 7.5, `{"voltage":7.5}`},
+		{"analog zero", MQTTOpts{Analog: true}, 0, `{"state":0}`},
+	}
+	for _, tt := range tests {
+		payload, err := json.Marshal(NewMQTT(nil, tt.opts).payload(tt.value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(payload) != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, payload)
+		}
+	}
+}
+
+func TestFake(t *testing.T) {
+	fake := NewFake("circulator")
+	for _, value := range []float32{0, 0, 1, 1, 0} {
+		if err := fake.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fake.On() || fake.Value() != 0 {
+		t.Errorf("expected off, got %v", fake.Value())
+	}
+	history := fake.History()
+	if len(history) != 3 || history[0].Value != 0 || history[1].Value != 1 || history[2].Value != 0 {
+		t.Errorf("expected the changes 0, 1, 0, got %+v", history)
+	}
+	SetBool(fake, true)
+	if !fake.On() || fake.String() != "fake(circulator)" {
+		t.Errorf("expected %s on", fake)
+	}
+}
+
+func TestModbusCoil(t *testing.T) {
+	server, addr := modbustest.Start(t, 4)
+	coil := NewModbusCoil(addr, 1, 3)
+	if err := coil.Set(1); err != nil {
+		t.Fatal(err)
+	}
+	if !server.Coil(3) || server.Coil(2) {
+		t.Error("expected only coil 3 on")
+	}
+	// each write makes a new connection
+	if err := coil.Set(0); err != nil {
+		t.Fatal(err)
+	}
+	if server.Coil(3) {
+		t.Error("expected coil 3 off")
+	}
+	if !strings.Contains(coil.String(), "coil=3") {
+		t.Errorf("unexpected name %s", coil)
+	}
+}
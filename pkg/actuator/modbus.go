@@ -0,0 +1,51 @@
+package actuator
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/simonvetter/modbus"
+)
+
+// ModbusCoil drives a single coil on a modbus TCP device,
+// eg. a relay module. A new connection is made for each
+// write since outputs change rarely
+type ModbusCoil struct {
+	url    string
+	unitID uint8
+	coil   uint16
+}
+
+func NewModbusCoil(addr string, unitID uint8, coil uint16) *ModbusCoil {
+	return &ModbusCoil{
+		url:    fmt.Sprintf("tcp://%s", addr),
+		unitID: unitID,
+		coil:   coil,
+	}
+}
+
+func (m *ModbusCoil) Set(value float32) error {
+	client, err := modbus.NewClient(&modbus.ClientConfiguration{
+		URL:     m.url,
+		Timeout: 4 * time.Second,
+	})
+	if err != nil {
+		return fmt.Errorf("creating modbus client: %w", err)
+	}
+	err = client.Open()
+	if err != nil {
+		return fmt.Errorf("opening modbus client: %w", err)
+	}
+	defer client.Close()
+	client.SetUnitId(m.unitID)
+
+	err = client.WriteCoil(m.coil, value != 0)
+	if err != nil {
+		return fmt.Errorf("writing coil %d: %w", m.coil, err)
+	}
+	return nil
+}
+
+func (m *ModbusCoil) String() string {
+	return fmt.Sprintf("modbus_coil(%s unit=%d coil=%d)", m.url, m.unitID, m.coil)
+}
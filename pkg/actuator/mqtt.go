@@ -0,0 +1,72 @@
+package actuator
+
+import (
+	"burlo/pkg/mqtt"
+	"fmt"
+	"strconv"
+)
+
+// MQTT publishes the output state to a topic, eg. a zigbee2mqtt
+// relay listening on "zigbee2mqtt/{friendly_name}/set" for
+// {"state": "ON"}. Analog outputs publish the number as is
+type MQTT struct {
+	client   *mqtt.Client
+	topic    string
+	property string
+	on       string
+	off      string
+	analog   bool
+}
+
+type MQTTOpts struct {
+	Topic    string
+	Property string // defaults to "state"
+	On       string // defaults to "ON"
+	Off      string // defaults to "OFF"
+	Analog   bool
+}
+
+func NewMQTT(client *mqtt.Client, opts MQTTOpts) *MQTT {
+	if opts.Property == "" {
+		opts.Property = "state"
+	}
+	if opts.On == "" {
+		opts.On = "ON"
+	}
+	if opts.Off == "" {
+		opts.Off = "OFF"
+	}
+	return &MQTT{
+		client:   client,
+		topic:    opts.Topic,
+		property: opts.Property,
+		on:       opts.On,
+		off:      opts.Off,
+		analog:   opts.Analog,
+	}
+}
+
+func (m *MQTT) Set(value float32) error {
+	const RETAIN = false
+	return m.client.Publish(RETAIN, m.topic, m.payload(value))
+}
+
+func (m *MQTT) payload(value float32) map[string]interface{} {
+	var payload = make(map[string]interface{})
+	switch {
+	case m.analog:
+		payload[m.property] = value
+	case value != 0:
+		payload[m.property] = m.on
+	default:
+		payload[m.property] = m.off
+	}
+	return payload
+}
+
+func (m *MQTT) String() string {
+	if m.analog {
+		return fmt.Sprintf("mqtt(%s %s=<value>)", m.topic, m.property)
+	}
+	return fmt.Sprintf("mqtt(%s %s=%s|%s)", m.topic, m.property, strconv.Quote(m.on), strconv.Quote(m.off))
+}
@@ -0,0 +1,108 @@
+package actuator
+
+import (
+	protocol "burlo/services/protocols"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// The phidgets service is a small python httpserver that
+// wraps the Phidgets API, see services/actuators/phidgets.py
+
+var phidgetsClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		MaxIdleConns:       10,
+		IdleConnTimeout:    30 * time.Second,
+		DisableCompression: true,
+	},
+}
+
+type PhidgetsDigital struct {
+	uri     string
+	name    string
+	hubport int32
+	channel int32
+}
+
+type PhidgetsVoltage struct {
+	uri     string
+	name    string
+	hubport int32
+	channel int32
+}
+
+func NewPhidgetsDigital(addr, name string, hubport, channel int) *PhidgetsDigital {
+	return &PhidgetsDigital{
+		uri:     fmt.Sprintf("http://%s%s", addr, "/phidgets/digital_out"),
+		name:    name,
+		hubport: int32(hubport),
+		channel: int32(channel),
+	}
+}
+
+func NewPhidgetsVoltage(addr, name string, hubport, channel int) *PhidgetsVoltage {
+	return &PhidgetsVoltage{
+		uri:     fmt.Sprintf("http://%s%s", addr, "/phidgets/voltage_out"),
+		name:    name,
+		hubport: int32(hubport),
+		channel: int32(channel),
+	}
+}
+
+func (p *PhidgetsDigital) Set(value float32) error {
+	return postPhidgets(p.uri, protocol.PhidgetDO{
+		Name:    p.name,
+		HubPort: p.hubport,
+		Channel: p.channel,
+		Output:  value != 0,
+	})
+}
+
+func (p *PhidgetsDigital) String() string {
+	return fmt.Sprintf("phidgets_do(%s hubport=%d channel=%d)", p.name, p.hubport, p.channel)
+}
+
+func (p *PhidgetsVoltage) Set(value float32) error {
+	return postPhidgets(p.uri, protocol.PhidgetVO{
+		Name:    p.name,
+		HubPort: p.hubport,
+		Channel: p.channel,
+		Output:  value,
+	})
+}
+
+func (p *PhidgetsVoltage) String() string {
+	return fmt.Sprintf("phidgets_vo(%s hubport=%d channel=%d)", p.name, p.hubport, p.channel)
+}
+
+func postPhidgets(uri string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+	req, err := http.NewRequest("POST", uri, bytes.NewBuffer(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := phidgetsClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		bodyBytes, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("bad status: %d, failed to read response body: %w", resp.StatusCode, err)
+		}
+		return fmt.Errorf("bad status: %d %s", resp.StatusCode, string(bodyBytes))
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+// Package clock parses the "HH:MM" times of day and "HH:MM-HH:MM"
+// windows used in the config, so they can be validated once at startup.
+package clock
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Clock is a time of day, in minutes since midnight
+type Clock int
+
+// Parse a "HH:MM" time of day
+func Parse(s string) (Clock, error) {
+	hh, mm, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid time '%s', expected HH:MM", s)
+	}
+	h, err := strconv.Atoi(hh)
+	if err != nil || h < 0 || h > 23 {
+		return 0, fmt.Errorf("invalid hour in '%s'", s)
+	}
+	m, err := strconv.Atoi(mm)
+	if err != nil || m < 0 || m > 59 {
+		return 0, fmt.Errorf("invalid minute in '%s'", s)
+	}
+	return Clock(h*60 + m), nil
+}
+
+// Of is the time of day of t
+func Of(t time.Time) Clock {
+	return Clock(t.Hour()*60 + t.Minute())
+}
+
+// On is this time of day on the same date as t
+func (c Clock) On(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), int(c)/60, int(c)%60, 0, 0, t.Location())
+}
+
+func (c Clock) String() string {
+	return fmt.Sprintf("%02d:%02d", int(c)/60, int(c)%60)
+}
+
+// Window is a "HH:MM-HH:MM" time of day range,
+// it wraps past midnight when the end is before the start
+type Window struct {
+	Start Clock
+	End   Clock
+}
+
+// ParseWindow parses a "HH:MM-HH:MM" window
+func ParseWindow(s string) (Window, error) {
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return Window{}, fmt.Errorf("invalid window '%s', expected HH:MM-HH:MM", s)
+	}
+	var w Window
+	var err error
+	if w.Start, err = Parse(start); err != nil {
+		return Window{}, err
+	}
+	if w.End, err = Parse(end); err != nil {
+		return Window{}, err
+	}
+	return w, nil
+}
+
+// Contains reports if t is within the window (the end is exclusive)
+func (w Window) Contains(t time.Time) bool {
+	c := Of(t)
+	if w.Start <= w.End {
+		return c >= w.Start && c < w.End
+	}
+	return c >= w.Start || c < w.End
+}
+
+func (w Window) String() string {
+	return w.Start.String() + "-" + w.End.String()
+}
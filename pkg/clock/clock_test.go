@@ -0,0 +1,80 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Clock
+		wantErr bool
+	}{
+		{"00:00", 0, false},
+		{"07:30", 7*60 + 30, false},
+		{"23:59", 23*60 + 59, false},
+		{" 8:05", 8*60 + 5, false},
+		{"24:00", 0, true},
+		{"12:60", 0, true},
+		{"12", 0, true},
+		{"ab:cd", 0, true},
+		{"08:00x", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWindow(t *testing.T) {
+	at := func(h, m int) time.Time {
+		return time.Date(2024, 1, 1, h, m, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		window string
+		t      time.Time
+		want   bool
+	}{
+		{"09:00-17:00", at(9, 0), true},
+		{"09:00-17:00", at(16, 59), true},
+		{"09:00-17:00", at(17, 0), false},
+		{"09:00-17:00", at(8, 59), false},
+		{"22:00-07:00", at(23, 30), true},
+		{"22:00-07:00", at(3, 0), true},
+		{"22:00-07:00", at(7, 0), false},
+		{"22:00-07:00", at(12, 0), false},
+	}
+	for _, tt := range tests {
+		w, err := ParseWindow(tt.window)
+		if err != nil {
+			t.Fatalf("ParseWindow(%q): %v", tt.window, err)
+		}
+		if got := w.Contains(tt.t); got != tt.want {
+			t.Errorf("%s contains %s = %v, want %v", tt.window, tt.t.Format("15:04"), got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "22:00", "22:00-", "22:00-7", "10:00-25:00"} {
+		if _, err := ParseWindow(bad); err == nil {
+			t.Errorf("ParseWindow(%q) should fail", bad)
+		}
+	}
+}
+
+func TestClockOn(t *testing.T) {
+	loc := time.FixedZone("EST", -5*3600)
+	c, _ := Parse("08:15")
+	got := c.On(time.Date(2024, 3, 2, 23, 0, 0, 0, loc))
+	want := time.Date(2024, 3, 2, 8, 15, 0, 0, loc)
+	if !got.Equal(want) {
+		t.Errorf("On = %v, want %v", got, want)
+	}
+}
@@ -2,9 +2,13 @@ package dx2w
 
 import (
 	_ "embed"
+	"errors"
 	"fmt"
+	"math"
 	"time"
 
+	"burlo/pkg/metrics"
+
 	"github.com/simonvetter/modbus"
 )
 
@@ -19,8 +23,9 @@ type TCPDevice struct {
 }
 
 type TCPClient struct {
-	device TCPDevice
-	config Config
+	device  TCPDevice
+	config  Config
+	session *Session
 }
 
 type Value struct {
@@ -34,8 +39,9 @@ type Value struct {
 
 func New(device TCPDevice) *TCPClient {
 	client := &TCPClient{
-		device: device,
-		config: globalRegisterConfig,
+		device:  device,
+		config:  globalRegisterConfig,
+		session: Shared(device),
 	}
 	return client
 }
@@ -52,35 +58,38 @@ func (c TCPClient) PrintFields() {
 	}
 }
 
-func (c TCPClient) ReadAll() map[string]Value {
-	regmap := make(map[string]Value)
+var ErrUnknownRegister = errors.New("unknown register")
+var ErrNotWritable = errors.New("register is not writable")
+var ErrOutOfRange = errors.New("value out of range for register")
+var ErrWriteMismatch = errors.New("read back value does not match written value")
 
-	client, err := modbus.NewClient(&modbus.ClientConfiguration{
-		URL:     c.device.Url,
-		Timeout: 4 * time.Second,
-	})
-	if err != nil {
-		fmt.Println("Error creating Modbus client:", err)
-		return regmap
-	}
+// Health reports the state of the connection shared
+// by all clients of this device
+func (c TCPClient) Health() Health {
+	return c.session.Health()
+}
 
-	err = client.Open()
-	for err != nil {
-		fmt.Println("Error opening Modbus client:", err)
-		return regmap
-	}
+// Read reads the named registers, a subset of those
+// this client was created with
+func (c TCPClient) Read(fields []string) map[string]Value {
+	return c.read(c.config.withFields(fields))
+}
 
-	defer client.Close()
-	client.SetUnitId(c.device.Id)
+func (c TCPClient) ReadAll() map[string]Value {
+	return c.read(c.config)
+}
+
+func (c TCPClient) read(config Config) map[string]Value {
+	regmap := make(map[string]Value)
 
 	now := time.Now()
 	nretries := 0
 
 	nread := 0
-	for nread < len(c.config.Register) {
+	for nread < len(config.Register) {
 
 		// registers that have not yet been read
-		registers := c.config.Register[nread:]
+		registers := config.Register[nread:]
 
 		// will read up to 16 registers per request
 		firstAddr := registers[0].Address
@@ -98,8 +107,21 @@ func (c TCPClient) ReadAll() map[string]Value {
 		lastAddr = registers[count-1].Address
 		nregisters := 1 + lastAddr - firstAddr
 
-		rawvals, err := client.ReadRegisters(firstAddr, nregisters, modbus.HOLDING_REGISTER)
+		var rawvals []uint16
+		start := time.Now()
+		err := c.session.Do(func(client *modbus.ModbusClient) (err error) {
+			rawvals, err = client.ReadRegisters(firstAddr, nregisters, modbus.HOLDING_REGISTER)
+			return err
+		})
+		metrics.Observe("burlo_modbus_read_seconds", "Modbus read request duration, including the wait for the session", time.Since(start).Seconds())
+		if err != nil {
+			metrics.AddCounter("burlo_modbus_read_errors_total", "Failed modbus read requests", 1)
+		}
 
+		if errors.Is(err, ErrNotConnected) || errors.Is(err, ErrSessionClosed) {
+			fmt.Println("Failed to read modbus registers:", err)
+			break
+		}
 		if err != nil {
 			if nretries < 3 {
 				time.Sleep(100 * time.Millisecond)
@@ -112,14 +134,7 @@ func (c TCPClient) ReadAll() map[string]Value {
 		} else {
 			for _, reg := range registers[:count] {
 				i := reg.Address - firstAddr
-				regmap[reg.Name] = Value{
-					Uint16:    rawvals[i],
-					Float32:   float32(int16(rawvals[i])) * reg.Factor,
-					Bool:      asBool(rawvals[i]),
-					Type:      reg.Type,
-					Units:     reg.Units,
-					Timestamp: now,
-				}
+				regmap[reg.Name] = reg.value(rawvals[i], now)
 			}
 		}
 		nread += count
@@ -127,6 +142,99 @@ func (c TCPClient) ReadAll() map[string]Value {
 	return regmap
 }
 
+// Write sets a writable register to value, given in the register's
+// engineering units (eg. °F, kW). The value is scaled by the inverse of
+// the register's Factor before being written, then the register is read
+// back to confirm the device accepted it. BOOL registers are set when
+// value is non-zero.
+func (c TCPClient) Write(name string, value float32) (Value, error) {
+	reg, ok := globalRegisterConfig.find(name)
+	if !ok {
+		return Value{}, fmt.Errorf("%w: %s", ErrUnknownRegister, name)
+	}
+	if !reg.Writable {
+		return Value{}, fmt.Errorf("%w: %s", ErrNotWritable, name)
+	}
+	raw, err := reg.raw(value)
+	if err != nil {
+		return Value{}, fmt.Errorf("%s: %w", name, err)
+	}
+
+	// write and read back as a single request so
+	// no other caller can change it in between
+	var readback uint16
+	err = c.session.Do(func(client *modbus.ModbusClient) error {
+		err := client.WriteRegister(reg.Address, raw)
+		if err != nil {
+			return fmt.Errorf("writing %s: %w", name, err)
+		}
+		readback, err = client.ReadRegister(reg.Address, modbus.HOLDING_REGISTER)
+		if err != nil {
+			return fmt.Errorf("reading back %s: %w", name, err)
+		}
+		return nil
+	})
+	metrics.AddCounter("burlo_modbus_writes_total", "Modbus register writes", 1, "name", name)
+	if err != nil {
+		metrics.AddCounter("burlo_modbus_write_errors_total", "Failed modbus register writes", 1, "name", name)
+		return Value{}, err
+	}
+	result := reg.value(readback, time.Now())
+	if readback != raw {
+		return result, fmt.Errorf("%w: %s wrote %d, read %d", ErrWriteMismatch, name, raw, readback)
+	}
+	return result, nil
+}
+
+// WriteBool is a convenience for writing BOOL registers
+func (c TCPClient) WriteBool(name string, on bool) (Value, error) {
+	var value float32
+	if on {
+		value = 1
+	}
+	return c.Write(name, value)
+}
+
+// value converts a raw register value into engineering units
+func (reg Register) value(raw uint16, timestamp time.Time) Value {
+	return Value{
+		Uint16:    raw,
+		Float32:   float32(int16(raw)) * reg.Factor,
+		Bool:      asBool(raw),
+		Type:      reg.Type,
+		Units:     reg.Units,
+		Timestamp: timestamp,
+	}
+}
+
+// raw converts a value in engineering units into the raw
+// register value, the inverse of Register.value
+func (reg Register) raw(value float32) (uint16, error) {
+	if reg.Type == BOOL {
+		if value != 0 {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	if reg.Factor == 0 {
+		return 0, fmt.Errorf("register has no scaling factor")
+	}
+	scaled := math.Round(float64(value / reg.Factor))
+
+	switch reg.Type {
+	case UINT16:
+		if scaled < 0 || scaled > math.MaxUint16 {
+			return 0, fmt.Errorf("%w: %v %s", ErrOutOfRange, value, reg.Units)
+		}
+		return uint16(scaled), nil
+	default:
+		if scaled < math.MinInt16 || scaled > math.MaxInt16 {
+			return 0, fmt.Errorf("%w: %v %s", ErrOutOfRange, value, reg.Units)
+		}
+		return uint16(int16(scaled)), nil
+	}
+}
+
 func asBool(val uint16) bool {
 	if val != 0 {
 		return true
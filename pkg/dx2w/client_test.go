@@ -1,9 +1,16 @@
 package dx2w
 
 import (
+	"burlo/pkg/modbustest"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestClient_ReadAll(t *testing.T) {
@@ -25,3 +32,118 @@ func TestClient_ReadAll(t *testing.T) {
 	result := client.ReadAll()
 	fmt.Println(string(jsonBytes(result)))
 }
+
+func TestRegister_raw(t *testing.T) {
+	regs := []struct {
+		reg   Register
+		value float32
+		raw   uint16
+	}{
+		{Register{Name: "scaled", Factor: 0.1, Type: INT16}, 104.5, 1045},
+		{Register{Name: "negative", Factor: 0.1, Type: INT16}, -2.5, uint16(0xFFE7)},
+		{Register{Name: "unscaled", Factor: 1.0, Type: UINT16}, 42, 42},
+		{Register{Name: "bool", Factor: 1.0, Type: BOOL}, 1, 1},
+	}
+	for _, tc := range regs {
+		raw, err := tc.reg.raw(tc.value)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.reg.Name, err)
+		}
+		if raw != tc.raw {
+			t.Errorf("%s: expected raw %d, got %d", tc.reg.Name, tc.raw, raw)
+		}
+		if value := tc.reg.value(raw, time.Now()); value.Float32 != tc.value {
+			t.Errorf("%s: expected round trip %v, got %v", tc.reg.Name, tc.value, value.Float32)
+		}
+	}
+
+	_, err := Register{Name: "range", Factor: 0.1, Type: INT16}.raw(5000)
+	if !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("expected ErrOutOfRange, got %v", err)
+	}
+}
+
+func TestClient_WriteNotWritable(t *testing.T) {
+	client := New(TCPDevice{Url: "tcp://localhost:502", Id: 200})
+	defer client.session.Close()
+
+	_, err := client.Write("HP_INPUT_KW", 1)
+	if !errors.Is(err, ErrNotWritable) {
+		t.Errorf("expected ErrNotWritable, got %v", err)
+	}
+	_, err = client.Write("NOT_A_REGISTER", 1)
+	if !errors.Is(err, ErrUnknownRegister) {
+		t.Errorf("expected ErrUnknownRegister, got %v", err)
+	}
+}
+
+func TestSession_SharedWrites(t *testing.T) {
+	_, addr := modbustest.Start(t, 1)
+	device := TCPDevice{Url: "tcp://" + addr, Id: 200}
+	defer Shared(device).Close()
+
+	// wait for the session to connect
+	for i := 0; !Shared(device).Health().Connected; i++ {
+		if i > 50 {
+			t.Fatal("session did not connect:", Shared(device).Health().LastError)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// several clients writing concurrently share one connection,
+	// the fake only allows one client so this fails otherwise
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(setpoint float32) {
+			defer wg.Done()
+			client := New(device)
+			value, err := client.Write("CHILLED_WATER_SETPOINT", setpoint)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if value.Float32 != setpoint {
+				t.Errorf("expected %v, read back %v", setpoint, value.Float32)
+			}
+		}(float32(60 + i))
+	}
+	wg.Wait()
+
+	value, err := New(device).WriteBool("DX2W_POWER", true)
+	if err != nil || !value.Bool {
+		t.Errorf("expected DX2W_POWER on, got %v, %v", value, err)
+	}
+
+	values := New(device).Read([]string{"DX2W_POWER", "CHILLED_WATER_SETPOINT"})
+	if len(values) != 2 || !values["DX2W_POWER"].Bool {
+		t.Errorf("unexpected read: %+v", values)
+	}
+	if health := Shared(device).Health(); health.Requests == 0 || health.Reconnects != 0 {
+		t.Errorf("unexpected health: %+v", health)
+	}
+}
+
+// requests made right after the session starts wait for it to connect
+func TestSession_FirstRequest(t *testing.T) {
+	fake, addr := modbustest.Start(t, 1)
+	fake.SetRegister(471, 1) // FORCED_DEFROST
+	device := TCPDevice{Url: "tcp://" + addr, Id: 200}
+	client := New(device)
+	defer client.session.Close()
+
+	values := client.Read([]string{"FORCED_DEFROST"})
+	if !values["FORCED_DEFROST"].Bool {
+		t.Errorf("expected the first read to succeed, got %+v, %+v", values, client.session.Health())
+	}
+}
+
+func TestHTTPClient_HealthBadStatus(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	health := NewHTTPClient(strings.TrimPrefix(server.URL, "http://")).Health()
+	if health.Connected || !strings.Contains(health.LastError, "404") {
+		t.Errorf("expected a disconnected health with the status, got %+v", health)
+	}
+}
@@ -51,3 +51,12 @@ func (cfg Config) withFields(fields []string) Config {
 	})
 	return newConf
 }
+
+func (cfg Config) find(name string) (Register, bool) {
+	for _, reg := range cfg.Register {
+		if reg.Name == name {
+			return reg, true
+		}
+	}
+	return Register{}, false
+}
@@ -0,0 +1,115 @@
+package dx2w
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Device is implemented by TCPClient, which talks to the DX2W
+// directly, and HTTPClient, which goes through the dx2wlogger
+// service so that several processes can share its modbus session
+type Device interface {
+	Read(fields []string) map[string]Value
+	Write(name string, value float32) (Value, error)
+	WriteBool(name string, on bool) (Value, error)
+	Health() Health
+}
+
+type HTTPClient struct {
+	address string
+	client  *http.Client
+}
+
+func NewHTTPClient(addr string) *HTTPClient {
+	return &HTTPClient{
+		address: fmt.Sprintf("http://%s", addr),
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Read returns the most recent values cached by dx2wlogger
+func (c HTTPClient) Read(fields []string) map[string]Value {
+	regmap := make(map[string]Value)
+
+	uri := fmt.Sprintf("%s/dx2w/registers?fields=%s", c.address, url.QueryEscape(strings.Join(fields, ",")))
+	resp, err := c.client.Get(uri)
+	if err != nil {
+		fmt.Println("[dx2w] failed to read registers:", err)
+		return regmap
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Println("[dx2w] failed to read registers: bad status:", resp.Status)
+		return regmap
+	}
+	err = json.NewDecoder(resp.Body).Decode(&regmap)
+	if err != nil {
+		fmt.Println("[dx2w] failed to decode registers:", err)
+	}
+	return regmap
+}
+
+func (c HTTPClient) Write(name string, value float32) (Value, error) {
+	payload, err := json.Marshal(struct {
+		Value float32 `json:"value"`
+	}{value})
+	if err != nil {
+		return Value{}, err
+	}
+	uri := fmt.Sprintf("%s/dx2w/registers/%s", c.address, url.PathEscape(name))
+	req, err := http.NewRequest("PUT", uri, bytes.NewBuffer(payload))
+	if err != nil {
+		return Value{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return Value{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return Value{}, fmt.Errorf("writing %s: %s: %s", name, resp.Status, strings.TrimSpace(string(body)))
+	}
+	var result Value
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result, err
+}
+
+func (c HTTPClient) WriteBool(name string, on bool) (Value, error) {
+	var value float32
+	if on {
+		value = 1
+	}
+	return c.Write(name, value)
+}
+
+// Health reports the health of the dx2wlogger modbus session,
+// or a disconnected state if dx2wlogger can't be reached
+func (c HTTPClient) Health() Health {
+	var health Health
+
+	resp, err := c.client.Get(fmt.Sprintf("%s/dx2w/health", c.address))
+	if err != nil {
+		return Health{LastError: err.Error(), LastErrorTime: time.Now()}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Health{LastError: "bad status: " + resp.Status, LastErrorTime: time.Now()}
+	}
+	err = json.NewDecoder(resp.Body).Decode(&health)
+	if err != nil {
+		return Health{LastError: err.Error(), LastErrorTime: time.Now()}
+	}
+	return health
+}
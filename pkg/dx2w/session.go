@@ -0,0 +1,247 @@
+package dx2w
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/simonvetter/modbus"
+)
+
+// The DX2W only accepts a single modbus TCP connection at a time, so all
+// clients for the same device share one long-lived session. The session
+// owns the connection and executes requests one at a time, in the order
+// they are received, and reconnects with backoff when the link drops.
+
+var ErrNotConnected = errors.New("not connected to modbus device")
+var ErrSessionClosed = errors.New("modbus session closed")
+
+const minBackoff = time.Second
+const maxBackoff = time.Minute
+
+type Health struct {
+	Connected     bool
+	Since         time.Time
+	Reconnects    int
+	Requests      uint64
+	Errors        uint64
+	LastError     string
+	LastErrorTime time.Time
+	RetryAt       time.Time
+}
+
+type Session struct {
+	device   TCPDevice
+	requests chan request
+	done     chan struct{}
+	once     sync.Once
+
+	mutex  sync.Mutex
+	health Health
+}
+
+type request struct {
+	exec  func(*modbus.ModbusClient) error
+	reply chan error
+}
+
+var sessions = make(map[TCPDevice]*Session)
+var sessionsMutex sync.Mutex
+
+// Shared returns the session for device, starting it on first use
+func Shared(device TCPDevice) *Session {
+	sessionsMutex.Lock()
+	defer sessionsMutex.Unlock()
+
+	session, ok := sessions[device]
+	if !ok {
+		session = newSession(device)
+		sessions[device] = session
+	}
+	return session
+}
+
+func newSession(device TCPDevice) *Session {
+	s := &Session{
+		device:   device,
+		requests: make(chan request),
+		done:     make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Close disconnects from the device, pending and future
+// requests fail with ErrSessionClosed
+func (s *Session) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		sessionsMutex.Lock()
+		if sessions[s.device] == s {
+			delete(sessions, s.device)
+		}
+		sessionsMutex.Unlock()
+	})
+}
+
+func (s *Session) Health() Health {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.health
+}
+
+// Do queues fn to run with exclusive access to the device
+// connection, and waits for it to complete
+func (s *Session) Do(fn func(*modbus.ModbusClient) error) error {
+	req := request{
+		exec:  fn,
+		reply: make(chan error, 1),
+	}
+	select {
+	case s.requests <- req:
+	case <-s.done:
+		return ErrSessionClosed
+	}
+	select {
+	case err := <-req.reply:
+		return err
+	case <-s.done:
+		return ErrSessionClosed
+	}
+}
+
+func (s *Session) run() {
+	var client *modbus.ModbusClient
+	backoff := minBackoff
+
+	retry := time.NewTimer(0)
+	defer retry.Stop()
+
+	disconnect := func() {
+		if client != nil {
+			client.Close()
+			client = nil
+		}
+	}
+	defer disconnect()
+
+	connect := func() {
+		var err error
+		client, err = s.connect()
+		if err != nil {
+			fmt.Println("[dx2w]", err, "retrying in", backoff)
+			s.updateHealth(func(h *Health) {
+				h.RetryAt = time.Now().Add(backoff)
+			})
+			retry.Reset(backoff)
+			backoff = min(2*backoff, maxBackoff)
+			return
+		}
+		backoff = minBackoff
+	}
+
+	// requests wait for the first connection attempt, so
+	// they don't fail only because the session just started
+	<-retry.C
+	connect()
+
+	for {
+		select {
+		case <-s.done:
+			return
+
+		case <-retry.C:
+			if client != nil {
+				continue
+			}
+			connect()
+
+		case req := <-s.requests:
+			if client == nil {
+				s.recordError(ErrNotConnected)
+				req.reply <- ErrNotConnected
+				continue
+			}
+			err := req.exec(client)
+			s.updateHealth(func(h *Health) {
+				h.Requests += 1
+			})
+			if err != nil {
+				s.recordError(err)
+			}
+			if isConnectionError(err) {
+				fmt.Println("[dx2w] connection lost:", err)
+				disconnect()
+				s.updateHealth(func(h *Health) {
+					h.Connected = false
+				})
+				retry.Reset(0)
+			}
+			req.reply <- err
+		}
+	}
+}
+
+func (s *Session) connect() (*modbus.ModbusClient, error) {
+	client, err := modbus.NewClient(&modbus.ClientConfiguration{
+		URL:     s.device.Url,
+		Timeout: 4 * time.Second,
+	})
+	if err != nil {
+		s.recordError(err)
+		return nil, fmt.Errorf("creating modbus client: %w", err)
+	}
+	err = client.Open()
+	if err != nil {
+		s.recordError(err)
+		return nil, fmt.Errorf("opening modbus client: %w", err)
+	}
+	client.SetUnitId(s.device.Id)
+
+	s.updateHealth(func(h *Health) {
+		if !h.Since.IsZero() {
+			h.Reconnects += 1
+		}
+		h.Connected = true
+		h.Since = time.Now()
+		h.RetryAt = time.Time{}
+	})
+	return client, nil
+}
+
+func (s *Session) updateHealth(fn func(*Health)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	fn(&s.health)
+}
+
+func (s *Session) recordError(err error) {
+	s.updateHealth(func(h *Health) {
+		h.Errors += 1
+		h.LastError = err.Error()
+		h.LastErrorTime = time.Now()
+	})
+}
+
+// modbus exceptions are reported by the device itself, which
+// means the connection is fine. Anything else (timeouts, io
+// errors, framing errors) requires reconnecting
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch {
+	case errors.Is(err, modbus.ErrIllegalFunction),
+		errors.Is(err, modbus.ErrIllegalDataAddress),
+		errors.Is(err, modbus.ErrIllegalDataValue),
+		errors.Is(err, modbus.ErrServerDeviceFailure),
+		errors.Is(err, modbus.ErrAcknowledge),
+		errors.Is(err, modbus.ErrServerDeviceBusy),
+		errors.Is(err, modbus.ErrMemoryParityError),
+		errors.Is(err, modbus.ErrGWPathUnavailable),
+		errors.Is(err, modbus.ErrGWTargetFailedToRespond):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,228 @@
+// Package homeassistant describes burlo entities to Home Assistant using
+// MQTT discovery. The entities read the json the services already publish
+// under burlo/, through value templates, and Home Assistant sends its
+// commands to burlo/ha/. Discovery configs are retained, and published
+// again when Home Assistant restarts.
+package homeassistant
+
+import (
+	"burlo/config"
+	"burlo/pkg/mqtt"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+)
+
+const DefaultPrefix = "homeassistant"
+
+// CommandPrefix is where Home Assistant publishes commands
+const CommandPrefix = "burlo/ha"
+
+// Device groups entities in Home Assistant
+type Device struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer,omitempty"`
+	Model        string   `json:"model,omitempty"`
+}
+
+// Entity is a discovery config, only the fields used by burlo
+type Entity struct {
+	Component string `json:"-"` // sensor, binary_sensor, select or climate
+	ObjectID  string `json:"-"` // unique within the component
+
+	Name     string `json:"name"`
+	UniqueID string `json:"unique_id"`
+	Device   Device `json:"device"`
+	Icon     string `json:"icon,omitempty"`
+
+	StateTopic        string `json:"state_topic,omitempty"`
+	ValueTemplate     string `json:"value_template,omitempty"`
+	UnitOfMeasurement string `json:"unit_of_measurement,omitempty"`
+	DeviceClass       string `json:"device_class,omitempty"`
+	StateClass        string `json:"state_class,omitempty"`
+	EntityCategory    string `json:"entity_category,omitempty"`
+	PayloadOn         string `json:"payload_on,omitempty"`
+	PayloadOff        string `json:"payload_off,omitempty"`
+
+	// select
+	CommandTopic string   `json:"command_topic,omitempty"`
+	Options      []string `json:"options,omitempty"`
+
+	// climate
+	Modes                        []string `json:"modes,omitempty"`
+	ModeStateTopic               string   `json:"mode_state_topic,omitempty"`
+	ModeStateTemplate            string   `json:"mode_state_template,omitempty"`
+	CurrentTemperatureTopic      string   `json:"current_temperature_topic,omitempty"`
+	CurrentTemperatureTemplate   string   `json:"current_temperature_template,omitempty"`
+	CurrentHumidityTopic         string   `json:"current_humidity_topic,omitempty"`
+	CurrentHumidityTemplate      string   `json:"current_humidity_template,omitempty"`
+	TemperatureLowStateTopic     string   `json:"temperature_low_state_topic,omitempty"`
+	TemperatureLowStateTemplate  string   `json:"temperature_low_state_template,omitempty"`
+	TemperatureLowCommandTopic   string   `json:"temperature_low_command_topic,omitempty"`
+	TemperatureHighStateTopic    string   `json:"temperature_high_state_topic,omitempty"`
+	TemperatureHighStateTemplate string   `json:"temperature_high_state_template,omitempty"`
+	TemperatureHighCommandTopic  string   `json:"temperature_high_command_topic,omitempty"`
+	TemperatureUnit              string   `json:"temperature_unit,omitempty"`
+	MinTemp                      float32  `json:"min_temp,omitempty"`
+	MaxTemp                      float32  `json:"max_temp,omitempty"`
+	TempStep                     float32  `json:"temp_step,omitempty"`
+}
+
+// Topic is the discovery topic of the entity
+func (e Entity) Topic(prefix string) string {
+	return path.Join(prefix, e.Component, "burlo", e.ObjectID, "config")
+}
+
+// ObjectID joins the parts into an id Home Assistant accepts,
+// eg. "dx2w", "NET_COP" is "dx2w_net_cop"
+func ObjectID(parts ...string) string {
+	id := strings.ToLower(strings.Join(parts, "_"))
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, id)
+}
+
+// StateTopic is a topic published by a burlo service
+func StateTopic(topic string) string {
+	return path.Join("burlo", topic)
+}
+
+// CommandTopic is a topic where Home Assistant sends commands,
+// the service receives them without the CommandPrefix
+func CommandTopic(parts ...string) string {
+	return path.Join(append([]string{CommandPrefix}, parts...)...)
+}
+
+// JSONValue is a template reading a field of the json payload
+func JSONValue(field string) string {
+	return fmt.Sprintf("{{ value_json['%s'] }}", field)
+}
+
+// Sensor reads a numeric field of a json state topic
+func Sensor(device Device, objectID, name, topic, field, unit, deviceClass string) Entity {
+	return Entity{
+		Component:         "sensor",
+		ObjectID:          objectID,
+		Name:              name,
+		Device:            device,
+		StateTopic:        StateTopic(topic),
+		ValueTemplate:     JSONValue(field),
+		UnitOfMeasurement: unit,
+		DeviceClass:       deviceClass,
+		StateClass:        "measurement",
+	}
+}
+
+// BinarySensor reads a boolean field of a json state topic
+func BinarySensor(device Device, objectID, name, topic, field, deviceClass string) Entity {
+	return Entity{
+		Component:     "binary_sensor",
+		ObjectID:      objectID,
+		Name:          name,
+		Device:        device,
+		StateTopic:    StateTopic(topic),
+		ValueTemplate: fmt.Sprintf("{{ 'ON' if value_json['%s'] else 'OFF' }}", field),
+		DeviceClass:   deviceClass,
+	}
+}
+
+// Client announces the entities of a service and receives its commands
+type Client struct {
+	mqttc  *mqtt.Client
+	prefix string
+
+	mutex     sync.Mutex
+	announced map[string][]byte // config, by discovery topic
+}
+
+// NewClient shares the service mqtt client when the integration is
+// enabled, and subscribes to the service commands, eg. "thermostat/#".
+// Returns nil when disabled, a nil client does nothing.
+func NewClient(cfg config.ServiceConf, mqttc *mqtt.Client, commands []string, onCommand func(topic string, payload []byte)) *Client {
+	if !cfg.HomeAssistant.Enabled {
+		return nil
+	}
+	client := &Client{
+		mqttc:     mqttc,
+		prefix:    cfg.HomeAssistant.DiscoveryPrefix,
+		announced: make(map[string][]byte),
+	}
+	if client.prefix == "" {
+		client.prefix = DefaultPrefix
+	}
+	status := path.Join(client.prefix, "status")
+	topics := []string{status}
+	for _, command := range commands {
+		topics = append(topics, CommandTopic(command))
+	}
+	mqttc.Subscribe(topics, func(topic string, payload []byte) {
+		if topic == status {
+			if string(payload) == "online" {
+				go client.reannounce()
+			}
+			return
+		}
+		if onCommand != nil {
+			onCommand(strings.TrimPrefix(topic, CommandPrefix+"/"), payload)
+		}
+	})
+	return client
+}
+
+// Announce publishes the discovery configs that changed
+func (c *Client) Announce(entities ...Entity) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, entity := range entities {
+		if entity.UniqueID == "" {
+			entity.UniqueID = "burlo_" + entity.Component + "_" + entity.ObjectID
+		}
+		payload, err := json.Marshal(entity)
+		if err != nil {
+			fmt.Println("[homeassistant] announce:", err)
+			continue
+		}
+		topic := entity.Topic(c.prefix)
+		if string(c.announced[topic]) == string(payload) {
+			continue
+		}
+		// raw json, the client would marshal it again
+		err = c.mqttc.PublishTo(true, topic, json.RawMessage(payload))
+		if err != nil {
+			fmt.Println("[homeassistant] announce:", err)
+			continue
+		}
+		c.announced[topic] = payload
+	}
+}
+
+// Publish publishes a state under the burlo prefix, eg. "dx2w/registers"
+func (c *Client) Publish(retain bool, topic string, data interface{}) error {
+	if c == nil {
+		return nil
+	}
+	return c.mqttc.PublishTo(retain, StateTopic(topic), data)
+}
+
+// reannounce publishes every config again, after Home Assistant restarts
+func (c *Client) reannounce() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for topic, payload := range c.announced {
+		err := c.mqttc.PublishTo(true, topic, json.RawMessage(payload))
+		if err != nil {
+			fmt.Println("[homeassistant] reannounce:", err)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package homeassistant
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEntity(t *testing.T) {
+	device := Device{Identifiers: []string{"burlo_dx2w"}, Name: "DX2W"}
+	entity := Sensor(device, ObjectID("dx2w", "DIVERSION_VALVE_%_CLOSED"), "Diversion valve",
+		"dx2w/registers", "DIVERSION_VALVE_%_CLOSED", "%", "")
+
+	topic := entity.Topic(DefaultPrefix)
+	if topic != "homeassistant/sensor/burlo/dx2w_diversion_valve___closed/config" {
+		t.Errorf("unexpected discovery topic %s", topic)
+	}
+	payload, err := json.Marshal(entity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config map[string]interface{}
+	json.Unmarshal(payload, &config)
+	want := map[string]interface{}{
+		"state_topic":         "burlo/dx2w/registers",
+		"value_template":      "{{ value_json['DIVERSION_VALVE_%_CLOSED'] }}",
+		"unit_of_measurement": "%",
+		"state_class":         "measurement",
+	}
+	for key, value := range want {
+		if config[key] != value {
+			t.Errorf("expected %s=%v, got %v", key, value, config[key])
+		}
+	}
+	// unset fields are left out
+	for _, key := range []string{"device_class", "command_topic", "modes", "min_temp"} {
+		if _, ok := config[key]; ok {
+			t.Errorf("expected no %s, got %v", key, config[key])
+		}
+	}
+}
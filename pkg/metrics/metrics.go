@@ -0,0 +1,229 @@
+// Package metrics collects service metrics and serves them at /metrics in
+// the Prometheus text format, or OpenMetrics when the scraper asks for it.
+// Counters and summaries are kept in the registry as events happen, gauges
+// that mirror the service state are set by collectors on every scrape, so
+// series for removed sensors or zones don't linger.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type kind string
+
+const (
+	gauge   kind = "gauge"
+	counter kind = "counter" // names end in _total
+	summary kind = "summary"
+)
+
+type family struct {
+	name    string
+	help    string
+	kind    kind
+	samples map[string]*sample // by labels
+}
+
+type sample struct {
+	value float64 // the sum, for summaries
+	count float64
+}
+
+// Registry holds metric families by name
+type Registry struct {
+	mutex      sync.Mutex
+	families   map[string]*family
+	collectors []func(r *Registry)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Default is the registry of the service, the
+// packages record their metrics here
+var Default = NewRegistry()
+
+func SetGauge(name, help string, value float64, labels ...string) {
+	Default.SetGauge(name, help, value, labels...)
+}
+
+func AddCounter(name, help string, delta float64, labels ...string) {
+	Default.AddCounter(name, help, delta, labels...)
+}
+
+func Observe(name, help string, value float64, labels ...string) {
+	Default.Observe(name, help, value, labels...)
+}
+
+// Collect adds a collector to the default registry
+func Collect(fn func(r *Registry)) {
+	Default.Collect(fn)
+}
+
+// Handler serves the default registry
+func Handler() http.HandlerFunc {
+	return Default.Handler()
+}
+
+// SetGauge sets a gauge, labels are name/value pairs
+func (r *Registry) SetGauge(name, help string, value float64, labels ...string) {
+	r.update(name, help, gauge, labels, func(s *sample) { s.value = value })
+}
+
+// AddCounter increments a counter, its name must end in _total
+func (r *Registry) AddCounter(name, help string, delta float64, labels ...string) {
+	r.update(name, help, counter, labels, func(s *sample) { s.value += delta })
+}
+
+// Observe adds a value to a summary (sum and count), eg. a duration
+func (r *Registry) Observe(name, help string, value float64, labels ...string) {
+	r.update(name, help, summary, labels, func(s *sample) {
+		s.value += value
+		s.count++
+	})
+}
+
+// Collect adds a function that sets gauges from the current
+// state, it runs on a copy of the registry before every scrape
+func (r *Registry) Collect(fn func(r *Registry)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.collectors = append(r.collectors, fn)
+}
+
+func (r *Registry) update(name, help string, k kind, labels []string, fn func(s *sample)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{name: name, help: help, kind: k, samples: make(map[string]*sample)}
+		r.families[name] = f
+	}
+	if f.kind != k {
+		fmt.Printf("[metrics] %s is a %s, not a %s\r\n", name, f.kind, k)
+		return
+	}
+	key := formatLabels(labels)
+	s, ok := f.samples[key]
+	if !ok {
+		s = &sample{}
+		f.samples[key] = s
+	}
+	fn(s)
+}
+
+// snapshot copies the registry and runs the collectors on the copy
+func (r *Registry) snapshot() *Registry {
+	r.mutex.Lock()
+	snap := NewRegistry()
+	for name, f := range r.families {
+		copied := &family{name: f.name, help: f.help, kind: f.kind, samples: make(map[string]*sample)}
+		for key, s := range f.samples {
+			copied.samples[key] = &sample{value: s.value, count: s.count}
+		}
+		snap.families[name] = copied
+	}
+	collectors := slices.Clone(r.collectors)
+	r.mutex.Unlock()
+
+	for _, collect := range collectors {
+		collect(snap)
+	}
+	return snap
+}
+
+func (r *Registry) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		openMetrics := strings.Contains(req.Header.Get("Accept"), "application/openmetrics-text")
+		if openMetrics {
+			w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		}
+		r.snapshot().write(w, openMetrics)
+	}
+}
+
+// write outputs the families sorted by name, and their samples by labels
+func (r *Registry) write(w io.Writer, openMetrics bool) {
+	var names []string
+	for name := range r.families {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		f := r.families[name]
+		typeName := f.name
+		if f.kind == counter && openMetrics {
+			// the OpenMetrics family name has no _total suffix
+			typeName = strings.TrimSuffix(f.name, "_total")
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n", typeName, escapeHelp(f.help))
+		fmt.Fprintf(w, "# TYPE %s %s\n", typeName, f.kind)
+
+		var keys []string
+		for key := range f.samples {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			s := f.samples[key]
+			if f.kind == summary {
+				fmt.Fprintf(w, "%s_sum%s %s\n", f.name, key, formatValue(s.value))
+				fmt.Fprintf(w, "%s_count%s %s\n", f.name, key, formatValue(s.count))
+				continue
+			}
+			fmt.Fprintf(w, "%s%s %s\n", f.name, key, formatValue(s.value))
+		}
+	}
+	if openMetrics {
+		fmt.Fprint(w, "# EOF\n")
+	}
+}
+
+// formatLabels formats name/value pairs as {name="value",...}
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	if len(labels)%2 != 0 {
+		labels = append(labels, "")
+	}
+	var pairs []string
+	for i := 0; i < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", labels[i], escapeLabel(labels[i+1])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Bool is 1 for true, for gauges of on/off states
+func Bool(on bool) float64 {
+	if on {
+		return 1
+	}
+	return 0
+}
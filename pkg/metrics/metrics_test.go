@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.AddCounter("burlo_modbus_read_errors_total", "Failed modbus reads", 2)
+	r.Observe("burlo_modbus_read_seconds", "Modbus read duration", 0.25)
+	r.Observe("burlo_modbus_read_seconds", "Modbus read duration", 0.5)
+	r.Collect(func(r *Registry) {
+		r.SetGauge("burlo_dx2w_register", "DX2W register value", 3.5, "name", "NET_COP", "units", "")
+		r.SetGauge("burlo_dx2w_register", "DX2W register value", 104, "name", "BUFFER_TANK_TEMP", "units", "°F")
+	})
+
+	scrape := func(accept string) string {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		r.Handler()(w, req)
+		return w.Body.String()
+	}
+
+	want := `# HELP burlo_dx2w_register DX2W register value
+# TYPE burlo_dx2w_register gauge
+burlo_dx2w_register{name="BUFFER_TANK_TEMP",units="°F"} 104
+burlo_dx2w_register{name="NET_COP",units=""} 3.5
+# HELP burlo_modbus_read_errors_total Failed modbus reads
+# TYPE burlo_modbus_read_errors_total counter
+burlo_modbus_read_errors_total 2
+# HELP burlo_modbus_read_seconds Modbus read duration
+# TYPE burlo_modbus_read_seconds summary
+burlo_modbus_read_seconds_sum 0.75
+burlo_modbus_read_seconds_count 2
+`
+	if got := scrape("text/plain"); got != want {
+		t.Errorf("unexpected prometheus output:\n%s", got)
+	}
+
+	got := scrape("application/openmetrics-text; version=1.0.0")
+	if !strings.Contains(got, "# TYPE burlo_modbus_read_errors counter\n") || !strings.HasSuffix(got, "# EOF\n") {
+		t.Errorf("unexpected openmetrics output:\n%s", got)
+	}
+	// collectors run on a copy
+	if _, ok := r.families["burlo_dx2w_register"]; ok {
+		t.Error("expected the collected gauges to not be kept")
+	}
+}
@@ -0,0 +1,109 @@
+// Package modbustest runs an in-memory modbus TCP server for tests,
+// on a free local port.
+package modbustest
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/simonvetter/modbus"
+)
+
+// Server holds the registers in memory
+type Server struct {
+	mutex     sync.Mutex
+	registers map[uint16]uint16 // holding registers
+	coils     map[uint16]bool
+}
+
+func (s *Server) HandleCoils(req *modbus.CoilsRequest) ([]bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if req.IsWrite {
+		for i, val := range req.Args {
+			s.coils[req.Addr+uint16(i)] = val
+		}
+		return nil, nil
+	}
+	res := make([]bool, req.Quantity)
+	for i := range res {
+		res[i] = s.coils[req.Addr+uint16(i)]
+	}
+	return res, nil
+}
+
+func (s *Server) HandleDiscreteInputs(req *modbus.DiscreteInputsRequest) ([]bool, error) {
+	return nil, modbus.ErrIllegalFunction
+}
+
+func (s *Server) HandleInputRegisters(req *modbus.InputRegistersRequest) ([]uint16, error) {
+	return nil, modbus.ErrIllegalFunction
+}
+
+func (s *Server) HandleHoldingRegisters(req *modbus.HoldingRegistersRequest) ([]uint16, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if req.IsWrite {
+		for i, val := range req.Args {
+			s.registers[req.Addr+uint16(i)] = val
+		}
+		return nil, nil
+	}
+	res := make([]uint16, req.Quantity)
+	for i := range res {
+		res[i] = s.registers[req.Addr+uint16(i)]
+	}
+	return res, nil
+}
+
+// Register returns a holding register
+func (s *Server) Register(addr uint16) uint16 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.registers[addr]
+}
+
+// SetRegister sets a holding register
+func (s *Server) SetRegister(addr, value uint16) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.registers[addr] = value
+}
+
+// Coil returns a coil
+func (s *Server) Coil(addr uint16) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.coils[addr]
+}
+
+// Start runs a server until the test ends, and returns its address
+// (host:port). The DX2W only accepts a single client, maxClients 1
+func Start(t testing.TB, maxClients uint) (*Server, string) {
+	s := &Server{registers: make(map[uint16]uint16), coils: make(map[uint16]bool)}
+
+	// the modbus server doesn't tell which port it got,
+	// so take a free one from the system first
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	server, err := modbus.NewServer(&modbus.ServerConfiguration{
+		URL:        "tcp://" + addr,
+		Timeout:    time.Minute,
+		MaxClients: maxClients,
+	}, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Stop() })
+	return s, addr
+}
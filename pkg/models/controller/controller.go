@@ -17,7 +17,35 @@ type Thermostat struct {
 	Dewpoint     float32
 	HeatSetpoint float32
 	CoolSetpoint float32
+	// what the setpoints come from: "manual", "hold",
+	// "away" or the name of the scheduled period
+	SetpointSource string `json:",omitempty"`
 
 	Battery     int32
 	LinkQuality int32
 }
+
+// DHWTank is a domestic hot water tank temperature sensor
+type DHWTank struct {
+	ID          string
+	Time        time.Time
+	Temperature float32
+}
+
+// Status summarizes the controller outputs, it is published
+// (retained) to controller/status whenever it changes
+type Status struct {
+	Mode         string // HEAT, COOL
+	State        string // ON, OFF
+	Window       string // OPEN, CLOSE, the window advice
+	WindowsOpen  bool   // reported by the contact sensors
+	Openers      bool
+	Fans         bool
+	ERVBoost     bool
+	ZoneCall     bool
+	ZoneCalls    map[string]bool
+	SupplyTarget float32
+	Dewpoint     float32
+	DHWPriority  bool
+	Interlock    bool // condensation interlock tripped
+}
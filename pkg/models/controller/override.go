@@ -0,0 +1,33 @@
+package controller
+
+import "time"
+
+// Overrides force a controller decision, they are set through
+// the controllerd http api or by publishing an OverrideRequest
+// to controller/override/{kind}. Active overrides are published
+// (retained) to controller/overrides keyed by kind, or by
+// "zone_call/{zone}" for a single zone
+
+const (
+	OverrideMode     = "mode"      // HEAT, COOL
+	OverrideState    = "state"     // ON, OFF
+	OverrideZoneCall = "zone_call" // ON, OFF
+	OverrideWindow   = "window"    // OPEN, CLOSE
+)
+
+type Override struct {
+	Value  string
+	Reason string
+	Since  time.Time
+	Until  time.Time // zero: until cleared
+}
+
+// OverrideRequest sets an override, AUTO (or an empty value) clears it.
+// The override lasts until Until, or for Minutes, or until cleared
+type OverrideRequest struct {
+	Value   string    `json:"value"`
+	Reason  string    `json:"reason,omitempty"`
+	Until   time.Time `json:"until,omitempty"`
+	Minutes float32   `json:"minutes,omitempty"`
+	Zone    string    `json:"zone,omitempty"` // zone_call only, all zones when empty
+}
@@ -0,0 +1,60 @@
+package controller
+
+import "time"
+
+// Schedules are owned by thermostatd, persisted, and published
+// (retained) to controller/schedules whenever they change
+
+type Setpoints struct {
+	HeatSetpoint float32
+	CoolSetpoint float32
+}
+
+// Period names used by schedules, periods can
+// be given any name but these are the usual ones
+const (
+	PeriodComfort = "comfort"
+	PeriodEco     = "eco"
+	PeriodSleep   = "sleep"
+)
+
+// ScheduleEntry switches to Period at Start ("HH:MM")
+// on each of the Days ("mon", "tue", ... "sun")
+type ScheduleEntry struct {
+	Days   []string
+	Start  string
+	Period string
+}
+
+// Schedule is a weekly schedule, each entry applies
+// until the next entry starts (wrapping around the week)
+type Schedule struct {
+	Periods map[string]Setpoints
+	Weekly  []ScheduleEntry
+}
+
+// Hold temporarily overrides a thermostat setpoints until it expires
+type Hold struct {
+	Setpoints
+	Until time.Time
+}
+
+// Away replaces every schedule with setbacks until the return
+// time minus recovery, so that the house is back to the
+// scheduled setpoints when we get home
+type Away struct {
+	Enabled bool
+	Setpoints
+	Return   time.Time // zero: until cancelled
+	Recovery time.Duration
+}
+
+type Schedules struct {
+	House       *Schedule
+	Thermostats map[string]*Schedule
+	Holds       map[string]Hold
+	Away        Away
+
+	// setpoints set directly, used when no schedule applies
+	Manual map[string]Setpoints
+}
@@ -1,11 +1,15 @@
 package mqtt
 
 import (
+	"burlo/pkg/metrics"
 	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
 	"path"
+	"slices"
+	"strings"
+	"sync"
 
 	"github.com/eclipse/paho.golang/autopaho"
 	"github.com/eclipse/paho.golang/paho"
@@ -25,6 +29,14 @@ type Opts struct {
 type Client struct {
 	opts Opts
 	cm   *autopaho.ConnectionManager
+
+	mutex sync.Mutex
+	extra []subscription // added with Subscribe
+}
+
+type subscription struct {
+	topics        []string
+	onPublishRecv func(topic string, payload []byte)
 }
 
 func NewClient(opts Opts) *Client {
@@ -42,13 +54,16 @@ func NewClient(opts Opts) *Client {
 		ConnectPassword:       opts.Pass,
 		OnConnectError: func(err error) {
 			fmt.Println("[Error] on mqtt connect:", err)
+			client.setConnected(false)
 		},
 		ClientConfig: paho.ClientConfig{
 			ClientID: opts.ClientID,
 			OnClientError: func(err error) {
 				fmt.Println("[Error] mqtt client error:", err)
+				client.setConnected(false)
 			},
 			OnServerDisconnect: func(d *paho.Disconnect) {
+				client.setConnected(false)
 				fmt.Print("mqtt disconnected: ")
 				if d.Properties != nil {
 					fmt.Println(d.Properties.ReasonString)
@@ -67,26 +82,19 @@ func NewClient(opts Opts) *Client {
 	}
 	cliCfg.OnConnectionUp = func(cm *autopaho.ConnectionManager, connAck *paho.Connack) {
 		fmt.Println(client.opts.ClientID, "connected to", u.String())
-		if len(subs) > 0 {
-			_, err := cm.Subscribe(context.Background(), &paho.Subscribe{
-				Subscriptions: subs,
-			})
-			if err != nil {
-				fmt.Println("[Error] failed to subscribe:", err)
-			}
-			for _, subopt := range subs {
-				fmt.Printf("%s subscribed to %+v\r\n", client.opts.ClientID, subopt.Topic)
-			}
-		}
+		client.setConnected(true)
+		client.subscribe(cm, slices.Concat(subs, client.extraSubscriptions()))
 	}
-	if opts.OnPublishRecv != nil {
-		cliCfg.ClientConfig.OnPublishReceived = []func(paho.PublishReceived) (bool, error){
-			func(pr paho.PublishReceived) (bool, error) {
-				opts.OnPublishRecv(pr.Packet.Topic, pr.Packet.Payload)
-				return true, nil
-			},
-		}
+	cliCfg.ClientConfig.OnPublishReceived = []func(paho.PublishReceived) (bool, error){
+		func(pr paho.PublishReceived) (bool, error) {
+			metrics.AddCounter("burlo_mqtt_received_total", "MQTT messages received", 1, "client_id", opts.ClientID)
+			if onPublishRecv := client.handler(pr.Packet.Topic); onPublishRecv != nil {
+				onPublishRecv(pr.Packet.Topic, pr.Packet.Payload)
+			}
+			return true, nil
+		},
 	}
+
 	client.cm, err = autopaho.NewConnection(opts.Context, cliCfg)
 	if err != nil {
 		panic(err)
@@ -98,15 +106,102 @@ func NewClient(opts Opts) *Client {
 }
 
 func (c *Client) Publish(retain bool, topic string, data interface{}) error {
+	return c.PublishTo(retain, path.Join(c.opts.TopicPrefix, topic), data)
+}
+
+// PublishTo publishes to the topic as is, without the topic prefix
+func (c *Client) PublishTo(retain bool, topic string, data interface{}) error {
 	payload, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
 	_, err = c.cm.Publish(c.opts.Context, &paho.Publish{
 		QoS:     1,
-		Topic:   path.Join(c.opts.TopicPrefix, topic),
+		Topic:   topic,
 		Retain:  retain,
 		Payload: payload,
 	})
+	metrics.AddCounter("burlo_mqtt_published_total", "MQTT messages published", 1, "client_id", c.opts.ClientID)
+	if err != nil {
+		metrics.AddCounter("burlo_mqtt_publish_errors_total", "MQTT messages that failed to publish", 1, "client_id", c.opts.ClientID)
+	}
 	return err
 }
+
+func (c *Client) setConnected(connected bool) {
+	metrics.SetGauge("burlo_mqtt_connected", "1 while connected to the MQTT broker", metrics.Bool(connected), "client_id", c.opts.ClientID)
+}
+
+// Subscribe adds subscriptions to a connected client, eg. for Home
+// Assistant to share the service connection. The topics are used as
+// is, without the topic prefix, and their messages are passed to
+// onPublishRecv instead of Opts.OnPublishRecv.
+func (c *Client) Subscribe(topics []string, onPublishRecv func(topic string, payload []byte)) {
+	c.mutex.Lock()
+	c.extra = append(c.extra, subscription{topics, onPublishRecv})
+	c.mutex.Unlock()
+
+	var subs []paho.SubscribeOptions
+	for _, topic := range topics {
+		subs = append(subs, paho.SubscribeOptions{Topic: topic, QoS: 1})
+	}
+	// renewed with the others when reconnecting
+	c.subscribe(c.cm, subs)
+}
+
+func (c *Client) subscribe(cm *autopaho.ConnectionManager, subs []paho.SubscribeOptions) {
+	if len(subs) == 0 {
+		return
+	}
+	_, err := cm.Subscribe(context.Background(), &paho.Subscribe{
+		Subscriptions: subs,
+	})
+	if err != nil {
+		fmt.Println("[Error] failed to subscribe:", err)
+	}
+	for _, subopt := range subs {
+		fmt.Printf("%s subscribed to %+v\r\n", c.opts.ClientID, subopt.Topic)
+	}
+}
+
+func (c *Client) extraSubscriptions() []paho.SubscribeOptions {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var subs []paho.SubscribeOptions
+	for _, sub := range c.extra {
+		for _, topic := range sub.topics {
+			subs = append(subs, paho.SubscribeOptions{Topic: topic, QoS: 1})
+		}
+	}
+	return subs
+}
+
+// handler is the callback for a received topic
+func (c *Client) handler(topic string) func(topic string, payload []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, sub := range c.extra {
+		for _, filter := range sub.topics {
+			if matchTopic(filter, topic) {
+				return sub.onPublishRecv
+			}
+		}
+	}
+	return c.opts.OnPublishRecv
+}
+
+// matchTopic reports if topic matches the filter,
+// with the + and # wildcards
+func matchTopic(filter, topic string) bool {
+	filters := strings.Split(filter, "/")
+	levels := strings.Split(topic, "/")
+	for i, f := range filters {
+		if f == "#" {
+			return true
+		}
+		if i >= len(levels) || (f != "+" && f != levels[i]) {
+			return false
+		}
+	}
+	return len(filters) == len(levels)
+}
@@ -0,0 +1,47 @@
+package mqtt
+
+import "testing"
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{"homeassistant/status", "homeassistant/status", true},
+		{"homeassistant/status", "homeassistant/status/x", false},
+		{"burlo/ha/thermostat/+/+", "burlo/ha/thermostat/01/heat_setpoint", true},
+		{"burlo/ha/thermostat/+/+", "burlo/ha/thermostat/01", false},
+		{"burlo/ha/controller/override/#", "burlo/ha/controller/override/mode", true},
+		{"burlo/ha/controller/override/#", "burlo/controller/override/mode", false},
+		{"burlo/#", "burlo", true},
+	}
+	for _, tt := range tests {
+		if got := matchTopic(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("matchTopic(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
+
+// messages of the added subscriptions don't reach the service handler
+func TestHandler(t *testing.T) {
+	var got string
+	client := &Client{opts: Opts{
+		OnPublishRecv: func(topic string, payload []byte) { got = "service " + topic },
+	}}
+	client.extra = append(client.extra, subscription{
+		topics:        []string{"homeassistant/status", "burlo/ha/#"},
+		onPublishRecv: func(topic string, payload []byte) { got = "extra " + topic },
+	})
+
+	for topic, want := range map[string]string{
+		"burlo/controller/status": "service burlo/controller/status",
+		"burlo/ha/controller/x":   "extra burlo/ha/controller/x",
+		"homeassistant/status":    "extra homeassistant/status",
+	} {
+		client.handler(topic)(topic, nil)
+		if got != want {
+			t.Errorf("%s: got %q, want %q", topic, got, want)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package notification
+
+import "fmt"
+
+// Publisher is an mqtt client, eg. *mqtt.Client
+type Publisher interface {
+	Publish(retain bool, topic string, data interface{}) error
+}
+
+// MQTT publishes messages as json, eg. to burlo/notifications
+// for Home Assistant
+type MQTT struct {
+	publisher Publisher
+	topic     string
+}
+
+func NewMQTT(publisher Publisher, topic string) MQTT {
+	return MQTT{publisher: publisher, topic: topic}
+}
+
+func (m MQTT) Send(msg Message) error {
+	if m.publisher == nil {
+		return fmt.Errorf("mqtt: not connected")
+	}
+	const RETAIN = false
+	return m.publisher.Publish(RETAIN, m.topic, msg)
+}
@@ -0,0 +1,343 @@
+// Package notification turns events into notifications using configurable
+// rules: each event type can have its own topic, priority, tags, click and
+// action urls, a cooldown to deduplicate repeated events, or be batched into
+// a daily digest. Minor events are held during quiet hours, and delivery is
+// retried with exponential backoff. Rules choose the transports: ntfy, email
+// (smtp), a json webhook or mqtt.
+package notification
+
+import (
+	"burlo/config"
+	"burlo/pkg/clock"
+	"burlo/pkg/metrics"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	PriorityMin     = 1
+	PriorityLow     = 2
+	PriorityDefault = 3
+	PriorityHigh    = 4
+	PriorityUrgent  = 5
+)
+
+// Event is something worth telling someone about
+type Event struct {
+	Type     string // selects the rule, eg. "low_battery"
+	Key      string // what the event is about, eg. the sensor id
+	Title    string
+	Message  string
+	Tags     []string
+	Priority int // used when the rule doesn't set one
+}
+
+// Message is an event after the rules were applied
+type Message struct {
+	Event    string
+	Topic    string
+	Title    string
+	Message  string
+	Tags     []string
+	Priority int
+	Click    string
+	Actions  []config.NotifyAction
+	Time     time.Time
+
+	Transports []string `json:"-"`
+}
+
+// Transport delivers messages, eg. to a ntfy server
+type Transport interface {
+	Send(msg Message) error
+}
+
+// messages are delivered one at a time,
+// a hung server must not hold up the others
+var sendTimeout = 10 * time.Second
+
+// DefaultRules apply to events without a configured rule
+var DefaultRules = []config.NotifyRule{
+	// sensors report every few minutes while their battery is low
+	{Event: "low_battery", Cooldown: 24 * 60, Digest: true},
+}
+
+const maxBackoff = 5 * time.Minute
+
+type Notifier struct {
+	cfg        config.Notify
+	transports map[string]Transport
+	now        func() time.Time
+	backoff    time.Duration // before the first retry
+
+	events     chan timedEvent
+	outbox     chan Message
+	lastSent   map[string]time.Time
+	held       []Message // during quiet hours
+	digest     []Message
+	lastDigest time.Time
+
+	quietHours *clock.Window // nil without quiet hours
+	digestTime *clock.Clock  // nil without a daily digest
+}
+
+type timedEvent struct {
+	Event
+	time time.Time
+}
+
+// New creates a notifier delivering to the named transports,
+// it fails on an invalid quiet_hours or digest_time
+func New(cfg config.Notify, transports map[string]Transport) (*Notifier, error) {
+	if cfg.Retries <= 0 {
+		cfg.Retries = 5
+	}
+	if len(cfg.Transports) == 0 {
+		cfg.Transports = []string{"ntfy"}
+	}
+	n := &Notifier{
+		cfg:        cfg,
+		transports: transports,
+		now:        time.Now,
+		backoff:    time.Second,
+		events:     make(chan timedEvent, 100),
+		outbox:     make(chan Message, 100),
+		lastSent:   make(map[string]time.Time),
+	}
+	if cfg.QuietHours != "" {
+		window, err := clock.ParseWindow(cfg.QuietHours)
+		if err != nil {
+			return nil, fmt.Errorf("quiet_hours: %w", err)
+		}
+		n.quietHours = &window
+	}
+	if cfg.DigestTime != "" {
+		due, err := clock.Parse(cfg.DigestTime)
+		if err != nil {
+			return nil, fmt.Errorf("digest_time: %w", err)
+		}
+		n.digestTime = &due
+	}
+	return n, nil
+}
+
+// Notify queues an event, it never blocks the caller
+func (n *Notifier) Notify(e Event) {
+	select {
+	case n.events <- timedEvent{e, n.now()}:
+	default:
+		fmt.Println("[notify] queue full, dropped:", e.Title)
+		countDropped()
+	}
+}
+
+// Run applies the rules and delivers the messages
+// until the context is cancelled
+func (n *Notifier) Run(ctx context.Context) {
+	go n.deliver(ctx)
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-n.events:
+			n.handle(e.Event, e.time)
+		case t := <-ticker.C:
+			n.tick(t)
+		}
+	}
+}
+
+func (n *Notifier) rule(eventType string) config.NotifyRule {
+	for _, rules := range [][]config.NotifyRule{n.cfg.Rules, DefaultRules} {
+		for _, rule := range rules {
+			if rule.Event == eventType {
+				return rule
+			}
+		}
+	}
+	for _, rule := range n.cfg.Rules {
+		if rule.Event == "*" {
+			return rule
+		}
+	}
+	return config.NotifyRule{}
+}
+
+// handle applies the rules to an event received at time t
+func (n *Notifier) handle(e Event, t time.Time) {
+	metrics.AddCounter("burlo_notification_events_total", "Events received by the notifier", 1, "event", e.Type)
+	rule := n.rule(e.Type)
+	if rule.Mute {
+		countSuppressed(e.Type, "mute")
+		return
+	}
+	key := e.Type + "/" + e.Key
+	cooldown := time.Duration(rule.Cooldown) * time.Minute
+	if last, ok := n.lastSent[key]; ok && t.Sub(last) < cooldown {
+		countSuppressed(e.Type, "cooldown")
+		return
+	}
+	n.lastSent[key] = t
+
+	msg := Message{
+		Event:    e.Type,
+		Topic:    firstOf(rule.Topic, n.cfg.Topic),
+		Title:    e.Title,
+		Message:  e.Message,
+		Tags:     slices.Concat(e.Tags, rule.Tags),
+		Priority: e.Priority,
+		Click:    rule.Click,
+		Actions:  rule.Actions,
+		Time:     t,
+
+		Transports: rule.Transports,
+	}
+	if len(msg.Transports) == 0 {
+		msg.Transports = n.cfg.Transports
+	}
+	if rule.Priority > 0 {
+		msg.Priority = rule.Priority
+	}
+
+	switch {
+	// without a digest time they are sent like the other events
+	case rule.Digest && n.digestTime != nil:
+		n.digest = append(n.digest, msg)
+	case msg.Priority < PriorityHigh && n.quiet(t):
+		n.held = append(n.held, msg)
+	default:
+		n.send(msg)
+	}
+}
+
+// tick releases the held messages after the quiet hours,
+// and sends the digest once a day
+func (n *Notifier) tick(t time.Time) {
+	if len(n.held) > 0 && !n.quiet(t) {
+		n.send(summary("During quiet hours", n.held, n.cfg, t))
+		n.held = nil
+	}
+	if n.digestTime == nil {
+		return
+	}
+	due := n.digestTime.On(t)
+	if !t.Before(due) && n.lastDigest.Before(due) {
+		if len(n.digest) > 0 {
+			n.send(summary("Daily summary", n.digest, n.cfg, t))
+			n.digest = nil
+		}
+		n.lastDigest = due
+	}
+}
+
+func (n *Notifier) send(msg Message) {
+	select {
+	case n.outbox <- msg:
+	default:
+		fmt.Println("[notify] outbox full, dropped:", msg.Title)
+		countDropped()
+	}
+}
+
+// deliver sends the messages in order to each of their
+// transports, retrying with backoff
+func (n *Notifier) deliver(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-n.outbox:
+			for _, name := range msg.Transports {
+				transport, ok := n.transports[name]
+				if !ok {
+					fmt.Printf("[notify] transport '%s' is not configured, dropped: %s\r\n", name, msg.Title)
+					countDropped()
+					continue
+				}
+				if !n.retry(ctx, name, transport, msg) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// retry sends until it succeeds or runs out of attempts,
+// false when the context was cancelled
+func (n *Notifier) retry(ctx context.Context, name string, transport Transport, msg Message) bool {
+	backoff := n.backoff
+	for attempt := 1; ; attempt++ {
+		err := transport.Send(msg)
+		if err == nil {
+			metrics.AddCounter("burlo_notifications_sent_total", "Notifications delivered", 1, "transport", name, "event", msg.Event)
+			return true
+		}
+		if attempt >= n.cfg.Retries {
+			fmt.Printf("[notify] %s: giving up on '%s' after %d attempts: %v\r\n", name, msg.Title, attempt, err)
+			metrics.AddCounter("burlo_notifications_failed_total", "Notifications given up on after the retries", 1, "transport", name, "event", msg.Event)
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+// summary batches messages into one, with the highest priority,
+// sent to every transport used by the messages
+func summary(title string, msgs []Message, cfg config.Notify, t time.Time) Message {
+	var lines []string
+	var transports []string
+	priority := 0
+	for _, msg := range msgs {
+		lines = append(lines, fmt.Sprintf("%s %s: %s", msg.Time.Format("Jan 2 15:04"), msg.Title, msg.Message))
+		priority = max(priority, msg.Priority)
+		for _, name := range msg.Transports {
+			if !slices.Contains(transports, name) {
+				transports = append(transports, name)
+			}
+		}
+	}
+	return Message{
+		Event:    "summary",
+		Topic:    cfg.Topic,
+		Title:    fmt.Sprintf("%s (%d)", title, len(msgs)),
+		Message:  strings.Join(lines, "\n"),
+		Tags:     []string{"house_with_garden", "memo"},
+		Priority: priority,
+		Time:     t,
+
+		Transports: transports,
+	}
+}
+
+func countDropped() {
+	metrics.AddCounter("burlo_notifications_dropped_total", "Notifications dropped, queue full or transport missing", 1)
+}
+
+func countSuppressed(event, reason string) {
+	metrics.AddCounter("burlo_notifications_suppressed_total", "Events not sent, muted or in cooldown", 1, "event", event, "reason", reason)
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// quiet reports if t is within the quiet hours
+func (n *Notifier) quiet(t time.Time) bool {
+	return n.quietHours != nil && n.quietHours.Contains(t)
+}
@@ -0,0 +1,165 @@
+package notification
+
+import (
+	"burlo/config"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeTransport struct {
+	mutex sync.Mutex
+	fails int
+	sent  []Message
+}
+
+func (f *fakeTransport) Send(msg Message) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.fails > 0 {
+		f.fails -= 1
+		return errors.New("unavailable")
+	}
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+func (f *fakeTransport) messages() []Message {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]Message(nil), f.sent...)
+}
+
+// outbox drains the messages waiting for delivery
+func outbox(n *Notifier) []Message {
+	var msgs []Message
+	for {
+		select {
+		case msg := <-n.outbox:
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+}
+
+func TestRules(t *testing.T) {
+	n, err := New(config.Notify{
+		Topic:      "burlo",
+		QuietHours: "22:00-07:00",
+		DigestTime: "08:00",
+		Rules: []config.NotifyRule{
+			{Event: "condensation", Topic: "alarms", Priority: PriorityUrgent, Tags: []string{"rotating_light"}, Click: "http://dashboard"},
+			{Event: "input_health", Cooldown: 60},
+			{Event: "window", Mute: true},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	n.handle(Event{Type: "condensation", Title: "tripped", Tags: []string{"droplet"}}, clock)
+	msgs := outbox(n)
+	if len(msgs) != 1 || msgs[0].Topic != "alarms" || msgs[0].Priority != PriorityUrgent ||
+		msgs[0].Click != "http://dashboard" || strings.Join(msgs[0].Tags, ",") != "droplet,rotating_light" {
+		t.Fatalf("expected the condensation rule to apply, got %+v", msgs)
+	}
+
+	n.handle(Event{Type: "window", Title: "open"}, clock)
+	if msgs := outbox(n); len(msgs) != 0 {
+		t.Errorf("expected muted events to be dropped, got %+v", msgs)
+	}
+
+	// the same input is only reported once per cooldown
+	n.handle(Event{Type: "input_health", Key: "current", Title: "stale"}, clock)
+	n.handle(Event{Type: "input_health", Key: "current", Title: "stale"}, clock.Add(10*time.Minute))
+	n.handle(Event{Type: "input_health", Key: "forecast", Title: "stale"}, clock.Add(10*time.Minute))
+	n.handle(Event{Type: "input_health", Key: "current", Title: "stale"}, clock.Add(61*time.Minute))
+	if msgs := outbox(n); len(msgs) != 3 || msgs[0].Topic != "burlo" {
+		t.Errorf("expected 3 messages after the cooldown, got %+v", msgs)
+	}
+
+	// minor events wait for the end of the quiet hours
+	night := time.Date(2024, 6, 1, 23, 0, 0, 0, time.UTC)
+	n.handle(Event{Type: "mode", Title: "heating"}, night)
+	n.handle(Event{Type: "state", Title: "standby"}, night)
+	n.handle(Event{Type: "dhw", Title: "slow", Priority: PriorityHigh}, night)
+	if msgs := outbox(n); len(msgs) != 1 || msgs[0].Title != "slow" {
+		t.Errorf("expected only the high priority event during quiet hours, got %+v", msgs)
+	}
+	n.tick(night.Add(time.Hour))
+	n.tick(night.Add(8 * time.Hour))
+	if msgs := outbox(n); len(msgs) != 1 || !strings.Contains(msgs[0].Message, "heating") || !strings.Contains(msgs[0].Message, "standby") {
+		t.Errorf("expected one summary after the quiet hours, got %+v", msgs)
+	}
+
+	// low battery is reported once a day, in the digest
+	morning := time.Date(2024, 6, 2, 7, 30, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		n.handle(Event{Type: "low_battery", Key: "01", Title: "low battery"}, morning.Add(time.Duration(i)*time.Minute))
+	}
+	n.handle(Event{Type: "low_battery", Key: "02", Title: "low battery"}, morning)
+	n.tick(morning.Add(15 * time.Minute))
+	if msgs := outbox(n); len(msgs) != 0 {
+		t.Errorf("expected nothing before the digest time, got %+v", msgs)
+	}
+	n.tick(morning.Add(30 * time.Minute))
+	n.tick(morning.Add(31 * time.Minute))
+	msgs = outbox(n)
+	if len(msgs) != 1 || strings.Count(msgs[0].Message, "\n") != 1 {
+		t.Errorf("expected one digest with both sensors, got %+v", msgs)
+	}
+}
+
+// without digest_time the digest events aren't held
+func TestNoDigestTime(t *testing.T) {
+	n, err := New(config.Notify{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := time.Date(2024, 6, 2, 7, 30, 0, 0, time.UTC)
+	n.handle(Event{Type: "low_battery", Key: "01", Title: "low battery"}, clock)
+	n.handle(Event{Type: "low_battery", Key: "01", Title: "low battery"}, clock.Add(time.Hour))
+	if msgs := outbox(n); len(msgs) != 1 || len(n.digest) != 0 {
+		t.Errorf("expected low battery to be sent once, got %+v", msgs)
+	}
+}
+
+// invalid times are rejected up front, not read as midnight
+func TestInvalidTimes(t *testing.T) {
+	for _, cfg := range []config.Notify{
+		{QuietHours: "22:00"},
+		{QuietHours: "22:00-7am"},
+		{DigestTime: "8am"},
+		{DigestTime: "25:00"},
+	} {
+		if _, err := New(cfg, nil); err == nil {
+			t.Errorf("expected an error for %+v", cfg)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	transport := &fakeTransport{fails: 2}
+	n, err := New(config.Notify{Retries: 3}, map[string]Transport{"ntfy": transport})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.backoff = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Run(ctx)
+
+	n.Notify(Event{Type: "mode", Title: "heating"})
+	deadline := time.Now().Add(time.Second)
+	for len(transport.messages()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if msgs := transport.messages(); len(msgs) != 1 || msgs[0].Title != "heating" {
+		t.Errorf("expected delivery on the third attempt, got %+v", msgs)
+	}
+}
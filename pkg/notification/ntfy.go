@@ -0,0 +1,30 @@
+package notification
+
+import (
+	"burlo/pkg/ntfy"
+)
+
+// Ntfy delivers messages to a ntfy server
+type Ntfy struct {
+	client ntfy.Notify
+}
+
+func NewNtfy(host, topic string) Ntfy {
+	return Ntfy{client: ntfy.New(host, topic)}
+}
+
+func (n Ntfy) Send(msg Message) error {
+	var actions []ntfy.Action
+	for _, action := range msg.Actions {
+		actions = append(actions, ntfy.Action{Label: action.Label, URL: action.URL})
+	}
+	return n.client.Send(ntfy.Message{
+		Topic:    msg.Topic,
+		Title:    msg.Title,
+		Message:  msg.Message,
+		Tags:     msg.Tags,
+		Priority: msg.Priority,
+		Click:    msg.Click,
+		Actions:  actions,
+	})
+}
@@ -0,0 +1,103 @@
+package notification
+
+import (
+	"burlo/config"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTP delivers messages by email
+type SMTP struct {
+	cfg config.NotifySMTP
+}
+
+func NewSMTP(cfg config.NotifySMTP) SMTP {
+	return SMTP{cfg: cfg}
+}
+
+func (s SMTP) Send(msg Message) error {
+	if len(s.cfg.To) == 0 {
+		return fmt.Errorf("smtp: no recipients")
+	}
+	host, _, err := net.SplitHostPort(s.cfg.Address)
+	if err != nil {
+		return err
+	}
+
+	// smtp.SendMail has no timeout, a hung server would block delivery
+	conn, err := net.DialTimeout("tcp", s.cfg.Address, sendTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(sendTimeout))
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: host})
+		if err != nil {
+			return err
+		}
+	}
+	if s.cfg.User != "" {
+		err = c.Auth(smtp.PlainAuth("", s.cfg.User, s.cfg.Pass, host))
+		if err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(s.cfg.From); err != nil {
+		return err
+	}
+	for _, to := range s.cfg.To {
+		if err = c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(s.email(msg)); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (s SMTP) email(msg Message) []byte {
+	var b bytes.Buffer
+	header := func(key, value string) {
+		fmt.Fprintf(&b, "%s: %s\r\n", key, value)
+	}
+	header("From", s.cfg.From)
+	header("To", strings.Join(s.cfg.To, ", "))
+	header("Subject", "[burlo] "+strings.ReplaceAll(msg.Title, "\n", " "))
+	header("Date", msg.Time.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	if msg.Priority >= PriorityHigh {
+		header("X-Priority", "1")
+		header("Importance", "high")
+	}
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Message, "\n", "\r\n"))
+	if msg.Click != "" {
+		b.WriteString("\r\n\r\n" + msg.Click)
+	}
+	for _, action := range msg.Actions {
+		fmt.Fprintf(&b, "\r\n%s: %s", action.Label, action.URL)
+	}
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
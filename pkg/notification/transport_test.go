@@ -0,0 +1,201 @@
+package notification
+
+import (
+	"bufio"
+	"burlo/config"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testMessage = Message{
+	Event:    "condensation",
+	Title:    "Condensation interlock tripped",
+	Message:  "supply water is near the dewpoint",
+	Priority: PriorityUrgent,
+	Click:    "http://dashboard",
+	Time:     time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC),
+}
+
+// fakeSMTP is a minimal smtp server, it records one email
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	emails := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+		reply("220 fake")
+		var data strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 fake")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				emails <- data.String()
+				reply("250 ok")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				return
+			default: // MAIL, RCPT
+				reply("250 ok")
+			}
+		}
+	}()
+	return listener.Addr().String(), emails
+}
+
+func TestSMTP(t *testing.T) {
+	addr, emails := fakeSMTP(t)
+	transport := NewSMTP(config.NotifySMTP{
+		Address: addr,
+		From:    "burlo@example.com",
+		To:      []string{"me@example.com"},
+	})
+	err := transport.Send(testMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := <-emails
+	for _, want := range []string{
+		"Subject: [burlo] Condensation interlock tripped",
+		"To: me@example.com",
+		"X-Priority: 1",
+		"supply water is near the dewpoint",
+		"http://dashboard",
+	} {
+		if !strings.Contains(email, want) {
+			t.Errorf("expected %q in the email:\n%s", want, email)
+		}
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var payload map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer server.Close()
+
+	err := NewWebhook(server.URL).Send(testMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, _ := payload["text"].(string)
+	if !strings.HasPrefix(text, "Condensation interlock tripped\n") || payload["content"] != text {
+		t.Errorf("expected slack and discord text, got %v", payload)
+	}
+	if payload["Event"] != "condensation" || payload["Priority"] != float64(PriorityUrgent) {
+		t.Errorf("expected the message fields, got %v", payload)
+	}
+}
+
+// a server that accepts but never answers must not block delivery
+func TestTransportTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { sendTimeout = timeout }(sendTimeout)
+	sendTimeout = 100 * time.Millisecond
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	addr := listener.Addr().String()
+
+	transports := map[string]Transport{
+		"smtp":    NewSMTP(config.NotifySMTP{Address: addr, To: []string{"me@example.com"}}),
+		"webhook": NewWebhook("http://" + addr),
+	}
+	for name, transport := range transports {
+		start := time.Now()
+		if err := transport.Send(testMessage); err == nil {
+			t.Errorf("%s: expected a timeout error", name)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: send took %v", name, elapsed)
+		}
+	}
+}
+
+type fakePublisher chan Message
+
+func (f fakePublisher) Publish(retain bool, topic string, data interface{}) error {
+	msg := data.(Message)
+	msg.Topic = topic
+	f <- msg
+	return nil
+}
+
+// rules choose the transports, the rest use the defaults
+func TestTransportSelection(t *testing.T) {
+	ntfy, email, mqttc := &fakeTransport{}, &fakeTransport{}, make(fakePublisher, 1)
+	n, err := New(config.Notify{
+		Transports: []string{"ntfy"},
+		Rules: []config.NotifyRule{
+			{Event: "condensation", Transports: []string{"ntfy", "smtp", "mqtt"}},
+		},
+	}, map[string]Transport{
+		"ntfy": ntfy,
+		"smtp": email,
+		"mqtt": NewMQTT(mqttc, "notifications"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Run(ctx)
+
+	n.Notify(Event{Type: "mode", Title: "heating"})
+	n.Notify(Event{Type: "condensation", Title: "tripped"})
+	var published Message
+	select {
+	case published = <-mqttc:
+	case <-time.After(time.Second):
+		t.Fatal("expected the condensation event on mqtt")
+	}
+	if published.Topic != "notifications" || published.Title != "tripped" {
+		t.Errorf("expected the condensation event on mqtt, got %+v", published)
+	}
+	if msgs := ntfy.messages(); len(msgs) != 2 {
+		t.Errorf("expected both events on ntfy, got %+v", msgs)
+	}
+	if msgs := email.messages(); len(msgs) != 1 || msgs[0].Title != "tripped" {
+		t.Errorf("expected only the condensation event by email, got %+v", msgs)
+	}
+}
@@ -0,0 +1,52 @@
+package notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Webhook posts messages as json, the payload works as is with
+// Slack ("text"), Discord ("content") and Matrix hookshot ("text")
+// incoming webhooks, and has every field for anything else
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+type webhookPayload struct {
+	Text    string `json:"text"`
+	Content string `json:"content"`
+	Message
+}
+
+func NewWebhook(url string) Webhook {
+	return Webhook{url: url, client: &http.Client{Timeout: sendTimeout}}
+}
+
+func (w Webhook) Send(msg Message) error {
+	lines := []string{msg.Title, msg.Message}
+	if msg.Click != "" {
+		lines = append(lines, msg.Click)
+	}
+	text := strings.Join(lines, "\n")
+	payload, err := json.Marshal(webhookPayload{
+		Text:    text,
+		Content: text,
+		Message: msg,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook: unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
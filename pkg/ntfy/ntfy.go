@@ -3,27 +3,83 @@ package ntfy
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// notifications are delivered one at a time,
+// a hung server must not hold up the others
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
 type Notify struct {
+	host    string
 	address string
 }
 
+// Message is a ntfy message with its optional headers
+type Message struct {
+	Topic    string // overrides the client topic
+	Title    string
+	Message  string
+	Tags     []string
+	Priority int    // 1 (min) to 5 (urgent), 0 is the server default
+	Click    string // url opened when the notification is clicked
+	Actions  []Action
+}
+
+// Action is a "view" action button, opens the url
+type Action struct {
+	Label string
+	URL   string
+}
+
 func New(host, topic string) Notify {
 	return Notify{
+		host:    host,
 		address: fmt.Sprintf("http://%s/%s", host, topic),
 	}
 }
 
 func (ntfy Notify) Publish(title, message string, tags []string) error {
-	req, _ := http.NewRequest("POST", ntfy.address, strings.NewReader(message))
-	if len(title) > 0 {
-		req.Header.Set("Title", title)
+	return ntfy.Send(Message{Title: title, Message: message, Tags: tags})
+}
+
+func (ntfy Notify) Send(msg Message) error {
+	address := ntfy.address
+	if msg.Topic != "" {
+		address = fmt.Sprintf("http://%s/%s", ntfy.host, msg.Topic)
+	}
+	req, err := http.NewRequest("POST", address, strings.NewReader(msg.Message))
+	if err != nil {
+		return err
+	}
+	if len(msg.Title) > 0 {
+		req.Header.Set("Title", msg.Title)
+	}
+	if len(msg.Tags) > 0 {
+		req.Header.Set("Tags", strings.Join(msg.Tags, ","))
+	}
+	if msg.Priority > 0 {
+		req.Header.Set("Priority", strconv.Itoa(msg.Priority))
+	}
+	if len(msg.Click) > 0 {
+		req.Header.Set("Click", msg.Click)
+	}
+	if len(msg.Actions) > 0 {
+		var actions []string
+		for _, action := range msg.Actions {
+			actions = append(actions, fmt.Sprintf("view, %s, %s", action.Label, action.URL))
+		}
+		req.Header.Set("Actions", strings.Join(actions, "; "))
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
 	}
-	if len(tags) > 0 {
-		req.Header.Set("Tags", strings.Join(tags, ","))
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ntfy: unexpected status code: %d", resp.StatusCode)
 	}
-	_, err := http.DefaultClient.Do(req)
-	return err
+	return nil
 }
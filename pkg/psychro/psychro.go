@@ -0,0 +1,112 @@
+// Package psychro has psychrometric calculations for moist air.
+// Temperatures are in degC and relative humidity in percent (0-100).
+// Vapour pressure uses the Arden Buck equation over water, which is
+// accurate to about 0.05% between -40 and 50 degC.
+package psychro
+
+import "math"
+
+// StandardPressure at sea level, in hPa
+const StandardPressure = 1013.25
+
+// Arden Buck constants (1996) over water
+const (
+	buckA = 6.1121 // hPa
+	buckB = 18.678
+	buckC = 257.14 // degC
+	buckD = 234.5  // degC
+)
+
+// SaturationVaporPressure of water vapour at temp, in hPa
+func SaturationVaporPressure(temp float32) float32 {
+	t := float64(temp)
+	return float32(buckA * math.Exp((buckB-t/buckD)*(t/(buckC+t))))
+}
+
+// VaporPressure of the water vapour in the air, in hPa
+func VaporPressure(temp, relH float32) float32 {
+	return SaturationVaporPressure(temp) * relH / 100
+}
+
+// below this the dewpoint is that of minRelH, dry air has no dewpoint
+// (and sensors without humidity report 0), it stays finite for json
+const minRelH = 1 // %
+
+// Dewpoint is the temperature at which the air would saturate
+func Dewpoint(temp, relH float32) float32 {
+	relH = max(relH, minRelH)
+	// invert the Arden Buck equation exactly, the usual Magnus style
+	// inversion drifts by up to 0.4 degC in hot, humid air
+	l := math.Log(float64(VaporPressure(temp, relH)) / buckA)
+	b := buckB - l
+	return float32(buckD / 2 * (b - math.Sqrt(b*b-4*l*buckC/buckD)))
+}
+
+// RelativeHumidity of air at temp with the given dewpoint, in percent
+func RelativeHumidity(temp, dewpoint float32) float32 {
+	return min(100, 100*SaturationVaporPressure(dewpoint)/SaturationVaporPressure(temp))
+}
+
+// AbsoluteHumidity is the mass of water vapour per volume of air, in g/m³
+func AbsoluteHumidity(temp, relH float32) float32 {
+	e := float64(VaporPressure(temp, relH)) * 100 // Pa
+	const Rv = 461.5                              // J/(kg·K), water vapour
+	return float32(e / (Rv * (float64(temp) + 273.15)) * 1000)
+}
+
+// HumidityRatio is the mass of water vapour per mass of dry air, in
+// kg/kg, at standard pressure. It is the moisture content of the air,
+// which doesn't change as air is heated or cooled
+func HumidityRatio(temp, relH float32) float32 {
+	return HumidityRatioAt(temp, relH, StandardPressure)
+}
+
+// HumidityRatioAt is HumidityRatio at pressure, in hPa
+func HumidityRatioAt(temp, relH, pressure float32) float32 {
+	e := float64(VaporPressure(temp, relH))
+	return float32(0.621945 * e / (float64(pressure) - e))
+}
+
+// Enthalpy of moist air per mass of dry air, in kJ/kg, at standard pressure
+func Enthalpy(temp, relH float32) float32 {
+	t := float64(temp)
+	w := float64(HumidityRatio(temp, relH))
+	return float32(1.006*t + w*(2501+1.86*t))
+}
+
+// WetBulb temperature, using Stull (2011). Accurate to within 1 degC
+// between 5% and 99% RH and -20 to 50 degC at standard pressure
+func WetBulb(temp, relH float32) float32 {
+	t, rh := float64(temp), float64(relH)
+	return float32(t*math.Atan(0.151977*math.Sqrt(rh+8.313659)) +
+		math.Atan(t+rh) - math.Atan(rh-1.676331) +
+		0.00391838*math.Pow(rh, 1.5)*math.Atan(0.023101*rh) -
+		4.686035)
+}
+
+// HeatIndex is the apparent temperature, using the US National
+// Weather Service regression (Rothfusz, with its adjustments)
+func HeatIndex(temp, relH float32) float32 {
+	t := float64(temp)*9/5 + 32 // the regression is in degF
+	rh := float64(relH)
+
+	hi := 0.5 * (t + 61.0 + (t-68.0)*1.2 + rh*0.094)
+	if (hi+t)/2 >= 80 {
+		hi = -42.379 + 2.04901523*t + 10.14333127*rh -
+			0.22475541*t*rh - 0.00683783*t*t -
+			0.05481717*rh*rh + 0.00122874*t*t*rh +
+			0.00085282*t*rh*rh - 0.00000199*t*t*rh*rh
+
+		if rh < 13 && t >= 80 && t <= 112 {
+			hi -= ((13 - rh) / 4) * math.Sqrt((17-math.Abs(t-95))/17)
+		} else if rh > 85 && t >= 80 && t <= 87 {
+			hi += ((rh - 85) / 10) * ((87 - t) / 5)
+		}
+	}
+	return FahrenheitToCelsius(float32(hi))
+}
+
+// FahrenheitToCelsius converts degF, eg. the DX2W registers, to degC
+func FahrenheitToCelsius(fahrenheit float32) float32 {
+	return (fahrenheit - 32) * 5 / 9
+}
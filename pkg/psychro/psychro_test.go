@@ -0,0 +1,79 @@
+package psychro
+
+import (
+	"math"
+	"testing"
+)
+
+// reference values from the ASHRAE psychrometric tables and the
+// NWS heat index table (rounded as published)
+func TestPsychrometrics(t *testing.T) {
+	tests := []struct {
+		name      string
+		fn        func(temp, relH float32) float32
+		temp      float32
+		relH      float32
+		want      float32
+		tolerance float32
+	}{
+		{"saturation 20°C", func(t, _ float32) float32 { return SaturationVaporPressure(t) }, 20, 0, 23.39, 0.02},
+		{"saturation 0°C", func(t, _ float32) float32 { return SaturationVaporPressure(t) }, 0, 0, 6.112, 0.005},
+		{"saturation 40°C", func(t, _ float32) float32 { return SaturationVaporPressure(t) }, 40, 0, 73.85, 0.1},
+
+		{"dewpoint 20°C 50%", Dewpoint, 20, 50, 9.27, 0.05},
+		{"dewpoint 25°C 60%", Dewpoint, 25, 60, 16.70, 0.05},
+		{"dewpoint 30°C 80%", Dewpoint, 30, 80, 26.17, 0.05},
+		{"dewpoint 21°C 30%", Dewpoint, 21, 30, 2.84, 0.1},
+		{"dewpoint saturated", Dewpoint, 12, 100, 12, 0.01},
+
+		{"absolute humidity 20°C 50%", AbsoluteHumidity, 20, 50, 8.65, 0.05},
+		{"absolute humidity 30°C 100%", AbsoluteHumidity, 30, 100, 30.4, 0.2},
+
+		{"humidity ratio 25°C 50%", HumidityRatio, 25, 50, 0.00988, 0.0001},
+		{"humidity ratio 20°C 100%", HumidityRatio, 20, 100, 0.01475, 0.0001},
+
+		{"enthalpy 25°C 50%", Enthalpy, 25, 50, 50.3, 0.3},
+		{"enthalpy 20°C 100%", Enthalpy, 20, 100, 57.5, 0.3},
+		{"enthalpy 0°C 0%", Enthalpy, 0, 0, 0, 0.01},
+
+		{"wet bulb 20°C 50%", WetBulb, 20, 50, 13.7, 0.3},
+		{"wet bulb 30°C 40%", WetBulb, 30, 40, 20.1, 0.5},
+
+		{"heat index 90°F 70%", HeatIndex, 32.22, 70, 41.1, 0.6},
+		{"heat index 100°F 40%", HeatIndex, 37.78, 40, 43.3, 0.6},
+		{"heat index mild", HeatIndex, 20, 50, 19.6, 0.6},
+
+		{"fahrenheit 32°F", func(t, _ float32) float32 { return FahrenheitToCelsius(t) }, 32, 0, 0, 0.0001},
+		{"fahrenheit 104.5°F", func(t, _ float32) float32 { return FahrenheitToCelsius(t) }, 104.5, 0, 40.28, 0.01},
+		{"fahrenheit -40°F", func(t, _ float32) float32 { return FahrenheitToCelsius(t) }, -40, 0, -40, 0.0001},
+	}
+	for _, tt := range tests {
+		got := tt.fn(tt.temp, tt.relH)
+		if math.Abs(float64(got-tt.want)) > float64(tt.tolerance) {
+			t.Errorf("%s: got %.4f, want %.4f ± %.4f", tt.name, got, tt.want, tt.tolerance)
+		}
+	}
+}
+
+// dewpoint and relative humidity must round trip
+func TestDewpoint_RoundTrip(t *testing.T) {
+	for temp := float32(-20); temp <= 40; temp += 5 {
+		for relH := float32(10); relH <= 100; relH += 10 {
+			dewpoint := Dewpoint(temp, relH)
+			back := RelativeHumidity(temp, dewpoint)
+			if math.Abs(float64(back-relH)) > 0.01 {
+				t.Errorf("%.0f°C %.0f%%: dewpoint %.2f°C gives %.3f%%", temp, relH, dewpoint, back)
+			}
+		}
+	}
+}
+
+// sensors without humidity report 0%, the dewpoint must be encodable
+func TestDewpoint_Dry(t *testing.T) {
+	for _, relH := range []float32{0, -5, 0.5} {
+		dewpoint := Dewpoint(20, relH)
+		if math.IsInf(float64(dewpoint), 0) || math.IsNaN(float64(dewpoint)) || dewpoint > -30 {
+			t.Errorf("20°C %.1f%%: expected a finite dewpoint below -30°C, got %v", relH, dewpoint)
+		}
+	}
+}
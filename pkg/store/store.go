@@ -0,0 +1,144 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store is a small key/value store kept in a single json file, for
+// service state that must survive restarts. Every change rewrites the
+// whole file atomically (write a temp file, fsync, rename), so a crash
+// leaves either the old or the new file, never a partial one.
+type Store struct {
+	path  string
+	mutex sync.Mutex
+	data  map[string]json.RawMessage
+}
+
+// Open loads the store from path, or starts empty if the file doesn't
+// exist yet. An empty path gives an in-memory store that is not saved
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path: path,
+		data: make(map[string]json.RawMessage),
+	}
+	if path == "" {
+		return s, nil
+	}
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening store: %w", err)
+	}
+	err = json.Unmarshal(contents, &s.data)
+	if err != nil {
+		return nil, fmt.Errorf("opening store %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// OpenOrMemory is Open for services, which keep running from an empty
+// in-memory store when the file can't be loaded (so it isn't
+// overwritten). The error is logged after logPrefix, eg. "[controller]"
+func OpenOrMemory(path, logPrefix string) *Store {
+	s, err := Open(path)
+	if err != nil {
+		fmt.Println(logPrefix, "ERROR failed to load state, changes will not be saved:", err)
+		s, _ = Open("")
+	}
+	return s
+}
+
+// Get decodes the value stored under key into v,
+// returning false if there is no such key
+func (s *Store) Get(key string, v any) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	raw, ok := s.data[key]
+	if !ok {
+		return false, nil
+	}
+	err := json.Unmarshal(raw, v)
+	if err != nil {
+		return false, fmt.Errorf("store key %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// Put stores v under key and saves the store,
+// unless the value is unchanged
+func (s *Store) Put(key string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("store key %s: %w", key, err)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if existing, ok := s.data[key]; ok && bytes.Equal(existing, raw) {
+		return nil
+	}
+	s.data[key] = raw
+	return s.save()
+}
+
+func (s *Store) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.data[key]; !ok {
+		return nil
+	}
+	delete(s.data, key)
+	return s.save()
+}
+
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	contents, err := json.MarshalIndent(s.data, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeAtomic(s.path, contents)
+}
+
+func writeAtomic(path string, contents []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("saving store: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly once renamed
+
+	_, err = tmp.Write(contents)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("saving store: %w", err)
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("saving store: %w", err)
+	}
+
+	// make the rename itself durable
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	type state struct {
+		Mode       string
+		LastChange time.Time
+	}
+	want := state{Mode: "HEAT", LastChange: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("dx2w", want); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("names", map[string]string{"01": "kitchen"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("names"); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got state
+	ok, err := s.Get("dx2w", &got)
+	if err != nil || !ok || got != want {
+		t.Errorf("got %+v %v %v, want %+v", got, ok, err, want)
+	}
+	if ok, _ := s.Get("names", &map[string]string{}); ok {
+		t.Error("expected deleted key to be gone")
+	}
+
+	// no temp files left behind
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("expected only the store file, got %d entries", len(entries))
+	}
+}
+
+func TestStore_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	os.WriteFile(path, []byte("{not json"), 0644)
+
+	if _, err := Open(path); err == nil {
+		t.Error("expected an error opening a corrupt store")
+	}
+}
+
+func TestOpenOrMemory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	os.WriteFile(path, []byte("{not json"), 0644)
+
+	s := OpenOrMemory(path, "[test]")
+	if err := s.Put("key", 1); err != nil {
+		t.Fatal(err)
+	}
+	contents, _ := os.ReadFile(path)
+	if string(contents) != "{not json" {
+		t.Errorf("expected the file to be left alone, got %s", contents)
+	}
+}
@@ -4,9 +4,15 @@ cd /usr/userapps/hvac-controller/burlo
 go build ./cmd/weatherd
 go build ./cmd/thermostatd
 go build ./cmd/controllerd
+go build ./cmd/exporterd
+go build ./cmd/monitord
+go build ./cmd/analyticsd
 
 systemctl restart hvac.actuator.phidgets.service
 systemctl restart hvac.controller.service
 systemctl restart hvac.vthermostat.service
 systemctl restart hvac.weather.service
 systemctl restart hvac.modbus.service
+systemctl restart hvac.exporter.service
+systemctl restart hvac.monitor.service
+systemctl restart hvac.analytics.service
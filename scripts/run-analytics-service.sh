@@ -0,0 +1,3 @@
+#!/usr/bin/sh
+cd /usr/userapps/hvac-controller/burlo
+./analyticsd -c ./config/services.toml
@@ -0,0 +1,3 @@
+#!/usr/bin/sh
+cd /usr/userapps/hvac-controller/burlo
+./monitord -c ./config/services.toml
@@ -39,6 +39,7 @@ var fields_1min_interval = []string{
 	"COOLING_MODE",
 	"HEATING_MODE",
 	"COMPRESSOR_RUNTIME",
+	"COMPRESSOR_SESSION_RUNTIME",
 	"TIME_SINCE_LAST_DEFROST",
 	"DEFROST",
 	"OUTSIDE_AIR_TEMP",
@@ -63,4 +64,6 @@ var fields_15sec_interval = []string{
 	"HP_CIRCULATOR",
 	"COMPRESSOR_CALL",
 	"BUFFER_TANK_TEMP",
+	"CONDENSATE_WARNING", // controllerd condensation interlock
+	"DIVERSION_VALVE_CLOSED",
 }
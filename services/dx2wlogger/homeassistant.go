@@ -0,0 +1,95 @@
+package main
+
+import (
+	"burlo/config"
+	"burlo/pkg/dx2w"
+	"burlo/pkg/homeassistant"
+	"burlo/pkg/mqtt"
+	"context"
+	"fmt"
+)
+
+// with the Home Assistant integration enabled, the register values are
+// published (retained) to burlo/dx2w/registers, numbers and booleans by
+// register name, and each register is announced as a sensor
+var hass *homeassistant.Client
+
+const registers_topic = "dx2w/registers"
+
+var dx2w_device = homeassistant.Device{
+	Identifiers:  []string{"burlo_dx2w"},
+	Name:         "DX2W",
+	Manufacturer: "Nordic",
+	Model:        "DX2W",
+}
+
+// the service has no other mqtt connection, it
+// only connects with the integration enabled
+func init_homeassistant(cfg config.ServiceConf) {
+	if !cfg.HomeAssistant.Enabled {
+		return
+	}
+	mqttc := mqtt.NewClient(mqtt.Opts{
+		Context:  context.Background(),
+		Address:  cfg.Mqtt.Address,
+		User:     cfg.Mqtt.User,
+		Pass:     []byte(cfg.Mqtt.Pass),
+		ClientID: "dx2wlogger",
+	})
+	hass = homeassistant.NewClient(cfg, mqttc, nil, nil)
+}
+
+func publish_registers() {
+	if hass == nil {
+		return
+	}
+	global_mutex.Lock()
+	values := make(map[string]interface{}, len(register_map))
+	var entities []homeassistant.Entity
+	for name, value := range register_map {
+		if value.Type == dx2w.BOOL {
+			values[name] = value.Bool
+		} else {
+			values[name] = value.Float32
+		}
+		entities = append(entities, register_entity(name, value))
+	}
+	global_mutex.Unlock()
+
+	err := hass.Publish(true, registers_topic, values)
+	if err != nil {
+		fmt.Println("[homeassistant] publish registers:", err)
+	}
+	hass.Announce(entities...)
+}
+
+func register_entity(name string, value dx2w.Value) homeassistant.Entity {
+	id := homeassistant.ObjectID("dx2w", name)
+	if value.Type == dx2w.BOOL {
+		return homeassistant.BinarySensor(dx2w_device, id, name, registers_topic, name, "")
+	}
+	unit, class := value.Units, ""
+	switch value.Units {
+	case "°F", "°C":
+		class = "temperature"
+	case "kW":
+		class = "power"
+	case "kWh":
+		class = "energy"
+	case "A":
+		class = "current"
+	case "psi":
+		class = "pressure"
+	case "RH%":
+		unit, class = "%", "humidity"
+	case "min":
+		class = "duration"
+	case "hr":
+		unit, class = "h", "duration"
+	}
+	entity := homeassistant.Sensor(dx2w_device, id, name, registers_topic, name, unit, class)
+	if class == "energy" {
+		entity.StateClass = "total_increasing"
+	}
+	return entity
+}
@@ -1,18 +1,22 @@
 package main
 
 import (
+	"burlo/pkg/dx2w"
+	"burlo/pkg/metrics"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 )
 
-func http_server(port string) {
+func http_server(port string, client *dx2w.TCPClient) {
 
 	mux := http.NewServeMux()
 	server := http.Server{
@@ -30,6 +34,9 @@ func http_server(port string) {
 	}()
 
 	mux.HandleFunc("GET /dx2w/registers", GetRegisters())
+	mux.HandleFunc("PUT /dx2w/registers/{name}", PutRegister(client))
+	mux.HandleFunc("GET /dx2w/health", GetHealth(client))
+	mux.HandleFunc("GET /metrics", metrics.Handler())
 	mux.HandleFunc("/", CatchAll())
 
 	log.Println("http_server started, port:", port)
@@ -59,6 +66,62 @@ func GetRegisters() http.HandlerFunc {
 		global_mutex.Lock()
 		ref := register_map
 		global_mutex.Unlock()
+
+		// optionally select a subset: ?fields=NAME1,NAME2
+		if fields := r.URL.Query().Get("fields"); fields != "" {
+			selected := make(map[string]dx2w.Value)
+			for _, name := range strings.Split(fields, ",") {
+				if val, ok := ref[name]; ok {
+					selected[name] = val
+				}
+			}
+			ref = selected
+		}
 		w.Write(jsonBytes(ref))
 	}
 }
+
+func PutRegister(client *dx2w.TCPClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Value *float32 `json:"value"`
+		}
+		name := r.PathValue("name")
+
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil || request.Value == nil {
+			http.Error(w, "expected {\"value\": number}", http.StatusBadRequest)
+			return
+		}
+
+		value, err := client.Write(name, *request.Value)
+		switch {
+		case errors.Is(err, dx2w.ErrUnknownRegister):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, dx2w.ErrNotWritable), errors.Is(err, dx2w.ErrOutOfRange):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			log.Println("[dx2w_logger_http_server] write", name, "failed:", err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		log.Println("[dx2w_logger_http_server] wrote", name, "=", value.Float32, value.Units)
+
+		update_register_map(map[string]dx2w.Value{name: value})
+		bytes, _ := json.Marshal(value)
+		w.Write(bytes)
+	}
+}
+
+func GetHealth(client *dx2w.TCPClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bytes, err := json.MarshalIndent(client.Health(), "", "    ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(bytes)
+	}
+}
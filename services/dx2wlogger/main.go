@@ -20,14 +20,19 @@ func main() {
 
 	cfg := config.LoadV2(*config_path)
 
-	port := config.GetPort(cfg.ServiceHTTPAddresses.Dx2Wlogger)
-	go http_server(port)
-
-	// DX2W Modbus TCP device
-	dev := dx2w.TCPDevice{
+	// DX2W Modbus TCP device, this service holds the only
+	// modbus session and shares it with other services
+	// through its http server
+	client := dx2w.New(dx2w.TCPDevice{
 		Url: fmt.Sprintf("tcp://%s", cfg.Dx2WModbus.TCPAddress),
 		Id:  cfg.Dx2WModbus.DeviceID,
-	}
+	})
+
+	init_homeassistant(cfg)
+	init_metrics(client)
+
+	port := config.GetPort(cfg.ServiceHTTPAddresses.Dx2Wlogger)
+	go http_server(port, client)
 
 	var timer_60min time.Time
 	var timer_10min time.Time
@@ -44,25 +49,37 @@ func main() {
 		// always add fields from shortest interval
 		fields = append(fields, fields_15sec_interval...)
 
-		if time.Since(timer_60min) > time.Hour {
+		read_static := time.Since(timer_60min) > time.Hour
+		if read_static {
 			fields = append(fields, fields_static...)
-			timer_60min = time.Now()
 		}
 
-		if time.Since(timer_10min) > 10*time.Minute {
+		read_slow := time.Since(timer_10min) > 10*time.Minute
+		if read_slow {
 			fields = append(fields, fields_slow...)
-			timer_10min = time.Now()
 		}
 
-		if time.Since(timer_1min) > time.Minute {
+		read_1min := time.Since(timer_1min) > time.Minute
+		if read_1min {
 			fields = append(fields, fields_1min_interval...)
-			timer_1min = time.Now()
 		}
 
-		client := dx2w.NewWithFields(dev, fields)
-		results := client.ReadAll()
+		results := client.Read(fields)
 		update_register_map(results)
 
+		// the timers only restart once their fields were read,
+		// failed reads are retried on the next iteration
+		if read_static && has_fields(results, fields_static) {
+			timer_60min = time.Now()
+		}
+		if read_slow && has_fields(results, fields_slow) {
+			timer_10min = time.Now()
+		}
+		if read_1min && has_fields(results, fields_1min_interval) {
+			timer_1min = time.Now()
+		}
+		publish_registers()
+
 		// wait the shortest interval
 		wait := (15 * time.Second) - time.Since(start)
 		time.Sleep(wait)
@@ -70,6 +87,11 @@ func main() {
 }
 
 func update_register_map(results map[string]dx2w.Value) {
+	// the http server also updates the map after writes,
+	// so hold the lock for the whole copy and replace
+	global_mutex.Lock()
+	defer global_mutex.Unlock()
+
 	new_map := make(map[string]dx2w.Value)
 	// copy existing
 	for k, v := range register_map {
@@ -79,8 +101,14 @@ func update_register_map(results map[string]dx2w.Value) {
 	for k, v := range results {
 		new_map[k] = v
 	}
-	// lock to replace old with new
-	global_mutex.Lock()
 	register_map = new_map
-	global_mutex.Unlock()
+}
+
+func has_fields(results map[string]dx2w.Value, fields []string) bool {
+	for _, name := range fields {
+		if _, ok := results[name]; !ok {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"burlo/pkg/dx2w"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// controllerd's condensation interlock reads CONDENSATE_WARNING through
+// the http server, so it must be polled with the other 15 second fields
+func TestCondensateWarningServed(t *testing.T) {
+	results := make(map[string]dx2w.Value)
+	for _, name := range fields_15sec_interval {
+		results[name] = dx2w.Value{Timestamp: time.Now()}
+	}
+	update_register_map(results)
+
+	server := httptest.NewServer(GetRegisters())
+	defer server.Close()
+	client := dx2w.NewHTTPClient(strings.TrimPrefix(server.URL, "http://"))
+
+	values := client.Read([]string{"MIX_WATER_TEMP", "HP_EXITING_WATER_TEMP", "CONDENSATE_WARNING"})
+	if _, ok := values["CONDENSATE_WARNING"]; !ok || len(values) != 3 {
+		t.Errorf("expected the interlock registers, got %v", values)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"burlo/pkg/dx2w"
+	"burlo/pkg/metrics"
+	"time"
+)
+
+// init_metrics exposes the cached register values, with their units,
+// and the modbus session state at /metrics
+func init_metrics(client *dx2w.TCPClient) {
+	metrics.Collect(func(r *metrics.Registry) {
+		global_mutex.Lock()
+		defer global_mutex.Unlock()
+
+		for name, value := range register_map {
+			v := float64(value.Float32)
+			if value.Type == dx2w.BOOL {
+				v = metrics.Bool(value.Bool)
+			}
+			r.SetGauge("burlo_dx2w_register", "DX2W register value, in its units", v, "name", name, "units", value.Units)
+			r.SetGauge("burlo_dx2w_register_age_seconds", "Time since the register was read", time.Since(value.Timestamp).Seconds(), "name", name)
+		}
+	})
+	metrics.Collect(func(r *metrics.Registry) {
+		health := client.Health()
+		r.SetGauge("burlo_modbus_connected", "1 while the modbus session is connected", metrics.Bool(health.Connected))
+		// the snapshot starts without it, so adding sets the count
+		r.AddCounter("burlo_modbus_reconnects_total", "Modbus reconnects since the service started", float64(health.Reconnects))
+	})
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"burlo/pkg/psychro"
 	protocol "burlo/services/protocols"
 	"time"
 )
@@ -34,19 +35,8 @@ type Sensor struct {
 func (t *Thermostat) From(s protocol.SensorData) {
 	t.Temperature = s.Temperature
 	t.Humidity = s.Humidity
-	t.DewPoint = calculate_dewpoint_simple(t.Temperature, t.Humidity)
+	t.DewPoint = psychro.Dewpoint(t.Temperature, t.Humidity)
 	t.Sensor.Battery = s.Battery
 	t.Sensor.LinkQuality = s.LinkQuality
 	t.Time = time.Now()
 }
-
-func calculate_dewpoint_simple(temp, relH float32) float32 {
-	// a simple approximation, should err on the side of
-	// being too high, never too low. Temperature must be
-	// in celcius. Accureate to within 1 degC when RelH > 50%
-	if relH >= 50 && temp >= 25 {
-		return temp - ((100 - relH) / 5)
-	} else {
-		return temp - ((100 - relH) / 4)
-	}
-}